@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// acceptedFile is a vendored file that only matched one of its repository's
+// accepted revisions, which attestations and success proofs list, as it
+// didn't match the revision its package is pinned at.
+type acceptedFile struct {
+	ImportPath string
+	File       string
+	Rev        string
+}
+
+// acceptRevMap maps repository roots to the other revisions their vendored
+// files may match, as given with -accept-rev.
+type acceptRevMap map[string][]string
+
+// acceptRevs are the revisions given with -accept-rev.
+var acceptRevs = make(acceptRevMap)
+
+func (m acceptRevMap) String() string {
+	var s []string
+	for root, revs := range m {
+		for _, rev := range revs {
+			s = append(s, root+"="+rev)
+		}
+	}
+	sort.Strings(s)
+
+	return strings.Join(s, ", ")
+}
+
+// Set adds a revision of the form root=rev.
+func (m acceptRevMap) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("%q isn't of the form root=rev", s)
+	}
+
+	root, rev := s[:i], s[i+1:]
+	for _, r := range m[root] {
+		if r == rev {
+			return nil
+		}
+	}
+
+	m[root] = append(m[root], rev)
+
+	return nil
+}
+
+// isAccepted reports whether co is one of the repository's accepted
+// revisions, rather than one its packages are pinned at.
+func (r *repository) isAccepted(co *checkout) bool {
+	for _, c := range r.Accepted {
+		if c == co {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acceptedWithout returns the first of the repository's accepted checkouts
+// that doesn't have the file at relativePath, or nil if they all have it.
+func (r *repository) acceptedWithout(relativePath string) *checkout {
+	for _, co := range r.Accepted {
+		inner, ok := co.relative(relativePath)
+		if !ok {
+			return co
+		}
+
+		if _, err := os.Stat(filepath.Join(co.Dir, inner)); os.IsNotExist(err) {
+			return co
+		}
+	}
+
+	return nil
+}
+
+// matchAccepted compares a file that didn't match its own checkout with each
+// of accepted in turn, and if it's the same as one of them, marks it as the
+// same and compared with that one instead. A streamed file is compared with
+// them a block at a time too, and without -check-only modified, it only has
+// to be in one of them.
+func (c *comparison) matchAccepted(tree vendorTree, vendorPath string, accepted []*checkout, hash func([]byte) []byte) (bool, error) {
+	var vendored []byte
+	if !c.streamed {
+		vendored = hash(c.vendored)
+	}
+
+	for _, co := range accepted {
+		inner, ok := co.relative(c.relativePath)
+		if !ok {
+			continue
+		}
+
+		if !checkCategories.checks("modified") {
+			if _, err := os.Stat(filepath.Join(co.Dir, inner)); err == nil {
+				c.co, c.same, c.missing, c.sourcePath = co, true, false, ""
+				return true, nil
+			}
+
+			continue
+		}
+
+		if c.streamed {
+			same, _, err := compareFileStreams(tree, filepath.Join(vendorPath, c.relativePath), filepath.Join(co.Dir, inner))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+
+			if same {
+				c.co, c.same, c.missing, c.sourcePath = co, true, false, ""
+				return true, nil
+			}
+
+			continue
+		}
+
+		d, err := ioutil.ReadFile(filepath.Join(co.Dir, inner))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if h := hash(d); bytes.Equal(vendored, h) {
+			c.co, c.same, c.missing, c.sourcePath = co, true, false, ""
+			c.vendored, c.source = nil, nil
+			c.vendoredHash, c.sourceHash = vendored, h
+
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
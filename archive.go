@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// githubArchiveURL returns the URL of the tarball GitHub serves of the
+// repository at repo (as cloned) at rev, and false if the repository isn't on
+// GitHub.
+func githubArchiveURL(repo, rev string) (string, bool) {
+	u, err := url.Parse(repo)
+	if err != nil || u.Host != "github.com" {
+		return "", false
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+	if len(parts) != 2 {
+		return "", false
+	}
+
+	return "https://codeload.github.com/" + parts[0] + "/" + parts[1] + "/tar.gz/" + rev, true
+}
+
+// downloadArchive downloads the tarball at u and extracts it into target,
+// without the directory every entry in it is under. An archive that's
+// already been extracted is reused.
+func downloadArchive(ctx context.Context, u, target string) error {
+	if st, err := os.Stat(target); err == nil && st.IsDir() {
+		return nil
+	}
+
+	if *verbose {
+		fmt.Fprintf(output, "downloading %s\n", u)
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(target), ".extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extractTarball(res.Body, tmp, 1); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, target)
+}
+
+// extractGitArchive extracts what git archive makes of rev in the repository
+// at dir into target. Like a downloaded archive, it's reused once it's been
+// extracted, since the archive of a commit never changes.
+func extractGitArchive(ctx context.Context, dir, rev, target string) error {
+	if st, err := os.Stat(target); err == nil && st.IsDir() {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(target), ".extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := gitArchive(ctx, dir, rev, func(r io.Reader) error { return extractTar(r, tmp, 0) }); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, target)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// attestation records, for a build's provenance, that the vendored
+// dependencies matched their declared sources. It isn't signed; sign the file
+// separately if that's needed.
+type attestation struct {
+	Manifest     attestedManifest
+	Vendor       string
+	Dependencies []attestedDep
+	// AcceptedFiles are the files that matched a revision given with
+	// -accept-rev rather than their dependency's Rev.
+	AcceptedFiles []acceptedFile `json:",omitempty"`
+	// Passed is true when every file matched its source.
+	Passed bool
+	Time   time.Time
+	// Tool is the build of this program that made the attestation.
+	Tool toolInfo
+}
+
+type attestedManifest struct {
+	Path   string
+	SHA256 string
+}
+
+type attestedDep struct {
+	ImportPath string
+	Repository string `json:",omitempty"`
+	Rev        string `json:",omitempty"`
+	// PinnedRev is the manifest's revision, when it no longer exists upstream
+	// and Rev was compared in its place, with -allow-missing-rev.
+	PinnedRev string `json:",omitempty"`
+	// LocalDirectory is set instead of Repository and Rev for a dependency
+	// compared with a local directory, like one given with -local-src, as
+	// its files may not be those of any commit.
+	LocalDirectory string `json:",omitempty"`
+}
+
+// newAttestation creates an attestation for the manifest at manifestPath,
+// covering the repositories with the given names.
+func newAttestation(manifestPath, vendorPath string, names []string, repos map[string]*repository) (*attestation, error) {
+	d, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(d)
+
+	a := attestation{
+		Manifest: attestedManifest{Path: manifestPath, SHA256: hex.EncodeToString(sum[:])},
+		Vendor:   vendorPath,
+		Time:     time.Now().UTC(),
+		Tool:     currentTool(),
+	}
+
+	for _, name := range names {
+		repo := repos[name]
+
+		for _, p := range repo.Packages {
+			if repo.LocalDir != "" {
+				a.Dependencies = append(a.Dependencies, attestedDep{ImportPath: p.ImportPath, LocalDirectory: repo.LocalDir})
+				continue
+			}
+
+			dep := attestedDep{ImportPath: p.ImportPath, Repository: repo.Root.Repo, Rev: p.Rev}
+			if co := repo.checkout(p.Rev); co != nil && co.Substitute != "" {
+				dep.Rev, dep.PinnedRev = co.commit(), p.Rev
+			}
+
+			a.Dependencies = append(a.Dependencies, dep)
+		}
+
+		a.AcceptedFiles = append(a.AcceptedFiles, repo.acceptedFiles...)
+	}
+
+	return &a, nil
+}
+
+func (a *attestation) write(path string) error {
+	d, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(d, '\n'), 0644)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// browseReport lets the user look through r once the run is done, for -tui:
+// a list of repositories, then the changed files and problems of the one
+// they pick, then the diff of a file. Choices are read a line at a time from
+// in, as there's no terminal UI library vendored.
+func browseReport(r *Report, in io.Reader, w io.Writer) error {
+	s := bufio.NewScanner(in)
+
+	// read prompts for a line, returning false at the end of the input.
+	read := func(prompt string) (string, bool) {
+		fmt.Fprintf(w, "%s> ", prompt)
+		if !s.Scan() {
+			fmt.Fprintf(w, "\n")
+			return "", false
+		}
+
+		return strings.TrimSpace(s.Text()), true
+	}
+
+	for {
+		fmt.Fprintf(w, "\n")
+		for i, repo := range r.Repositories {
+			status := "ok"
+			switch {
+			case repo.Skipped:
+				status = "skipped"
+			case repo.Unchecked:
+				status = "ERROR"
+			case !repo.Passed():
+				status = "FAIL"
+			}
+
+			fmt.Fprintf(w, "%3d  %-7s %s (%d changed)\n", i+1, status, repo.Root, repo.Changed())
+		}
+
+		choice, ok := read("repository number, or q to quit")
+		if !ok || choice == "q" {
+			return s.Err()
+		}
+
+		n, err := strconv.Atoi(choice)
+		if err != nil || n < 1 || n > len(r.Repositories) {
+			fmt.Fprintf(w, "there's no repository %q\n", choice)
+			continue
+		}
+
+		if !browseRepository(r.Repositories[n-1], read, w) {
+			return s.Err()
+		}
+	}
+}
+
+// browseRepository shows the changed files of repo until the user goes back,
+// returning false if they quit instead.
+func browseRepository(repo *RepositoryReport, read func(prompt string) (string, bool), w io.Writer) bool {
+	var files []*FileReport
+	for _, f := range repo.Files {
+		if f.Status != statusOK {
+			files = append(files, f)
+		}
+	}
+
+	for {
+		fmt.Fprintf(w, "\n# %s at %s\n", repo.Root, repo.Rev)
+		for i, f := range files {
+			line := f.Status + " " + f.Path
+			if s := f.summary(); s != "" && f.Status == statusModified {
+				line += " (" + s + ")"
+			}
+
+			fmt.Fprintf(w, "%3d  %s\n", i+1, line)
+		}
+		for _, p := range repo.Problems {
+			fmt.Fprintf(w, "     %s\n", p)
+		}
+		if len(files) == 0 && len(repo.Problems) == 0 {
+			fmt.Fprintf(w, "     nothing changed\n")
+		}
+
+		choice, ok := read("file number, b to go back, or q to quit")
+		switch {
+		case !ok || choice == "q":
+			return false
+		case choice == "b":
+			return true
+		}
+
+		n, err := strconv.Atoi(choice)
+		if err != nil || n < 1 || n > len(files) {
+			fmt.Fprintf(w, "there's no file %q\n", choice)
+			continue
+		}
+
+		f := files[n-1]
+		if f.Diff == "" {
+			fmt.Fprintf(w, "%s is %s, so there's no diff\n", f.Path, f.summary())
+			continue
+		}
+
+		for _, l := range strings.Split(strings.TrimSpace(f.Diff), "\n") {
+			fmt.Fprintf(w, "> %s\n", l)
+		}
+	}
+}
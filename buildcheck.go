@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// buildTools are the go commands -build-check can run on each package.
+var buildTools = map[string]bool{"build": true, "vet": true}
+
+// buildFailure is a vendored package that doesn't compile, and what the go
+// command said about it.
+type buildFailure struct {
+	ImportPath string
+	Output     string
+}
+
+// vendoredPackages returns the import paths of the packages under vendorPath
+// that have Go files to build for ctxt, skipping the directories the go
+// command does: testdata, and those starting with "." or "_".
+func vendoredPackages(ctxt *build.Context, vendorPath string) ([]string, error) {
+	var packages []string
+
+	err := filepath.Walk(vendorPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() {
+			return nil
+		}
+
+		if path != vendorPath && (fi.Name() == "testdata" || strings.HasPrefix(fi.Name(), ".") || strings.HasPrefix(fi.Name(), "_")) {
+			return filepath.SkipDir
+		}
+
+		if _, err := ctxt.ImportDir(path, 0); err != nil {
+			if _, ok := err.(*build.NoGoError); ok {
+				return nil
+			}
+		}
+
+		if path != vendorPath {
+			rel, err := filepath.Rel(vendorPath, path)
+			if err != nil {
+				return err
+			}
+
+			packages = append(packages, filepath.ToSlash(rel))
+		}
+
+		return nil
+	})
+
+	sort.Strings(packages)
+
+	return packages, err
+}
+
+// checkBuild runs go build (or go vet, if that's the tool) on every package
+// vendored under vendorPath, in a GOPATH of its own holding just the vendor
+// directory, so that nothing outside it can make up for what it's missing.
+// Each package is built on its own, so that failures are put down to the
+// right one. It returns the failures and the number of packages checked.
+func checkBuild(ctx context.Context, tool, vendorPath string) ([]buildFailure, int, error) {
+	ctxt := platformContext()
+	if ctxt == nil {
+		ctxt = &build.Default
+	}
+
+	abs, err := filepath.Abs(vendorPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	packages, err := vendoredPackages(ctxt, abs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	gopath, err := ioutil.TempDir("", "godep-verify-build-")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(gopath)
+
+	if err := os.Symlink(abs, filepath.Join(gopath, "src")); err != nil {
+		return nil, 0, err
+	}
+
+	env := append(os.Environ(), "GOPATH="+gopath, "GO111MODULE=off", "GOFLAGS=", "GOOS="+ctxt.GOOS, "GOARCH="+ctxt.GOARCH)
+
+	var failures []buildFailure
+	for _, p := range packages {
+		args := []string{tool}
+		if len(ctxt.BuildTags) > 0 {
+			args = append(args, "-tags", strings.Join(ctxt.BuildTags, ","))
+		}
+
+		cmd := exec.CommandContext(ctx, "go", append(args, p)...)
+		cmd.Dir = gopath
+		cmd.Env = env
+		if *verbose {
+			fmt.Fprintf(output, "$ %s\n", strings.Join(cmd.Args, " "))
+		}
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+
+			if _, ok := err.(*exec.ExitError); !ok {
+				return nil, 0, err
+			}
+
+			failures = append(failures, buildFailure{ImportPath: p, Output: strings.TrimSpace(string(out))})
+		}
+	}
+
+	return failures, len(packages), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mismatchCategories are the kinds of mismatch -check-only can choose
+// between: files that aren't vendored, vendored files that aren't in the
+// source, files whose contents differ, execute bits that differ, and
+// symlinks that differ.
+var mismatchCategories = []string{"missing", "extra", "modified", "mode", "symlink"}
+
+// categorySet is the set of mismatch categories given with -check-only.
+type categorySet map[string]bool
+
+// checkCategories are the categories given with -check-only, or nil if it
+// wasn't, in which case every category but symlink is checked, and mode only
+// with -check-executable.
+var checkCategories categorySet
+
+func parseCategories(s string) (categorySet, error) {
+	known := make(map[string]bool)
+	for _, c := range mismatchCategories {
+		known[c] = true
+	}
+
+	set := make(categorySet)
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		if !known[c] {
+			return nil, fmt.Errorf("unknown -check-only category %q, expected some of %s", c, strings.Join(mismatchCategories, ", "))
+		}
+
+		set[c] = true
+	}
+
+	if len(set) == 0 {
+		return nil, fmt.Errorf("-check-only needs at least one of %s", strings.Join(mismatchCategories, ", "))
+	}
+
+	return set, nil
+}
+
+// checks reports whether mismatches in category are looked for.
+func (s categorySet) checks(category string) bool {
+	if s == nil {
+		switch category {
+		case "mode":
+			return *checkExecutable
+		case "symlink":
+			return false
+		}
+
+		return true
+	}
+
+	return s[category]
+}
+
+// partial reports whether s leaves out any of the mismatches a run without
+// -check-only would look for, so that passing doesn't show every file matched.
+func (s categorySet) partial() bool {
+	if s == nil {
+		return false
+	}
+
+	return !s["missing"] || !s["extra"] || !s["modified"] || (*checkExecutable && !s["mode"])
+}
+
+// symlinkDifference describes how the vendored file at vendored differs from
+// its source at source in whether it's a symlink, and where to, or returns ""
+// if they're the same.
+func symlinkDifference(vendored, source string) (string, error) {
+	vt, err := linkTarget(vendored)
+	if err != nil {
+		return "", err
+	}
+
+	st, err := linkTarget(source)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case vt == st:
+		return "", nil
+	case st == "":
+		return "is a symlink to " + vt + ", but its source isn't a symlink", nil
+	case vt == "":
+		return "isn't a symlink, but its source is one to " + st, nil
+	}
+
+	return "is a symlink to " + vt + ", but its source links to " + st, nil
+}
+
+// linkTarget returns what the symlink at p points to, with slashes, or "" if
+// p isn't a symlink.
+func linkTarget(p string) (string, error) {
+	fi, err := os.Lstat(p)
+	if err != nil {
+		return "", err
+	}
+
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return "", nil
+	}
+
+	t, err := os.Readlink(p)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(t), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// comparison is a vendored file to compare with its source, and the result of
+// comparing them.
+type comparison struct {
+	relativePath string
+	co           *checkout
+
+	// missing is set if the file isn't in the source.
+	missing bool
+	// sourcePath is set to the path of the file in the source when it's only
+	// found there with different case, with -case-insensitive-match.
+	sourcePath string
+	// executable is set if the vendored file has an execute bit set.
+	executable bool
+	same       bool
+	// vendored and source are kept for files that differ, so that they can be
+	// diffed. vendored is also kept for files that aren't in the source.
+	vendored []byte
+	source   []byte
+	err      error
+
+	// size and elapsed are the size of the vendored file and how long it took
+	// to read, hash and compare, for -profile-files.
+	size    int
+	elapsed time.Duration
+	// vendoredHash and sourceHash are kept for -detect-dupes.
+	vendoredHash []byte
+	sourceHash   []byte
+
+	// streamed is set for a file too big to read whole within -max-memory,
+	// which is compared a block at a time instead, so vendored and source
+	// aren't kept. differsAt is the offset of the first block that differs.
+	streamed  bool
+	differsAt int64
+}
+
+// streamAbove is the size of the largest file that's read whole to compare
+// it, with -max-memory; bigger ones are streamed. It's 0 for no limit.
+var streamAbove int64
+
+// streamBlockSize is how much of each file is read at a time when comparing
+// it a block at a time.
+const streamBlockSize = 64 << 10
+
+// compareFiles compares each file in files, vendored under vendorPath, with
+// the same file in its checkout by their hashes, using up to threads
+// goroutines.
+func compareFiles(ctx context.Context, tree vendorTree, vendorPath string, files []*comparison, threads int, hash func([]byte) []byte) {
+	if threads < 1 {
+		threads = 1
+	}
+
+	ch := make(chan *comparison)
+
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for c := range ch {
+				if c.err = ctx.Err(); c.err == nil {
+					c.compare(tree, vendorPath, hash)
+				}
+			}
+		}()
+	}
+
+	for _, c := range files {
+		ch <- c
+	}
+	close(ch)
+
+	wg.Wait()
+}
+
+// findFoldedPath looks for a file at relativePath under root, ignoring case,
+// and returns its actual path.
+func findFoldedPath(root, relativePath string) (string, bool) {
+	var found []string
+
+	for _, part := range strings.Split(filepath.ToSlash(relativePath), "/") {
+		entries, err := ioutil.ReadDir(filepath.Join(root, filepath.Join(found...)))
+		if err != nil {
+			return "", false
+		}
+
+		match := ""
+		for _, e := range entries {
+			if e.Name() == part {
+				match = part
+				break
+			}
+
+			if match == "" && strings.EqualFold(e.Name(), part) {
+				match = e.Name()
+			}
+		}
+
+		if match == "" {
+			return "", false
+		}
+
+		found = append(found, match)
+	}
+
+	return filepath.Join(found...), true
+}
+
+func (c *comparison) compare(tree vendorTree, vendorPath string, hash func([]byte) []byte) {
+	start := time.Now()
+	defer func() { c.elapsed = time.Since(start) }()
+
+	// Without modified files to look for, all that matters is whether the
+	// source has the file.
+	if !checkCategories.checks("modified") {
+		source, err := c.sourceFile()
+		if err != nil {
+			c.err = &ComparisonError{Path: filepath.Join(vendorPath, c.relativePath), Err: err}
+		}
+
+		c.missing, c.same = source == "", source != ""
+		return
+	}
+
+	if streamAbove > 0 && int64(c.size) > streamAbove {
+		c.compareStreaming(tree, vendorPath)
+		return
+	}
+
+	d1, err := tree.ReadFile(filepath.Join(vendorPath, c.relativePath))
+	if err != nil {
+		c.err = &ComparisonError{Path: filepath.Join(vendorPath, c.relativePath), Err: err}
+		return
+	}
+	c.size = len(d1)
+
+	inner, ok := c.co.relative(c.relativePath)
+	if !ok {
+		c.missing, c.vendored = true, d1
+		return
+	}
+
+	d2, err := ioutil.ReadFile(filepath.Join(c.co.Dir, inner))
+	if os.IsNotExist(err) && *caseInsensitive {
+		if p, ok := findFoldedPath(c.co.Dir, inner); ok {
+			c.sourcePath = filepath.Join(c.co.Subdir, p)
+			d2, err = ioutil.ReadFile(filepath.Join(c.co.Dir, p))
+		}
+	}
+	if os.IsNotExist(err) {
+		c.missing, c.vendored = true, d1
+		return
+	}
+	if err != nil {
+		c.err = &ComparisonError{Path: filepath.Join(vendorPath, c.relativePath), Err: err}
+		return
+	}
+
+	// Files of different sizes can't be the same, so with -compare-mode
+	// size-first they aren't hashed, unless -detect-dupes needs the hashes.
+	if *compareMode == "size-first" && len(d1) != len(d2) && !*detectDupes {
+		c.same = false
+	} else {
+		c.vendoredHash, c.sourceHash = hash(d1), hash(d2)
+		c.same = bytes.Equal(c.vendoredHash, c.sourceHash)
+	}
+
+	if !c.same {
+		c.vendored, c.source = d1, d2
+	}
+}
+
+// compareStreaming compares the file with its source a block at a time, so
+// that neither is held in memory whole.
+func (c *comparison) compareStreaming(tree vendorTree, vendorPath string) {
+	c.streamed = true
+	name := filepath.Join(vendorPath, c.relativePath)
+
+	source, err := c.sourceFile()
+	if err != nil {
+		c.err = &ComparisonError{Path: name, Err: err}
+		return
+	}
+
+	if source == "" {
+		c.missing = true
+		return
+	}
+
+	if c.same, c.differsAt, err = compareFileStreams(tree, name, source); err != nil {
+		c.err = &ComparisonError{Path: name, Err: err}
+	}
+}
+
+// sourceFile returns the path of the file's source, or "" if it isn't in the
+// checkout, looking for it with different case with -case-insensitive-match.
+func (c *comparison) sourceFile() (string, error) {
+	inner, ok := c.co.relative(c.relativePath)
+	if !ok {
+		return "", nil
+	}
+
+	p := filepath.Join(c.co.Dir, inner)
+
+	_, err := os.Stat(p)
+	if os.IsNotExist(err) && *caseInsensitive {
+		if f, ok := findFoldedPath(c.co.Dir, inner); ok {
+			c.sourcePath = filepath.Join(c.co.Subdir, f)
+			p = filepath.Join(c.co.Dir, f)
+			_, err = os.Stat(p)
+		}
+	}
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return p, err
+}
+
+// compareFileStreams compares the file at name in tree with the one at
+// source a block at a time, stopping at the first block that differs, and
+// returns whether they're the same, and if not, where that block starts.
+func compareFileStreams(tree vendorTree, name, source string) (bool, int64, error) {
+	v, err := tree.Open(name)
+	if err != nil {
+		return false, 0, err
+	}
+	defer v.Close()
+
+	s, err := os.Open(source)
+	if err != nil {
+		return false, 0, err
+	}
+	defer s.Close()
+
+	a, b := make([]byte, streamBlockSize), make([]byte, streamBlockSize)
+
+	var offset int64
+	for {
+		na, err := io.ReadFull(v, a)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, 0, err
+		}
+
+		nb, err := io.ReadFull(s, b)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, 0, err
+		}
+
+		if na != nb || !bytes.Equal(a[:na], b[:nb]) {
+			return false, offset, nil
+		}
+
+		if na < streamBlockSize {
+			return true, 0, nil
+		}
+
+		offset += int64(na)
+	}
+}
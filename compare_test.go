@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// streamData returns n bytes that vary with their offset, with the byte
+// at each offset in flip changed.
+func streamData(n int, flip ...int) []byte {
+	d := make([]byte, n)
+	for i := range d {
+		d[i] = byte(i * 7 / 3)
+	}
+
+	for _, i := range flip {
+		d[i] ^= 0xff
+	}
+
+	return d
+}
+
+func TestCompareFileStreams(t *testing.T) {
+	const n = streamBlockSize
+
+	tests := []struct {
+		name      string
+		vendored  []byte
+		source    []byte
+		same      bool
+		differsAt int64
+	}{
+		{"empty", nil, nil, true, 0},
+		{"one block", streamData(n), streamData(n), true, 0},
+		{"two blocks", streamData(2 * n), streamData(2 * n), true, 0},
+		{"part of a block over", streamData(n + 1), streamData(n + 1), true, 0},
+		{"less than a block", streamData(10), streamData(10), true, 0},
+
+		{"empty and not", nil, streamData(1), false, 0},
+		{"one block and a byte", streamData(n), streamData(n + 1), false, n},
+		{"two blocks and one", streamData(2 * n), streamData(n), false, n},
+		{"short in the first block", streamData(n - 1), streamData(n), false, 0},
+
+		{"changed in the first block", streamData(2*n, 5), streamData(2 * n), false, 0},
+		{"changed at the start of the second block", streamData(2*n, n), streamData(2 * n), false, n},
+		{"changed at the end of the first block", streamData(2*n, n-1), streamData(2 * n), false, 0},
+		{"changed in the last byte", streamData(3*n, 3*n-1), streamData(3 * n), false, 2 * n},
+	}
+
+	dir, err := ioutil.TempDir("", "godep-verify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	vendored, source := filepath.Join(dir, "vendored"), filepath.Join(dir, "source")
+
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(vendored, tt.vendored, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(source, tt.source, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		same, differsAt, err := compareFileStreams(dirTree{}, vendored, source)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if same != tt.same || differsAt != tt.differsAt {
+			t.Errorf("%s: got same %v, differs at %d, want same %v, differs at %d", tt.name, same, differsAt, tt.same, tt.differsAt)
+		}
+	}
+}
+
+func TestCompareFileStreamsMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godep-verify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "a")
+	if err := ioutil.WriteFile(p, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := compareFileStreams(dirTree{}, p, filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("comparing with a missing source succeeded")
+	}
+}
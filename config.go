@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// config holds settings that are too detailed to pass as flags, read from the
+// JSON file given by -config.
+type config struct {
+	// Repositories holds per-repository settings, keyed by repository root.
+	Repositories map[string]repoConfig
+}
+
+type repoConfig struct {
+	// CachePath, if set, is used as the checkout directory for the repository
+	// instead of its usual place under the cache directory.
+	CachePath string
+	// LocalRepository, if set, is an existing clone of the repository. The
+	// checkout is made with git worktree add from it instead of cloning again,
+	// so the two share their objects.
+	LocalRepository string
+	// FallbackRemotes are other URLs the repository can be cloned or fetched
+	// from, tried in order when the usual one fails, such as a trusted fork
+	// or mirror.
+	FallbackRemotes []string
+	// Source, if set, is where the repository is compared against, whatever
+	// the flags say: git to clone it, tarball to download Tarball, local for
+	// the directory at LocalPath, modcache for the Go module cache, or
+	// archive-api for GitHub's archive of the pinned commit.
+	Source string
+	// Tarball is the URL of a tarball of the repository for Source tarball,
+	// with {rev} replaced by the pinned revision.
+	Tarball string
+	// LocalPath is the directory to compare against for Source local, as it
+	// is, like -local-src.
+	LocalPath string
+}
+
+// sourceBackends are the values Source can take.
+var sourceBackends = []string{"git", "tarball", "local", "modcache", "archive-api"}
+
+func readConfig(path string) (*config, error) {
+	var c config
+
+	if path == "" {
+		return &c, nil
+	}
+
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(d, &c); err != nil {
+		return nil, err
+	}
+
+	for root, rc := range c.Repositories {
+		if err := rc.checkSource(); err != nil {
+			return nil, fmt.Errorf("%s: repository %s: %s", path, root, err)
+		}
+	}
+
+	return &c, nil
+}
+
+func (rc repoConfig) checkSource() error {
+	switch rc.Source {
+	case "", "git", "modcache", "archive-api":
+	case "tarball":
+		if rc.Tarball == "" {
+			return fmt.Errorf("a tarball Source needs a Tarball URL")
+		}
+	case "local":
+		if rc.LocalPath == "" {
+			return fmt.Errorf("a local Source needs a LocalPath")
+		}
+	default:
+		return fmt.Errorf("unknown Source %q, expected one of %s", rc.Source, strings.Join(sourceBackends, ", "))
+	}
+
+	return nil
+}
+
+// source returns the backend the repository with the given root is checked
+// out with, if the config chooses one.
+func (c *config) source(root string) string {
+	return c.Repositories[root].Source
+}
+
+// uses reports whether the repository with the given root is checked out
+// with backend, which is the case for every repository when enabled, i.e.
+// the backend's flag was given, unless the config chooses another.
+func (c *config) uses(root, backend string, enabled bool) bool {
+	if s := c.source(root); s != "" {
+		return s == backend
+	}
+
+	return enabled
+}
+
+// downloadedSources returns the roots of the repositories the config has
+// downloaded some other way than cloning, sorted. Those compared against a
+// local directory aren't included, as they're treated like -local-src.
+func (c *config) downloadedSources() []string {
+	var roots []string
+	for root, rc := range c.Repositories {
+		if rc.Source != "" && rc.Source != "git" && rc.Source != "local" {
+			roots = append(roots, root)
+		}
+	}
+	sort.Strings(roots)
+
+	return roots
+}
+
+// repositoryCachePath returns the directory to check out the repository with
+// the given root into. A nested repository, whose root is inside another's,
+// is checked out under a name without slashes, so it isn't checked out inside
+// the other's checkout.
+func (c *config) repositoryCachePath(root string, nested bool) string {
+	if p := c.Repositories[root].CachePath; p != "" {
+		return p
+	}
+
+	if nested {
+		return filepath.Join(checkoutCacheDir(), "_nested", url.PathEscape(root))
+	}
+
+	return filepath.Join(checkoutCacheDir(), root)
+}
+
+// checkoutCacheDir is the directory under the cache directory that
+// repositories are checked out into.
+func checkoutCacheDir() string {
+	return filepath.Join(*cachePath, "vendor-verify")
+}
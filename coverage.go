@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// statusSkipped is a file left out on purpose, by -sample or
+// -upstream-changed-since. It's only used in coverage manifests.
+const statusSkipped = "skipped"
+
+// coverageManifest is written by -coverage-output, listing every file the run
+// looked at, including those that matched, so an audit can confirm nothing
+// was left out by a wrong path or filter.
+type coverageManifest struct {
+	Manifest string
+	Tool     toolInfo
+	Files    []coveredFile
+	// Counts are how many files had each status.
+	Counts map[string]int
+	// Repositories, FailedRepositories and UncheckedRepositories are the
+	// numbers in the summary line at the end of -group-by-repo.
+	Repositories          int
+	FailedRepositories    int
+	UncheckedRepositories int `json:",omitempty"`
+	// SkippedRepositories are those that weren't looked at, because they
+	// passed before, with -incremental or -resume.
+	SkippedRepositories []string `json:",omitempty"`
+}
+
+type coveredFile struct {
+	ImportPath string
+	File       string
+	Status     string
+}
+
+// repositoryCounts returns how many of the repositories in r failed, and how
+// many couldn't be checked at all.
+func (r *Report) repositoryCounts() (failed, unchecked int) {
+	for _, repo := range r.Repositories {
+		switch {
+		case repo.Skipped:
+		case repo.Unchecked:
+			unchecked++
+		case !repo.Passed():
+			failed++
+		}
+	}
+
+	return failed, unchecked
+}
+
+// newCoverageManifest lists the files in r, with those that matched and those
+// that were skipped, sorted by import path and name.
+func newCoverageManifest(r *Report) *coverageManifest {
+	m := &coverageManifest{Manifest: r.Manifest, Tool: r.Tool, Counts: make(map[string]int), Repositories: len(r.Repositories)}
+	m.FailedRepositories, m.UncheckedRepositories = r.repositoryCounts()
+
+	add := func(root, relativePath, status string) {
+		file := filepath.ToSlash(relativePath)
+		m.Files = append(m.Files, coveredFile{ImportPath: path.Join(root, path.Dir(file)), File: path.Base(file), Status: status})
+		m.Counts[status]++
+	}
+
+	for _, repo := range r.Repositories {
+		if repo.Skipped {
+			m.SkippedRepositories = append(m.SkippedRepositories, repo.Root)
+			continue
+		}
+
+		for _, f := range repo.Files {
+			add(repo.Root, f.Path, f.Status)
+		}
+		for _, p := range repo.unchanged {
+			add(repo.Root, p, statusOK)
+		}
+		for _, p := range repo.skippedFiles {
+			add(repo.Root, p, statusSkipped)
+		}
+	}
+
+	sort.Slice(m.Files, func(i, j int) bool {
+		if m.Files[i].ImportPath != m.Files[j].ImportPath {
+			return m.Files[i].ImportPath < m.Files[j].ImportPath
+		}
+		return m.Files[i].File < m.Files[j].File
+	})
+	sort.Strings(m.SkippedRepositories)
+
+	return m
+}
+
+func writeCoverageManifest(path string, r *Report) error {
+	d, err := json.MarshalIndent(newCoverageManifest(r), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(d, '\n'), 0644)
+}
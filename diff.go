@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// maxChangedLines is how many hunk locations are listed for a changed file.
+const maxChangedLines = 5
+
+// noNewline is added to the last line of a file that doesn't end in a
+// newline. Since difflib prints each line as it is, this shows up in diffs on
+// a line of its own, the same as with diff and git.
+const noNewline = "\n\\ No newline at end of file\n"
+
+// splitLines splits s into lines for diffing. Unlike difflib.SplitLines, each
+// line keeps the ending it had, so CRLF line endings are shown as they are,
+// and no empty line is added after a trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+
+	if last := lines[len(lines)-1]; last == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] = last + noNewline
+	}
+
+	return lines
+}
+
+// changedLines returns the line numbers in a where each of the first few
+// hunks of a diff between a and b starts changing.
+func changedLines(a, b []string) []int {
+	var lines []int
+
+	for _, group := range difflib.NewMatcher(a, b).GetGroupedOpCodes(3) {
+		for _, op := range group {
+			if op.Tag != 'e' {
+				lines = append(lines, op.I1+1)
+				break
+			}
+		}
+
+		if len(lines) == maxChangedLines {
+			break
+		}
+	}
+
+	return lines
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// cosmeticDifference describes the difference between a and b if it's only a
+// leading byte order mark or trailing whitespace, the usual results of an
+// editor mishap rather than a real change. It returns an empty string if the
+// difference is anything else.
+func cosmeticDifference(a, b []byte) string {
+	bom := bytes.HasPrefix(a, utf8BOM) != bytes.HasPrefix(b, utf8BOM)
+	a, b = bytes.TrimPrefix(a, utf8BOM), bytes.TrimPrefix(b, utf8BOM)
+
+	switch {
+	case bom && bytes.Equal(a, b):
+		return "only a byte order mark"
+	case !bytes.Equal(trimTrailingSpace(a), trimTrailingSpace(b)):
+		return ""
+	case bom:
+		return "only a byte order mark and trailing whitespace"
+	default:
+		return "only trailing whitespace"
+	}
+}
+
+// trimTrailingSpace removes the whitespace from the end of each line in d, and
+// any blank lines from the end of d.
+func trimTrailingSpace(d []byte) []byte {
+	lines := bytes.Split(d, []byte("\n"))
+	for i, l := range lines {
+		lines[i] = bytes.TrimRight(l, " \t\r\v\f")
+	}
+
+	return bytes.TrimRight(bytes.Join(lines, []byte("\n")), "\n")
+}
+
+// mixedLineEndings reports whether d has both CRLF and bare LF line endings.
+func mixedLineEndings(d []byte) bool {
+	crlf := bytes.Count(d, []byte("\r\n"))
+	return crlf > 0 && crlf < bytes.Count(d, []byte("\n"))
+}
+
+// lineEndingDifference describes how the consistency of the line endings in
+// vendored differs from upstream, where one mixes CRLF and LF and the other
+// doesn't, which usually means an editor or a merge got to it. It returns an
+// empty string if they're alike.
+func lineEndingDifference(vendored, upstream []byte) string {
+	switch v, u := mixedLineEndings(vendored), mixedLineEndings(upstream); {
+	case v && !u:
+		return "mixed CRLF and LF line endings, unlike upstream"
+	case u && !v:
+		return "consistent line endings, where upstream mixes CRLF and LF"
+	}
+
+	return ""
+}
+
+// truncation describes how a vendored file of vendoredSize bytes looks like
+// a truncated copy of its source of sourceSize bytes, the usual result of a
+// copy or download that was cut short: it's empty, it stops partway through
+// a line of the source (if prefix), or it's less than half the size. One
+// that stops at the end of a line is more likely missing lines added
+// upstream. It returns an empty string if it doesn't look truncated.
+func truncation(vendoredSize, sourceSize int64, prefix bool) string {
+	if sourceSize == 0 || vendoredSize >= sourceSize {
+		return ""
+	}
+
+	if vendoredSize == 0 || prefix || vendoredSize < sourceSize/2 {
+		return fmt.Sprintf("%d of %d bytes, %d fewer than upstream", vendoredSize, sourceSize, sourceSize-vendoredSize)
+	}
+
+	return ""
+}
+
+// reindented reports whether a and b differ only in the tabs and spaces at
+// the start of their lines, as when an editor converts one to the other.
+func reindented(a, b []byte) bool {
+	la, lb := bytes.Split(a, []byte("\n")), bytes.Split(b, []byte("\n"))
+	if len(la) != len(lb) || bytes.Equal(a, b) {
+		return false
+	}
+
+	for i := range la {
+		if !bytes.Equal(bytes.TrimLeft(la[i], " \t"), bytes.TrimLeft(lb[i], " \t")) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nondeterministicPatterns match the parts of generated files that tend to
+// change every time they're generated: timestamps, in ISO 8601 and date(1)
+// formats, and absolute paths on the machine that generated them.
+var nondeterministicPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?: ?(?:Z|[+-]\d{2}:?\d{2}|[A-Z]{3,4}))?`),
+	regexp.MustCompile(`(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun),? +(?:\d{1,2} +)?(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)(?: +\d{1,2})? +\d{2}:\d{2}:\d{2}(?: +[A-Z]{3,4}| +[+-]\d{4})?(?: +\d{4})?`),
+	regexp.MustCompile("(?:^|[^\\w./-])/(?:home|Users|tmp|var|build|opt|root|workspace|go|src)/[^\\s\"'`:]*"),
+	regexp.MustCompile("\\b[A-Za-z]:\\\\[^\\s\"'`]*"),
+}
+
+// nondeterministic reports whether a and b only differ in the parts matched
+// by patterns, which suggests the file is regenerated differently every time
+// rather than edited.
+func nondeterministic(a, b []byte, patterns []*regexp.Regexp) bool {
+	if bytes.Equal(a, b) {
+		return false
+	}
+
+	for _, re := range patterns {
+		a, b = re.ReplaceAll(a, []byte("\x00")), re.ReplaceAll(b, []byte("\x00"))
+	}
+
+	return bytes.Equal(a, b)
+}
+
+// regexpList is a list of regular expressions, as given with
+// -nondeterministic-pattern.
+type regexpList []*regexp.Regexp
+
+func (l *regexpList) String() string {
+	s := make([]string, len(*l))
+	for i, re := range *l {
+		s[i] = re.String()
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func (l *regexpList) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+
+	*l = append(*l, re)
+	return nil
+}
+
+// generatedRegexp matches the comment marking a Go source file as generated,
+// as described by "go help generate".
+var generatedRegexp = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether d has the generated code comment.
+func isGenerated(d []byte) bool {
+	return generatedRegexp.Match(d)
+}
+
+// describeLines formats line numbers for the log, like "near lines 12, 48".
+func describeLines(lines []int) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	s := make([]string, len(lines))
+	for i, l := range lines {
+		s[i] = strconv.Itoa(l)
+	}
+
+	if len(lines) == 1 {
+		return fmt.Sprintf("near line %s", s[0])
+	}
+
+	return fmt.Sprintf("near lines %s", strings.Join(s, ", "))
+}
+
+// diffAlgorithms are the algorithms -diff-algorithm accepts. Only difflib is
+// built in; the rest are git diff's.
+var diffAlgorithms = map[string]bool{"difflib": true, "myers": true, "minimal": true, "patience": true, "histogram": true}
+
+// unifiedDiff returns a unified diff from d1 to d2, labelled with from and to,
+// made with the algorithm chosen with -diff-algorithm.
+func unifiedDiff(ctx context.Context, d1, d2 []byte, from, to string) (string, error) {
+	if *diffAlgorithm == "difflib" {
+		return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(string(d1)),
+			B:        splitLines(string(d2)),
+			FromFile: from,
+			ToFile:   to,
+			Context:  3,
+			Eol:      "\n",
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "godep-verify-diff-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := ioutil.WriteFile(a, d1, 0600); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(b, d2, 0600); err != nil {
+		return "", err
+	}
+
+	out, err := gitDiffFiles(ctx, a, b, *diffAlgorithm)
+	if err != nil {
+		return "", err
+	}
+
+	// git's headers name the temporary files, so only its hunks are kept.
+	i := bytes.Index(out, []byte("\n@@ "))
+	if i < 0 {
+		return "", nil
+	}
+
+	return "--- " + from + "\n+++ " + to + "\n" + string(out[i+1:]), nil
+}
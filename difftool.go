@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// diffTool is an external program to show changed files with, as given by
+// -diff-tool. Its arguments can refer to the vendored and source copies of a
+// file as $VENDORED and $SOURCE, for tools like meld that compare two files.
+// A tool that doesn't refer to either is given the unified diff on its
+// standard input instead, for tools like delta that reformat a diff.
+type diffTool struct {
+	args []string
+}
+
+// newDiffTool parses the -diff-tool command line. It returns nil if the
+// program can't be found, so the built in diff is used instead.
+func newDiffTool(command string) *diffTool {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil
+	}
+
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil
+	}
+
+	return &diffTool{args: args}
+}
+
+// show runs the tool for the file called name, whose vendored and source
+// contents are vendored and source, and whose unified diff is diff.
+func (t *diffTool) show(name string, vendored, source []byte, diff string) error {
+	files := false
+	for _, a := range t.args {
+		os.Expand(a, func(k string) string {
+			files = files || k == "VENDORED" || k == "SOURCE"
+			return ""
+		})
+	}
+
+	if !files {
+		cmd := exec.Command(t.args[0], t.args[1:]...)
+		cmd.Stdin = strings.NewReader(diff)
+		cmd.Stdout, cmd.Stderr = output, errOutput
+		return runDiffTool(cmd)
+	}
+
+	dir, err := ioutil.TempDir("", "godep-verify-diff-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Keep the file's name, so that the tool can show it and pick syntax
+	// highlighting by extension.
+	paths := map[string]string{
+		"VENDORED": filepath.Join(dir, "vendored", filepath.Base(name)),
+		"SOURCE":   filepath.Join(dir, "source", filepath.Base(name)),
+	}
+
+	for k, d := range map[string][]byte{"VENDORED": vendored, "SOURCE": source} {
+		if err := os.MkdirAll(filepath.Dir(paths[k]), 0700); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(paths[k], d, 0600); err != nil {
+			return err
+		}
+	}
+
+	args := make([]string, len(t.args))
+	for i, a := range t.args {
+		args[i] = os.Expand(a, func(k string) string {
+			if p, ok := paths[k]; ok {
+				return p
+			}
+
+			return "$" + k
+		})
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, output, errOutput
+	return runDiffTool(cmd)
+}
+
+// runDiffTool runs cmd, only failing if it couldn't be run at all. Like diff,
+// many tools exit with a non-zero status when the files differ.
+func runDiffTool(cmd *exec.Cmd) error {
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return nil
+	}
+
+	return err
+}
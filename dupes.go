@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// vendoredFile is the hash of a vendored file and of its source.
+type vendoredFile struct {
+	Path         string
+	VendoredHash string
+	SourceHash   string
+}
+
+// duplicatedFiles returns the paths of each group of files in different
+// packages that were vendored with the same content, even though their
+// sources differ. That's usually one file copied over another by a botched
+// vendoring, rather than files that are meant to be the same, which would be
+// the same upstream too.
+func duplicatedFiles(files []vendoredFile) [][]string {
+	var order []string
+	groups := make(map[string][]vendoredFile)
+	for _, f := range files {
+		if len(groups[f.VendoredHash]) == 0 {
+			order = append(order, f.VendoredHash)
+		}
+		groups[f.VendoredHash] = append(groups[f.VendoredHash], f)
+	}
+
+	var dupes [][]string
+	for _, h := range order {
+		group := groups[h]
+
+		dirs, sources := make(map[string]bool), make(map[string]bool)
+		for _, f := range group {
+			dirs[filepath.Dir(f.Path)] = true
+			sources[f.SourceHash] = true
+		}
+
+		if len(dirs) < 2 || len(sources) < 2 {
+			continue
+		}
+
+		paths := make([]string, len(group))
+		for i, f := range group {
+			paths[i] = f.Path
+		}
+
+		dupes = append(dupes, paths)
+	}
+
+	return dupes
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The error types below let callers tell the ways a run can fail apart,
+// without matching on messages. Each wraps the error that caused it, which
+// Unwrap returns.
+
+// ManifestError is returned when the manifest can't be read or parsed.
+type ManifestError struct {
+	Path string
+	Err  error
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("couldn't read manifest %q: %s", e.Path, e.Err)
+}
+
+func (e *ManifestError) Unwrap() error { return e.Err }
+
+// ResolutionError is returned when an import path can't be resolved to a
+// repository, or resolves to one that isn't allowed.
+type ResolutionError struct {
+	ImportPath string
+	Err        error
+}
+
+func (e *ResolutionError) Error() string {
+	return fmt.Sprintf("couldn't resolve %s: %s", e.ImportPath, e.Err)
+}
+
+func (e *ResolutionError) Unwrap() error { return e.Err }
+
+// Stages of getting a checkout that a CheckoutError can happen at.
+const (
+	stageDownload = "download"
+	stageClone    = "clone"
+	stageFetch    = "fetch"
+	stageCheckout = "checkout"
+	// stageOther is anything else, like a checkout that failed a check.
+	stageOther = "other"
+)
+
+// stageError records which stage of getting a checkout err happened at, for
+// newCheckoutError.
+type stageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *stageError) Error() string { return e.Err.Error() }
+
+func (e *stageError) Unwrap() error { return e.Err }
+
+// atStage wraps err, if it isn't nil, to say it happened at stage.
+func atStage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &stageError{Stage: stage, Err: err}
+}
+
+// CheckoutError is returned when a repository can't be checked out at a
+// revision.
+type CheckoutError struct {
+	Repo string
+	Rev  string
+	// Stage is which stage of getting the checkout failed, like stageClone.
+	Stage string
+	// Stderr is what git printed, if it was a git command that failed.
+	Stderr string
+	Err    error
+}
+
+// newCheckoutError wraps err, taking the stage it happened at and the output
+// of git from it if there is some.
+func newCheckoutError(repo, rev string, err error) *CheckoutError {
+	e := &CheckoutError{Repo: repo, Rev: rev, Stage: stageOther, Err: err}
+	if se, ok := err.(*stageError); ok {
+		e.Stage, e.Err = se.Stage, se.Err
+	}
+	if ee, ok := e.Err.(*exec.ExitError); ok {
+		e.Stderr = strings.TrimSpace(string(ee.Stderr))
+	}
+
+	return e
+}
+
+func (e *CheckoutError) Error() string {
+	return fmt.Sprintf("couldn't check out %s at %s: %s", e.Repo, e.Rev, e.reason())
+}
+
+// reason describes the error without saying which checkout it's about.
+func (e *CheckoutError) reason() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("%s: %s", e.Err, e.Stderr)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *CheckoutError) Unwrap() error { return e.Err }
+
+// ComparisonError is returned when a vendored file or its source can't be
+// read to compare them.
+type ComparisonError struct {
+	Path string
+	Err  error
+}
+
+func (e *ComparisonError) Error() string {
+	return fmt.Sprintf("couldn't compare %s: %s", e.Path, e.Err)
+}
+
+func (e *ComparisonError) Unwrap() error { return e.Err }
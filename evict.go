@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseAge parses a -cache-max-age like 72h or 30d. time.ParseDuration doesn't
+// do days, which are what cache ages are usually given in.
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// touchCacheEntry marks the checkout at dir as used just now, for
+// -cache-max-age, if it's in the cache.
+func touchCacheEntry(dir string) error {
+	inside, err := insideDir(dir, *cachePath)
+	if err != nil || !inside {
+		return err
+	}
+
+	now := time.Now()
+	return os.Chtimes(dir, now, now)
+}
+
+// cacheEntries returns the checkouts under the cache directory: clones, which
+// have .git in them, the directories of each module from -goproxy, archive
+// from -github-archive or -use-git-archive and file tree from -http-source,
+// which are named after their version, and the trees from -store.
+func cacheEntries(cache string) ([]string, error) {
+	var entries []string
+
+	for _, d := range checkoutDirs {
+		root := filepath.Join(cache, d)
+
+		err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == root {
+					return filepath.SkipDir
+				}
+
+				return err
+			}
+
+			if !fi.IsDir() || p == root {
+				return nil
+			}
+
+			entry := d == "vendor-verify-store" || strings.Contains(fi.Name(), "@")
+			if !entry {
+				if _, err := os.Lstat(filepath.Join(p, ".git")); err == nil {
+					entry = true
+				}
+			}
+
+			if entry {
+				entries = append(entries, p)
+				return filepath.SkipDir
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// evictCache removes the checkouts in the cache that haven't been used for
+// longer than maxAge, along with their seals, returning how many it removed.
+// Clones that another process has locked are left alone.
+func evictCache(cache string, maxAge time.Duration) (int, error) {
+	entries, err := cacheEntries(cache)
+	if err != nil {
+		return 0, err
+	}
+
+	evicted := 0
+	for _, e := range entries {
+		fi, err := os.Stat(e)
+		if err != nil {
+			return evicted, err
+		}
+
+		if time.Since(fi.ModTime()) <= maxAge {
+			continue
+		}
+
+		ok, err := evictCacheEntry(e)
+		if err != nil {
+			return evicted, err
+		}
+
+		if ok {
+			if *verbose {
+				fmt.Fprintf(output, "evicted %s, last used %s\n", e, fi.ModTime().Format(time.RFC3339))
+			}
+
+			evicted++
+		}
+	}
+
+	return evicted, nil
+}
+
+// evictCacheEntry removes the checkout at dir, unless another process has it
+// locked.
+func evictCacheEntry(dir string) (bool, error) {
+	if f, err := os.OpenFile(dir+".lock", os.O_RDWR, 0600); err == nil {
+		defer f.Close()
+
+		ok, err := tryLock(f)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	if err := removeCheckout(context.Background(), dir); err != nil {
+		return false, err
+	}
+
+	if err := os.Remove(sealPath(dir)); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileHash is a file listed with -file-manifest, relative to the vendor
+// directory with slashes, and its expected SHA-256 hash, in hex.
+type fileHash struct {
+	Path   string
+	SHA256 string
+}
+
+// readFileManifest parses a file list for -file-manifest, in the format
+// sha256sum writes: a hash and a path on each line, with the path optionally
+// marked as binary with a "*". Blank lines and lines starting with "#" are
+// ignored.
+func readFileManifest(path string) ([]fileHash, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []fileHash
+	for i, l := range strings.Split(string(d), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		// Paths can have spaces in them, so everything after the hash is one.
+		n := strings.IndexAny(l, " \t")
+		if n < 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"<sha256> <path>\"", path, i+1)
+		}
+
+		hash := strings.ToLower(l[:n])
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: %q isn't a SHA-256 hash", path, i+1, l[:n])
+		}
+
+		files = append(files, fileHash{Path: strings.TrimPrefix(strings.TrimSpace(l[n:]), "*"), SHA256: hash})
+	}
+
+	return files, nil
+}
+
+// checkFileManifest checks each file listed in the file at path against its
+// hash, in the vendor directory in tree at vendorPath, printing every one
+// that's missing or doesn't match. It reports whether there were any.
+func checkFileManifest(tree vendorTree, vendorPath, path string) (bool, error) {
+	files, err := readFileManifest(path)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(output, "# Checking %d files listed in %s\n", len(files), path)
+
+	failed := false
+	for _, f := range files {
+		d, err := tree.ReadFile(filepath.Join(vendorPath, filepath.FromSlash(f.Path)))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return false, err
+			}
+
+			fmt.Fprintf(output, "[!] File %s isn't in the vendor directory\n", f.Path)
+			failed = true
+			continue
+		}
+
+		sum := sha256.Sum256(d)
+		if actual := hex.EncodeToString(sum[:]); actual != f.SHA256 {
+			fmt.Fprintf(output, "[!] File %s has SHA-256 %s, expected %s\n", f.Path, actual, f.SHA256)
+			failed = true
+		} else if *verbose {
+			fmt.Fprintf(output, "ok %s\n", f.Path)
+		}
+	}
+
+	return failed, nil
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fileFilter decides which files take part in the comparison.
+type fileFilter struct {
+	ignore []ignoreRule
+	// packages, if set, are the import paths of the only packages whose files
+	// are compared, as chosen by -tainted-by.
+	packages map[string]bool
+	// excludeDirs are the directories given with -exclude-dir, relative to the
+	// vendor directory.
+	excludeDirs []string
+	// platform, if set, is the build context for -goos, -goarch and
+	// -build-tags, which files have to be built for to be compared.
+	platform *build.Context
+	// vendorTool is the tool that made the vendor directory (godep or gomod),
+	// which decides what it should have copied.
+	vendorTool string
+	// attributes memoises the export-ignore patterns of each .gitattributes
+	// file, keyed by the directory it's in.
+	attributes map[string][]string
+}
+
+// newFileFilter creates a fileFilter using the patterns in the ignore file at
+// ignorePath, if it exists.
+func newFileFilter(ignorePath string) (*fileFilter, error) {
+	rules, err := readIgnoreFile(ignorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileFilter{ignore: rules, attributes: make(map[string][]string)}, nil
+}
+
+// excluded returns the reason the file or directory at relativePath in the
+// repository called name should be left out of the comparison, or an empty
+// string if it shouldn't be. root is the directory of the source checkout,
+// which is only used for files.
+func (f *fileFilter) excluded(name, root, relativePath string, isDir bool) (string, error) {
+	base := path.Base(relativePath)
+	native := *includeNative && !isDir && isNativeSource(base)
+
+	if f.inExcludedDir(path.Join(name, relativePath)) {
+		return "-exclude-dir", nil
+	}
+
+	if f.packages != nil && !isDir && !f.packages[path.Join(name, path.Dir(relativePath))] {
+		return "doesn't import " + *taintedBy, nil
+	}
+
+	// go mod vendor never copies the go.mod and go.sum files of dependencies,
+	// while godep copies them like any other file.
+	if f.vendorTool == "gomod" && !isDir && (base == "go.mod" || base == "go.sum") {
+		return "not vendored by go mod vendor", nil
+	}
+
+	if *licensesOnly && !isDir && !isLicenseFile(base) && !native {
+		return "not a license file", nil
+	}
+
+	if !*includeTests {
+		if isDir && base == "testdata" {
+			return "test data", nil
+		}
+
+		if !isDir && strings.HasSuffix(base, "_test.go") {
+			return "test file", nil
+		}
+	}
+
+	if isDir {
+		// With -include-native, ignored directories are still walked so that
+		// native source files in them are found, and the rest of their files
+		// are left out one by one.
+		if !*includeNative && matchIgnoreRules(f.ignore, path.Join(name, relativePath), true) {
+			return ".vendorverifyignore", nil
+		}
+	} else if !native && (matchIgnoreRules(f.ignore, path.Join(name, relativePath), false) || (*includeNative && f.ignoredAbove(name, relativePath))) {
+		return ".vendorverifyignore", nil
+	}
+
+	if f.platform != nil && !isDir && root != "" && !builtFor(f.platform, root, relativePath) {
+		return "not built for " + describePlatform(f.platform), nil
+	}
+
+	if !isDir {
+		ignored, err := isExportIgnored(root, relativePath, f.attributes)
+		if err != nil {
+			return "", err
+		}
+
+		if ignored {
+			return "export-ignore", nil
+		}
+	}
+
+	return "", nil
+}
+
+// missingFiles returns the files directly in the package directory dir
+// (relative to the repository root) of co that aren't in seen, leaving out
+// those that wouldn't have been compared anyway. Subdirectories are other
+// packages, so they aren't looked at.
+func (f *fileFilter) missingFiles(name string, co *checkout, dir string, seen map[string]bool) ([]string, error) {
+	inner, ok := co.relative(dir)
+	if !ok {
+		return nil, nil
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(co.Dir, filepath.FromSlash(inner)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var missing []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		relativePath := path.Join(dir, e.Name())
+		if seen[relativePath] {
+			continue
+		}
+
+		reason, err := f.excluded(name, co.Dir, relativePath, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if reason == "" && !f.excludedDir(name, dir) {
+			missing = append(missing, relativePath)
+		}
+	}
+
+	return missing, nil
+}
+
+// inExcludedDir reports whether p, relative to the vendor directory, is one
+// of the directories given with -exclude-dir or inside one.
+func (f *fileFilter) inExcludedDir(p string) bool {
+	for _, d := range f.excludeDirs {
+		if p == d || strings.HasPrefix(p, d+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dirList is a list of directories, as given with -exclude-dir.
+type dirList []string
+
+func (l *dirList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *dirList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// relativeTo returns the directories in l relative to the vendor directory at
+// vendorPath, which they may or may not start with.
+func (l dirList) relativeTo(vendorPath string) []string {
+	prefix := path.Clean(filepath.ToSlash(vendorPath)) + "/"
+
+	dirs := make([]string, len(l))
+	for i, d := range l {
+		d = path.Clean(filepath.ToSlash(d))
+		dirs[i] = strings.Trim(strings.TrimPrefix(d, prefix), "/")
+	}
+
+	return dirs
+}
+
+// ignoredAbove reports whether a directory above relativePath matches the
+// ignore rules.
+func (f *fileFilter) ignoredAbove(name, relativePath string) bool {
+	for d := path.Dir(relativePath); d != "." && d != "/"; d = path.Dir(d) {
+		if matchIgnoreRules(f.ignore, path.Join(name, d), true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nativeSourceExtensions are the extensions of the non-Go files the go command
+// builds into packages, as listed in "go help filetype", plus .syso objects.
+var nativeSourceExtensions = map[string]bool{
+	".c": true, ".cc": true, ".cpp": true, ".cxx": true, ".m": true,
+	".h": true, ".hh": true, ".hpp": true, ".hxx": true,
+	".f": true, ".F": true, ".for": true, ".f90": true,
+	".s": true, ".S": true, ".sx": true,
+	".swig": true, ".swigcxx": true, ".syso": true,
+}
+
+// isNativeSource reports whether the file called name is native (C, assembly
+// and so on) code that can be built into a Go package.
+func isNativeSource(name string) bool {
+	return nativeSourceExtensions[path.Ext(name)]
+}
+
+// excludedDir reports whether dir, or any directory above it, is excluded.
+func (f *fileFilter) excludedDir(name, dir string) bool {
+	for d := dir; d != "." && d != "" && d != "/"; d = path.Dir(d) {
+		if reason, _ := f.excluded(name, "", d, true); reason != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// licenseFilePrefixes are the lower case names, ignoring extensions and
+// suffixes like "-MIT", of files that hold license terms.
+var licenseFilePrefixes = []string{"license", "licence", "unlicense", "copying", "copyright", "notice"}
+
+// isLicenseFile reports whether the file called name holds license terms.
+func isLicenseFile(name string) bool {
+	name = strings.ToLower(name)
+
+	for _, p := range licenseFilePrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignoreRule is one pattern from a .vendorverifyignore file, which uses the
+// same syntax as .gitignore.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// readIgnoreFile parses a file of gitignore-style patterns. A missing file
+// has no patterns.
+func readIgnoreFile(p string) ([]ignoreRule, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), " ")
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		var r ignoreRule
+
+		if strings.HasPrefix(l, "!") {
+			r.negate, l = true, l[1:]
+		} else if strings.HasPrefix(l, `\`) {
+			l = l[1:]
+		}
+
+		if strings.HasSuffix(l, "/") {
+			r.dirOnly, l = true, strings.TrimSuffix(l, "/")
+		}
+
+		// As with .gitignore, a pattern with a slash in it is relative to the
+		// top of the tree, and one without matches at any depth.
+		if !strings.Contains(l, "/") {
+			l = "**/" + l
+		}
+
+		r.re = regexp.MustCompile(globRegexp(strings.TrimPrefix(l, "/")))
+
+		rules = append(rules, r)
+	}
+
+	return rules, sc.Err()
+}
+
+// globRegexp translates a gitignore glob into an anchored regular
+// expression. "*" and "?" don't match slashes, while "**" matches any number
+// of directories.
+func globRegexp(glob string) string {
+	var b bytes.Buffer
+
+	b.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if j := strings.IndexByte(glob[i:], ']'); j > 1 {
+				class := glob[i+1 : i+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += j
+			} else {
+				b.WriteString(`\[`)
+			}
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+
+	return b.String()
+}
+
+// matchIgnoreRules reports whether p is ignored by rules. As with .gitignore,
+// the last matching rule wins, and a negated rule re-includes a path.
+func matchIgnoreRules(rules []ignoreRule, p string, isDir bool) bool {
+	ignored := false
+
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+
+		if r.re.MatchString(p) {
+			ignored = !r.negate
+		}
+	}
+
+	return ignored
+}
+
+// readExportIgnore returns the patterns marked with the export-ignore
+// attribute in the .gitattributes file of dir, if there is one.
+func readExportIgnore(dir string) ([]string, error) {
+	d, err := ioutil.ReadFile(filepath.Join(dir, ".gitattributes"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var patterns []string
+	for _, l := range strings.Split(string(d), "\n") {
+		fields := strings.Fields(l)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		for _, attr := range fields[1:] {
+			if attr == "export-ignore" || attr == "export-ignore=true" {
+				patterns = append(patterns, fields[0])
+			}
+		}
+	}
+
+	return patterns, nil
+}
+
+// matchAttributePattern reports whether a .gitattributes pattern matches
+// relativePath (relative to the directory holding the .gitattributes file) or
+// any of its parent directories.
+func matchAttributePattern(pattern, relativePath string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	parts := strings.Split(relativePath, "/")
+	for i := range parts {
+		if anchored {
+			if ok, _ := filepath.Match(pattern, strings.Join(parts[:i+1], "/")); ok {
+				return true
+			}
+		} else {
+			if ok, _ := filepath.Match(pattern, parts[i]); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isExportIgnored reports whether relativePath is excluded by export-ignore
+// attributes in any .gitattributes file between root and the file itself.
+// Parsed attribute files are memoised in cache, keyed by directory.
+func isExportIgnored(root, relativePath string, cache map[string][]string) (bool, error) {
+	parts := strings.Split(relativePath, "/")
+
+	for i := 0; i < len(parts); i++ {
+		dir := filepath.Join(root, filepath.Join(parts[:i]...))
+
+		patterns, ok := cache[dir]
+		if !ok {
+			p, err := readExportIgnore(dir)
+			if err != nil {
+				return false, err
+			}
+
+			patterns = p
+			cache[dir] = p
+		}
+
+		for _, pattern := range patterns {
+			if matchAttributePattern(pattern, strings.Join(parts[i:], "/")) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
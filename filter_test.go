@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.go", "a.go", true},
+		{"*.go", "dir/a.go", false},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+		{"**/a.go", "a.go", true},
+		{"**/a.go", "x/y/a.go", true},
+		{"x/**", "x/y/a.go", true},
+		{"x/**", "x", false},
+		{"x/**/a.go", "x/a.go", true},
+		{"x/**/a.go", "x/y/z/a.go", true},
+		{"x/**/a.go", "y/x/a.go", false},
+		{"x**", "xy/z", true},
+		{"[ab].go", "b.go", true},
+		{"[!ab].go", "b.go", false},
+		{"[!ab].go", "c.go", true},
+		{`\*.go`, "*.go", true},
+		{`\*.go`, "a.go", false},
+		{"a.go", "a_go", false},
+		{"a.go", "xa.go", false},
+		{"a.go", "a.gox", false},
+	}
+
+	for _, tt := range tests {
+		re := regexp.MustCompile(globRegexp(tt.glob))
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v (regexp %s)", tt.glob, tt.path, got, tt.want, re)
+		}
+	}
+}
+
+// ignoreRules parses the lines of a .vendorverifyignore file.
+func ignoreRules(t *testing.T, lines string) []ignoreRule {
+	f, err := ioutil.TempFile("", "godep-verify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(lines); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := readIgnoreFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rules
+}
+
+func TestMatchIgnoreRules(t *testing.T) {
+	tests := []struct {
+		rules string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"*.pb.go\n", "a.pb.go", false, true},
+		{"*.pb.go\n", "x/y/a.pb.go", false, true},
+		{"*.pb.go\n", "a.go", false, false},
+		{"# *.go\n\n", "a.go", false, false},
+		{`\#a.go` + "\n", "#a.go", false, true},
+
+		// A pattern with a slash in it is anchored to the top of the tree.
+		{"/a.go\n", "a.go", false, true},
+		{"/a.go\n", "x/a.go", false, false},
+		{"x/a.go\n", "x/a.go", false, true},
+		{"x/a.go\n", "y/x/a.go", false, false},
+		{"x/**/a.go\n", "x/y/z/a.go", false, true},
+
+		// The last matching rule wins.
+		{"*.go\n!keep.go\n", "keep.go", false, false},
+		{"*.go\n!keep.go\n", "x/drop.go", false, true},
+		{"!keep.go\n*.go\n", "keep.go", false, true},
+		{"\\!a.go\n", "!a.go", false, true},
+
+		// A trailing slash only matches directories.
+		{"build/\n", "build", true, true},
+		{"build/\n", "build", false, false},
+		{"build/\n", "x/build", true, true},
+		{"build\n", "build", false, true},
+		{"build/ \n", "build", true, true},
+	}
+
+	for _, tt := range tests {
+		if got := matchIgnoreRules(ignoreRules(t, tt.rules), tt.path, tt.isDir); got != tt.want {
+			t.Errorf("rules %q matching %q (directory: %v) = %v, want %v", tt.rules, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestReadIgnoreFileMissing(t *testing.T) {
+	rules, err := readIgnoreFile(filepath.Join(os.TempDir(), "godep-verify-test-missing", ".vendorverifyignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 0 {
+		t.Errorf("a missing file has %d rules", len(rules))
+	}
+}
+
+func TestMatchAttributePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/a.md", true},
+		{"testdata", "testdata/a.go", true},
+		{"testdata", "x/testdata/a.go", true},
+		{"testdata/", "x/testdata/a.go", true},
+		{"/docs", "docs/a.md", true},
+		{"/docs", "x/docs/a.md", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/x/a.md", false},
+		{"docs/x", "docs/x/a.md", true},
+		{"docs/*.md", "x/docs/a.md", false},
+		{"a.go", "a.gox", false},
+		{"a.go", "xa.go", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchAttributePattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsExportIgnored(t *testing.T) {
+	root, err := ioutil.TempDir("", "godep-verify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		".gitattributes":     "# *.go export-ignore\n*.md export-ignore\n/examples export-ignore\nkeep.txt -export-ignore\nci.yml export-ignore=true\n",
+		"sub/.gitattributes": "*.txt export-ignore\n/gen export-ignore\n",
+	}
+	for name, d := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(d), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"a.go", false},
+		{"README.md", true},
+		{"sub/x/README.md", true},
+		{"examples/a.go", true},
+		{"sub/examples/a.go", false},
+		{"keep.txt", false},
+		{"ci.yml", true},
+		{"sub/a.txt", true},
+		{"a.txt", false},
+		{"sub/gen/a.go", true},
+		{"gen/a.go", false},
+	}
+
+	cache := make(map[string][]string)
+	for _, tt := range tests {
+		got, err := isExportIgnored(root, tt.path, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tt.want {
+			t.Errorf("isExportIgnored(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// applyFix carries out one change to the vendor directory for -fix, or with
+// -yes not given, only describes what it would do. doing and would describe
+// the change in each of those cases, like "Removing x" and "remove x".
+func applyFix(doing, would string, fn func() error) error {
+	if !*yes {
+		fmt.Fprintf(output, "[+] Would %s (dry run, use -yes to apply)\n", would)
+		return nil
+	}
+
+	fmt.Fprintf(output, "[+] %s\n", doing)
+
+	return fn()
+}
+
+// copyFile copies the file at from to to, creating to's directory if needed
+// and keeping from's permissions.
+func copyFile(from, to string) error {
+	st, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+
+	d, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(to, d, st.Mode().Perm())
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolveGitBin settles which git executable to use: the -git-bin flag, then
+// $GODEP_VERIFY_GIT, then git from the PATH. It fails if the executable
+// can't be found.
+func resolveGitBin(ctx context.Context) error {
+	if *gitBin == "" {
+		*gitBin = os.Getenv("GODEP_VERIFY_GIT")
+	}
+	if *gitBin == "" {
+		*gitBin = "git"
+	}
+
+	p, err := exec.LookPath(*gitBin)
+	if err != nil {
+		return fmt.Errorf("couldn't find git executable %q: %s", *gitBin, err)
+	}
+	*gitBin = p
+
+	if *verbose {
+		version, err := exec.CommandContext(ctx, *gitBin, "--version").Output()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(output, "using %s (%s)\n", *gitBin, strings.TrimSpace(string(version)))
+	}
+
+	return nil
+}
+
+// gitConfig is a list of "key=value" settings, as given with -git-config.
+type gitConfig []string
+
+func (c *gitConfig) String() string {
+	return strings.Join(*c, ", ")
+}
+
+// Set adds a setting, which must have a dotted key, like git's own.
+func (c *gitConfig) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i == -1 {
+		return fmt.Errorf("%q isn't of the form key=value", s)
+	}
+
+	if key := s[:i]; !strings.Contains(key, ".") || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("%q isn't a valid git config key", key)
+	}
+
+	*c = append(*c, s)
+	return nil
+}
+
+// gitConfigSettings are passed to every git command.
+var gitConfigSettings gitConfig
+
+// tokenHelper is the credential helper used when $GODEP_VERIFY_TOKEN is set.
+// It reads the token from the environment when git asks for it, so that it
+// never appears in a command line.
+const tokenHelper = `!f() { test "$1" = get || return 0; echo "username=${GODEP_VERIFY_TOKEN_USER:-x-access-token}"; echo "password=$GODEP_VERIFY_TOKEN"; }; f`
+
+// gitCommand returns a command running git with args, after the settings from
+// -git-config and the credential helpers from -credential-helper and
+// $GODEP_VERIFY_TOKEN. Commands are run with Output even when there's nothing
+// to read, so that an *exec.ExitError carries what git printed to stderr.
+func gitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	var all []string
+	for _, s := range gitConfigSettings {
+		all = append(all, "-c", s)
+	}
+
+	if *credentialHelper != "" {
+		all = append(all, "-c", "credential.helper="+*credentialHelper)
+	}
+
+	if os.Getenv("GODEP_VERIFY_TOKEN") != "" {
+		all = append(all, "-c", "credential.helper="+tokenHelper)
+	}
+
+	return exec.CommandContext(ctx, *gitBin, append(all, args...)...)
+}
+
+// secretConfigKey matches the keys of git settings whose values can hold
+// credentials.
+var secretConfigKey = regexp.MustCompile(`(?i)^(http\..*extraheader|credential\..*helper)=`)
+
+// commandLine joins up args for echoing with -v, with anything that might be
+// a secret hidden: passwords in URLs, and the values of settings like
+// http.extraHeader and credential.helper.
+func commandLine(args []string) string {
+	shown := make([]string, len(args))
+	for i, a := range args {
+		if m := secretConfigKey.FindString(a); m != "" && i > 0 && args[i-1] == "-c" {
+			a = m + "***"
+		} else {
+			a = hidePassword(a)
+		}
+
+		shown[i] = a
+	}
+
+	return strings.Join(shown, " ")
+}
+
+// hidePassword returns s with the password hidden if it's a URL with one.
+func hidePassword(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+
+	u.User = url.UserPassword(u.User.Username(), "***")
+	return u.String()
+}
+
+// remoteLimiter limits how often clones and fetches are started, as set by
+// -rate-limit.
+var remoteLimiter *rateLimiter
+
+// gitClone clones repo into dir. If since isn't empty, only the history after
+// that date is fetched, and if depth isn't 0, only that many commits of each
+// branch.
+func gitClone(ctx context.Context, dir, repo, since string, depth int) error {
+	if err := remoteLimiter.wait(ctx); err != nil {
+		return err
+	}
+
+	args := []string{"clone"}
+	if since != "" {
+		args = append(args, "--shallow-since="+since)
+	}
+	if depth > 0 {
+		// The pinned commit needn't be on the default branch.
+		args = append(args, fmt.Sprintf("--depth=%d", depth), "--no-single-branch")
+	}
+
+	cmd := gitCommand(ctx, append(args, "--", repo, dir)...)
+	if *verbose {
+		fmt.Fprintf(output, "$ %s\n", commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+// removeCheckout removes the checkout at dir. A worktree of a configured
+// LocalRepository is also pruned from that repository's list of worktrees,
+// or adding one at dir again would fail.
+func removeCheckout(ctx context.Context, dir string) error {
+	// A worktree's .git is a file naming its directory in the repository's
+	// .git/worktrees, which is there even if it was cut off being made.
+	common := ""
+	if d, err := ioutil.ReadFile(filepath.Join(dir, ".git")); err == nil && bytes.HasPrefix(d, []byte("gitdir: ")) {
+		gitDir := filepath.FromSlash(strings.TrimSpace(strings.TrimPrefix(string(d), "gitdir: ")))
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(dir, gitDir)
+		}
+
+		common = filepath.Dir(filepath.Dir(gitDir))
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if common == "" {
+		return nil
+	}
+
+	cmd := gitCommand(ctx, "worktree", "prune")
+	cmd.Dir = common
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+// gitWorktreeAdd creates a new worktree of the repository at repo in dir, with
+// a detached HEAD.
+func gitWorktreeAdd(ctx context.Context, repo, dir string) error {
+	cmd := gitCommand(ctx, "worktree", "add", "--detach", dir)
+	cmd.Dir = repo
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+// gitHasCommit reports whether rev is a commit in the repository at dir.
+func gitHasCommit(ctx context.Context, dir, rev string) bool {
+	cmd := gitCommand(ctx, "cat-file", "-e", rev+"^{commit}")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Run() == nil
+}
+
+func gitFetch(ctx context.Context, dir string) error {
+	if err := remoteLimiter.wait(ctx); err != nil {
+		return err
+	}
+
+	cmd := gitCommand(ctx, "fetch", "origin")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+// gitFetchFrom fetches every branch and tag of the repository at url into the
+// clone at dir, without touching its remotes.
+func gitFetchFrom(ctx context.Context, dir, url string) error {
+	if err := remoteLimiter.wait(ctx); err != nil {
+		return err
+	}
+
+	cmd := gitCommand(ctx, "fetch", "--tags", url, "+refs/heads/*:refs/remotes/fallback/*")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+// pullRefRegexp matches revisions naming the head of a GitHub pull request,
+// like pull/123/head.
+var pullRefRegexp = regexp.MustCompile(`^pull/[0-9]+/head$`)
+
+// isPullRef reports whether rev names the head of a pull request, which can
+// move, rather than a fixed commit.
+func isPullRef(rev string) bool {
+	return pullRefRegexp.MatchString(rev)
+}
+
+// gitFetchPullRef fetches the pull request ref rev, like pull/123/head, from
+// origin into refs/pull/123/head of the clone at dir, where checkout finds it.
+// A clone doesn't fetch pull requests by default.
+func gitFetchPullRef(ctx context.Context, dir, rev string) error {
+	if err := remoteLimiter.wait(ctx); err != nil {
+		return err
+	}
+
+	cmd := gitCommand(ctx, "fetch", "origin", "+refs/"+rev+":refs/"+rev)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+
+	_, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && bytes.Contains(ee.Stderr, []byte("couldn't find remote ref")) {
+		return fmt.Errorf("origin has no refs/%s; either the pull request doesn't exist or its host doesn't expose pull request refs", rev)
+	}
+
+	return err
+}
+
+// gitDeepen fetches another n commits of history into the shallow clone at
+// dir.
+func gitDeepen(ctx context.Context, dir string, n int) error {
+	if err := remoteLimiter.wait(ctx); err != nil {
+		return err
+	}
+
+	cmd := gitCommand(ctx, "fetch", fmt.Sprintf("--deepen=%d", n), "origin")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+const (
+	// maxDeepens is how many times deepenFor deepens a shallow clone before
+	// it gives up and fetches the rest of its history.
+	maxDeepens = 4
+	// defaultDeepen is how many commits a clone that wasn't made with -depth
+	// is deepened by at first.
+	defaultDeepen = 100
+)
+
+// deepenFor deepens the shallow clone at dir until it has rev, by step commits
+// and then twice as many each time, and fetches the rest of its history if it
+// still doesn't after maxDeepens tries. Old commits are rarely pinned, so
+// this usually fetches much less than all of it.
+func deepenFor(ctx context.Context, dir, rev string, step int) error {
+	for i := 0; i < maxDeepens; i++ {
+		if err := gitDeepen(ctx, dir, step); err != nil {
+			return err
+		}
+
+		if gitHasCommit(ctx, dir, rev) {
+			return nil
+		}
+
+		// Once there's nothing left to fetch, the clone isn't shallow.
+		if _, err := os.Stat(filepath.Join(dir, ".git", "shallow")); os.IsNotExist(err) {
+			return nil
+		}
+
+		step *= 2
+	}
+
+	return gitUnshallow(ctx, dir)
+}
+
+// gitUnshallow fetches the rest of the history of a shallow clone at dir.
+func gitUnshallow(ctx context.Context, dir string) error {
+	if err := remoteLimiter.wait(ctx); err != nil {
+		return err
+	}
+
+	cmd := gitCommand(ctx, "fetch", "--unshallow", "origin")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+// cloneWithFallback clones repo into dir, trying each of the fallbacks in turn
+// if that fails. Any of them will do, as the commits are checked out by hash.
+// since and depth are passed on to gitClone.
+func cloneWithFallback(ctx context.Context, dir, repo, since string, depth int, fallbacks []string) error {
+	err := gitClone(ctx, dir, repo, since, depth)
+
+	for _, f := range fallbacks {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+
+		fmt.Fprintf(output, "couldn't clone %s (%s), trying %s instead\n", repo, err, f)
+
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+
+		err = gitClone(ctx, dir, f, since, depth)
+	}
+
+	return err
+}
+
+// fetchWithFallback fetches into the clone at dir from origin, and if that
+// fails, from each of the fallbacks in turn.
+func fetchWithFallback(ctx context.Context, dir string, fallbacks []string) error {
+	err := gitFetch(ctx, dir)
+
+	for _, f := range fallbacks {
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+
+		fmt.Fprintf(output, "couldn't fetch into %s (%s), trying %s instead\n", dir, err, f)
+
+		err = gitFetchFrom(ctx, dir, f)
+	}
+
+	return err
+}
+
+// gitRemoteURL returns the URL that the clone at dir fetches origin from, as
+// rewritten by any url.<base>.insteadOf settings.
+func gitRemoteURL(ctx context.Context, dir string) (string, error) {
+	cmd := gitCommand(ctx, "ls-remote", "--get-url", "origin")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitSetRemoteHead sets origin/HEAD in the clone at dir to origin's default
+// branch, as clone would have.
+func gitSetRemoteHead(ctx context.Context, dir string) error {
+	cmd := gitCommand(ctx, "remote", "set-head", "origin", "--auto")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+// isPartialClone reports whether dir is a clone that was cut off before it
+// checked anything out, e.g. by the machine going down, so that it has a .git
+// directory with some of the repository in it but no HEAD commit yet.
+func isPartialClone(ctx context.Context, dir string) bool {
+	st, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil && st.IsDir() && !gitHasCommit(ctx, dir, "HEAD")
+}
+
+// gitCheckout checks out rev in dir. The -- after it keeps it from being
+// taken as a path, and a rev that looks like an option is refused.
+func gitCheckout(ctx context.Context, dir, rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("%q isn't a revision", rev)
+	}
+
+	cmd := gitCommand(ctx, "checkout", rev, "--")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	_, err := cmd.Output()
+	return err
+}
+
+func gitHead(ctx context.Context, dir string) ([]byte, error) {
+	cmd := gitCommand(ctx, "rev-parse", "HEAD")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+// gitDescribeTag returns the annotated tag that points at rev, or an empty
+// string if there isn't one.
+func gitDescribeTag(ctx context.Context, dir, rev string) (string, error) {
+	cmd := gitCommand(ctx, "describe", "--exact-match", rev)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+
+	out, err := cmd.Output()
+	if _, ok := err.(*exec.ExitError); ok {
+		return "", nil
+	}
+
+	return strings.TrimSpace(string(out)), err
+}
+
+// gitIsAncestor reports whether the commit a is an ancestor of b.
+func gitIsAncestor(ctx context.Context, dir, a, b string) (bool, error) {
+	cmd := gitCommand(ctx, "merge-base", "--is-ancestor", a, b)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+
+	_, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && !bytes.Contains(ee.Stderr, []byte("fatal")) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// gitCommitTime returns the commit time of rev.
+func gitCommitTime(ctx context.Context, dir, rev string) (time.Time, error) {
+	cmd := gitCommand(ctx, "show", "-s", "--format=%ct", rev)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(sec, 0), nil
+}
+
+// gitChangedFiles lists the files changed by the commits up to rev that were
+// made after since, one per line.
+func gitChangedFiles(ctx context.Context, dir, rev string, since time.Time) ([]byte, error) {
+	cmd := gitCommand(ctx, "log", "--since="+since.Format(time.RFC3339), "--name-only", "--format=", rev, "--")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+// gitTreeHash returns the hash of the tree of the commit rev.
+func gitTreeHash(ctx context.Context, dir, rev string) ([]byte, error) {
+	cmd := gitCommand(ctx, "rev-parse", rev+"^{tree}")
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+// gitCommitTrees lists up to max commits reachable from any ref, newest
+// first, one per line as "<commit> <tree>".
+func gitCommitTrees(ctx context.Context, dir string, max int) ([]byte, error) {
+	cmd := gitCommand(ctx, "log", "--all", "--format=%H %T", "-n", strconv.Itoa(max))
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+// gitListTree lists every file in the tree of rev, one per line as
+// "<mode> <type> <hash>\t<path>".
+func gitListTree(ctx context.Context, dir, rev string) ([]byte, error) {
+	cmd := gitCommand(ctx, "ls-tree", "-r", "--full-tree", rev)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+func gitCountCommits(ctx context.Context, dir, from, to string) ([]byte, error) {
+	cmd := gitCommand(ctx, "rev-list", "--count", from+".."+to)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+// gitLog lists the commits between from and to that touch path, one per line
+// as "<hash> <subject>".
+func gitLog(ctx context.Context, dir, from, to, path string) ([]byte, error) {
+	cmd := gitCommand(ctx, "log", "--oneline", from+".."+to, "--", path)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+func gitShow(ctx context.Context, ref, path string) ([]byte, error) {
+	cmd := gitCommand(ctx, "show", ref+":"+path)
+	if *verbose {
+		fmt.Fprintf(output, "$ %s\n", commandLine(cmd.Args))
+	}
+	return cmd.Output()
+}
+
+// gitArchive streams the tarball git archive makes of rev in the repository at
+// dir to fn, so that export-ignore and the like are applied as they would be
+// for a release.
+func gitArchive(ctx context.Context, dir, rev string, fn func(r io.Reader) error) error {
+	cmd := gitCommand(ctx, "archive", "--format=tar", rev)
+	cmd.Dir = dir
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, commandLine(cmd.Args))
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	fnErr := fn(out)
+	// Whatever fn didn't read has to be drained for git to finish.
+	io.Copy(ioutil.Discard, out)
+
+	if err := cmd.Wait(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			ee.Stderr = stderr.Bytes()
+		}
+
+		return err
+	}
+
+	return fnErr
+}
+
+// gitDiffFiles diffs the files a and b with git diff, using algorithm. git
+// fails when they differ, which isn't an error here as long as it printed the
+// diff.
+func gitDiffFiles(ctx context.Context, a, b, algorithm string) ([]byte, error) {
+	cmd := gitCommand(ctx, "diff", "--no-index", "--no-color", "--text", "-U3", "--diff-algorithm="+algorithm, "--", a, b)
+	if *verbose {
+		fmt.Fprintf(output, "$ %s\n", commandLine(cmd.Args))
+	}
+
+	out, err := cmd.Output()
+	if _, ok := err.(*exec.ExitError); ok && len(out) > 0 {
+		return out, nil
+	}
+
+	return out, err
+}
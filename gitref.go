@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// refPath returns the path to give git for p in a ref:path, in the repository
+// the working directory is in. git takes paths starting with ./ as relative
+// to the working directory, rather than the top of the repository.
+func refPath(p string) (string, error) {
+	if filepath.IsAbs(p) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+
+		if p, err = filepath.Rel(wd, p); err != nil {
+			return "", err
+		}
+	}
+
+	return "./" + filepath.ToSlash(filepath.Clean(p)), nil
+}
+
+// loadManifestAt reads the manifest at path as it was in the commit ref, for
+// -manifest-at.
+func loadManifestAt(ctx context.Context, ref, path, format string) (Manifest, error) {
+	p, err := refPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := gitShow(ctx, ref, p)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read manifest at %s: %s", ref, gitErrorText(err))
+	}
+
+	m, err := ParseManifest(d, ref+":"+path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// A workspace's modules would be read from the working tree instead.
+	if _, ok := m.(*goWork); ok {
+		return nil, fmt.Errorf("-manifest-at can't be used with a go.work, as its modules' manifests would come from the working tree")
+	}
+
+	return m, nil
+}
+
+// readGitTree reads the vendor directory at p as it was in the commit ref,
+// for -vendor-at, with git archive. It stands in for the directory at p.
+// git archive only takes a ref:path from the top of the repository.
+func readGitTree(ctx context.Context, ref, p string) (*archiveTree, error) {
+	top, err := gitTopLevel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find the repository the working directory is in: %s", gitErrorText(err))
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return nil, err
+	}
+
+	var files map[string][]byte
+	if err := gitArchive(ctx, top, ref+":"+filepath.ToSlash(rel), func(r io.Reader) error {
+		files, err = readTarFiles(r)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("couldn't read %s at %s: %s", p, ref, gitErrorText(err))
+	}
+
+	return newArchiveTree(p, files), nil
+}
+
+// gitTopLevel returns the top directory of the repository the working
+// directory is in.
+func gitTopLevel(ctx context.Context) (string, error) {
+	cmd := gitCommand(ctx, "rev-parse", "--show-toplevel")
+	if *verbose {
+		fmt.Fprintf(output, "$ %s\n", commandLine(cmd.Args))
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.FromSlash(strings.TrimSpace(string(out))), nil
+}
+
+// gitErrorText describes err with what git printed, if it has it.
+func gitErrorText(err error) string {
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return strings.TrimSpace(string(ee.Stderr))
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// treeFiles returns the regular files under root in tree, relative to it with
+// slashes.
+func treeFiles(tree vendorTree, root string) (map[string]bool, error) {
+	files := make(map[string]bool)
+
+	err := tree.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+
+	return files, err
+}
+
+// checkGolden compares the vendor directory in tree at vendorPath with the
+// golden copy of it at goldenPath, a directory or an archive like those -vendor
+// takes, printing every file that was changed, added or removed since the
+// golden copy was taken. It reports whether there were any.
+func checkGolden(tree vendorTree, vendorPath, goldenPath string) (bool, error) {
+	golden, err := openVendorTree(goldenPath)
+	if err != nil {
+		return false, err
+	}
+
+	want, err := treeFiles(golden, goldenPath)
+	if err != nil {
+		return false, fmt.Errorf("couldn't read the golden copy: %s", err)
+	}
+
+	have, err := treeFiles(tree, vendorPath)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(output, "# Comparing %d files with the golden copy in %s\n", len(want), goldenPath)
+
+	var names []string
+	for name := range want {
+		names = append(names, name)
+	}
+	for name := range have {
+		if !want[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	failed := false
+	for _, name := range names {
+		switch {
+		case !have[name]:
+			fmt.Fprintf(output, "[!] File %s was removed since the golden copy\n", name)
+			failed = true
+			continue
+		case !want[name]:
+			fmt.Fprintf(output, "[!] File %s was added since the golden copy\n", name)
+			failed = true
+			continue
+		}
+
+		d1, err := golden.ReadFile(filepath.Join(goldenPath, filepath.FromSlash(name)))
+		if err != nil {
+			return false, err
+		}
+
+		d2, err := tree.ReadFile(filepath.Join(vendorPath, filepath.FromSlash(name)))
+		if err != nil {
+			return false, err
+		}
+
+		if bytes.Equal(d1, d2) {
+			if *verbose {
+				fmt.Fprintf(output, "ok %s\n", name)
+			}
+			continue
+		}
+
+		failed = true
+		if lines := describeLines(changedLines(splitLines(string(d1)), splitLines(string(d2)))); lines != "" {
+			fmt.Fprintf(output, "[!] File %s changed since the golden copy, %s\n", name, lines)
+		} else {
+			fmt.Fprintf(output, "[!] File %s changed since the golden copy\n", name)
+		}
+	}
+
+	return failed, nil
+}
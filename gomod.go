@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// goMod is the subset of a go.mod file that we care about. go.work files have
+// the same syntax, so they're read into it too, with Use set instead of
+// Module.
+type goMod struct {
+	Module  string
+	Go      string
+	Require []goModRequire
+	Replace []goModReplace
+	Use     []string
+}
+
+type goModRequire struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// goModReplace is a replace directive. OldVersion is empty when every version
+// of Old is replaced, and NewVersion is empty when New is a local directory.
+type goModReplace struct {
+	Old        string
+	OldVersion string
+	New        string
+	NewVersion string
+}
+
+func readGoMod(path string) (*goMod, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGoMod(d, path)
+}
+
+// parseGoMod parses the module, go, require, replace and use directives of a
+// go.mod (or go.work) file, in both their single line and block forms.
+// Everything else is ignored.
+func parseGoMod(d []byte, name string) (*goMod, error) {
+	var m goMod
+
+	block := ""
+	for i, l := range strings.Split(string(d), "\n") {
+		comment := ""
+		if n := strings.Index(l, "//"); n != -1 {
+			l, comment = l[:n], strings.TrimSpace(l[n+2:])
+		}
+
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+
+		for j, f := range fields {
+			if strings.HasPrefix(f, `"`) {
+				if s, err := strconv.Unquote(f); err == nil {
+					fields[j] = s
+				}
+			}
+		}
+
+		verb := block
+		if block == "" {
+			verb, fields = fields[0], fields[1:]
+			if len(fields) == 1 && fields[0] == "(" {
+				block = verb
+				continue
+			}
+		} else if fields[0] == ")" {
+			block = ""
+			continue
+		}
+
+		switch verb {
+		case "module":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("%s:%d: invalid module directive", name, i+1)
+			}
+			m.Module = fields[0]
+		case "go":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("%s:%d: invalid go directive", name, i+1)
+			}
+			m.Go = fields[0]
+		case "require":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s:%d: invalid require directive", name, i+1)
+			}
+			m.Require = append(m.Require, goModRequire{
+				Path:     fields[0],
+				Version:  fields[1],
+				Indirect: comment == "indirect" || strings.HasPrefix(comment, "indirect;"),
+			})
+		case "replace":
+			r, err := parseGoModReplace(fields)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", name, i+1, err)
+			}
+			m.Replace = append(m.Replace, r)
+		case "use":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("%s:%d: invalid use directive", name, i+1)
+			}
+			m.Use = append(m.Use, fields[0])
+		}
+	}
+
+	return &m, nil
+}
+
+// parseGoModReplace parses the fields of a replace directive, which look like
+// "old [version] => new [version]". It's also used for the replacement lines
+// of vendor/modules.txt, which have the same form.
+func parseGoModReplace(fields []string) (goModReplace, error) {
+	var r goModReplace
+
+	n := -1
+	for i, f := range fields {
+		if f == "=>" {
+			n = i
+		}
+	}
+
+	left, right := fields, []string(nil)
+	if n != -1 {
+		left, right = fields[:n], fields[n+1:]
+	}
+
+	if n == -1 || len(left) < 1 || len(left) > 2 || len(right) < 1 || len(right) > 2 {
+		return r, fmt.Errorf("invalid replace directive")
+	}
+
+	r.Old = left[0]
+	if len(left) == 2 {
+		r.OldVersion = left[1]
+	}
+
+	r.New = right[0]
+	if len(right) == 2 {
+		r.NewVersion = right[1]
+	}
+
+	return r, nil
+}
+
+// replacement returns the replace directive that applies to path at version,
+// if there is one. A directive for that specific version takes precedence
+// over one for all versions.
+func (m *goMod) replacement(path, version string) (goModReplace, bool) {
+	var found goModReplace
+	var ok bool
+
+	for _, r := range m.Replace {
+		if r.Old != path {
+			continue
+		}
+
+		if r.OldVersion == version {
+			return r, true
+		}
+
+		if r.OldVersion == "" {
+			found, ok = r, true
+		}
+	}
+
+	return found, ok
+}
+
+// goVersionAtLeast reports whether the go directive version v (like "1.17")
+// is at least major.minor.
+func goVersionAtLeast(v string, major, minor int) bool {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	a, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+
+	b, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+
+	return a > major || (a == major && b >= minor)
+}
+
+// goVersionKnown reports whether v is a version goVersionAtLeast can compare,
+// rather than, e.g., a development build.
+func goVersionKnown(v string) bool {
+	return goVersionAtLeast(v, 0, 0)
+}
+
+func detectGoModManifest(d []byte) bool {
+	for _, l := range strings.Split(string(d), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(l), "module ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseGoModManifest(d []byte) (Manifest, error) {
+	return parseGoMod(d, "go.mod")
+}
+
+func (m *goMod) ProjectImportPath() string {
+	return m.Module
+}
+
+// Deps returns the modules required by the go.mod file, with their versions
+// as both the revision and the comment. moduleRevs turns the revision into
+// something that can be checked out.
+func (m *goMod) Deps() []Dep {
+	deps := make([]Dep, len(m.Require))
+	for i, r := range m.Require {
+		deps[i] = Dep{ImportPath: r.Path, Rev: r.Version, Comment: r.Version}
+	}
+	return deps
+}
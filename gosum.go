@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// semverRegexp matches the versions the go command accepts as they are,
+// which for a dependency that doesn't have a go.mod is what its tags have to
+// look like.
+var semverRegexp = regexp.MustCompile(`^v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?$`)
+
+// describeRegexp matches what git describe makes of a commit after a tag,
+// which godep puts in Comment, and which looks like a semantic version with a
+// pre-release but isn't the tag's commit.
+var describeRegexp = regexp.MustCompile(`-[0-9]+-g[0-9a-f]+$`)
+
+// moduleVersion is a dependency as a module, for -emit-gosum.
+type moduleVersion struct {
+	Path    string
+	Version string
+	// Hash and GoModHash are the go.sum hashes of the module and its go.mod.
+	Hash      string
+	GoModHash string
+}
+
+// hash1 hashes files the way dirhash.Hash1 does: a SHA-256 of the SHA-256 of
+// each file and its name, in order of name. names are the paths the go
+// command gives the files, and read gets the contents of each.
+func hash1(names []string, read func(name string) ([]byte, error)) (string, error) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		if strings.Contains(name, "\n") {
+			return "", fmt.Errorf("file name %q has a newline in it", name)
+		}
+
+		d, err := read(name)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "%x  %s\n", sha256.Sum256(d), name)
+	}
+
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// moduleFiles returns the files under dir, with slashes, that the go command
+// would put in the zip file of the module there: everything but version
+// control directories, other modules in subdirectories, vendored packages,
+// and anything that isn't a regular file.
+func moduleFiles(dir string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if fi.IsDir() {
+			if rel == "." {
+				return nil
+			}
+
+			switch fi.Name() {
+			case ".bzr", ".git", ".hg", ".svn":
+				return filepath.SkipDir
+			}
+
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !fi.Mode().IsRegular() || isVendoredPackageFile(rel) {
+			return nil
+		}
+
+		files = append(files, rel)
+
+		return nil
+	})
+
+	return files, err
+}
+
+// isVendoredPackageFile reports whether the file at rel is in a package in a
+// vendor directory, as opposed to directly in it like vendor/modules.txt.
+func isVendoredPackageFile(rel string) bool {
+	i := 0
+	if strings.HasPrefix(rel, "vendor/") {
+		i = len("vendor/")
+	} else if j := strings.Index(rel, "/vendor/"); j >= 0 {
+		i = j + len("/vendor/")
+	} else {
+		return false
+	}
+
+	return strings.Contains(rel[i:], "/")
+}
+
+// checkoutModule works out the module path and version of the repository
+// checked out in co, and hashes it. The path comes from its go.mod, or is
+// root if it doesn't have one. The version is the checkout's if that's one
+// the go command would accept, and otherwise a pseudo-version for the
+// commit, which needs the checkout to be a git clone.
+func checkoutModule(ctx context.Context, root string, co *checkout) (*moduleVersion, error) {
+	m := &moduleVersion{Path: root}
+
+	goMod, err := ioutil.ReadFile(filepath.Join(co.Dir, "go.mod"))
+	switch {
+	case err == nil:
+		parsed, err := parseGoMod(goMod, filepath.Join(co.Dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed.Module != "" {
+			m.Path = parsed.Module
+		}
+	case os.IsNotExist(err):
+		goMod = []byte("module " + m.Path + "\n")
+	default:
+		return nil, err
+	}
+
+	switch {
+	case pseudoVersionRegexp.MatchString(co.Version), semverRegexp.MatchString(co.Version) && !describeRegexp.MatchString(co.Version):
+		m.Version = co.Version
+	default:
+		t, err := gitCommitTime(ctx, co.Dir, co.commit())
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get the time of %s for a pseudo-version: %s", co.commit(), err)
+		}
+
+		commit := co.commit()
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+
+		m.Version = "v0.0.0-" + t.UTC().Format("20060102150405") + "-" + commit
+	}
+
+	if incompatible(m.Path, m.Version) {
+		m.Version += "+incompatible"
+	}
+
+	files, err := moduleFiles(co.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := m.Path + "@" + m.Version + "/"
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = prefix + f
+	}
+
+	if m.Hash, err = hash1(names, func(name string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(co.Dir, filepath.FromSlash(strings.TrimPrefix(name, prefix))))
+	}); err != nil {
+		return nil, err
+	}
+
+	// The go.mod is hashed on its own, under just its name.
+	if m.GoModHash, err = hash1([]string{"go.mod"}, func(string) ([]byte, error) { return goMod, nil }); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// incompatible reports whether the module at path needs +incompatible added
+// to version: it's v2 or later, but path doesn't end in the major version, as
+// it would for a module that had a go.mod of its own at that version.
+func incompatible(path, version string) bool {
+	if strings.HasSuffix(version, "+incompatible") {
+		return false
+	}
+
+	major := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 2)[0]
+	if major == "0" || major == "1" {
+		return false
+	}
+
+	return !strings.HasSuffix(path, "/v"+major) && !(strings.HasPrefix(path, "gopkg.in/") && strings.HasSuffix(path, ".v"+major))
+}
+
+// writeGoSum writes a go.sum for modules, and a go.mod requiring them, to
+// dir. The go.mod only has a module line if project, the project's import
+// path, is known. A module at more than one version is only required at the
+// one that sorts last.
+func writeGoSum(dir, project string, modules []*moduleVersion) error {
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Path != modules[j].Path {
+			return modules[i].Path < modules[j].Path
+		}
+		return modules[i].Version < modules[j].Version
+	})
+
+	var sum, mod bytes.Buffer
+	for _, m := range modules {
+		fmt.Fprintf(&sum, "%s %s %s\n", m.Path, m.Version, m.Hash)
+		fmt.Fprintf(&sum, "%s %s/go.mod %s\n", m.Path, m.Version, m.GoModHash)
+	}
+
+	if project != "" {
+		fmt.Fprintf(&mod, "module %s\n\n", project)
+	}
+	fmt.Fprintf(&mod, "require (\n")
+	for i, m := range modules {
+		if i < len(modules)-1 && modules[i+1].Path == m.Path {
+			continue
+		}
+		fmt.Fprintf(&mod, "\t%s %s\n", m.Path, m.Version)
+	}
+	fmt.Fprintf(&mod, ")\n")
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.sum"), []byte(sum.String()), 0644); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod.String()), 0644)
+}
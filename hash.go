@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+)
+
+// hashFuncs are the algorithms -hash can choose between for comparing files.
+var hashFuncs = map[string]func(d []byte) []byte{
+	"sha256": func(d []byte) []byte { h := sha256.Sum256(d); return h[:] },
+	"sha1":   func(d []byte) []byte { h := sha1.Sum(d); return h[:] },
+	"sha512": func(d []byte) []byte { h := sha512.Sum512(d); return h[:] },
+	"xxhash": func(d []byte) []byte {
+		h := make([]byte, 8)
+		binary.BigEndian.PutUint64(h, xxhash64(d))
+		return h
+	},
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 computes the 64-bit xxHash (XXH64) of d with a seed of zero. It's
+// much faster than the cryptographic hashes, but only detects accidental
+// changes.
+func xxhash64(d []byte) uint64 {
+	n := len(d)
+
+	var h uint64
+	if n >= 32 {
+		p1, p2 := xxPrime1, xxPrime2
+		v1 := p1 + p2
+		v2 := p2
+		v3 := uint64(0)
+		v4 := -p1
+
+		for ; len(d) >= 32; d = d[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(d[0:]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(d[8:]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(d[16:]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(d[24:]))
+		}
+
+		h = rotl64(v1, 1) + rotl64(v2, 7) + rotl64(v3, 12) + rotl64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(d) >= 8; d = d[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(d))
+		h = rotl64(h, 27)*xxPrime1 + xxPrime4
+	}
+
+	if len(d) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(d)) * xxPrime1
+		h = rotl64(h, 23)*xxPrime2 + xxPrime3
+		d = d[4:]
+	}
+
+	for _, b := range d {
+		h ^= uint64(b) * xxPrime5
+		h = rotl64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = rotl64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func rotl64(x uint64, r uint) uint64 {
+	return x<<r | x>>(64-r)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// httpSourceMap maps repository roots to the base URLs of the plain file
+// trees to compare them against, as given with -http-source.
+type httpSourceMap map[string]string
+
+// httpSources are the mappings given with -http-source.
+var httpSources = make(httpSourceMap)
+
+func (m httpSourceMap) String() string {
+	var s []string
+	for root, base := range m {
+		s = append(s, root+"="+base)
+	}
+	sort.Strings(s)
+
+	return strings.Join(s, ", ")
+}
+
+// Set adds a mapping of the form root=url.
+func (m httpSourceMap) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q isn't of the form root=url", s)
+	}
+
+	u, err := url.Parse(s[i+1:])
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q isn't an http or https URL", s[i+1:])
+	}
+
+	m[s[:i]] = strings.TrimSuffix(s[i+1:], "/")
+
+	return nil
+}
+
+// httpSourceURL returns the URL of the file or directory at relativePath
+// under base, with {rev} in base replaced by rev.
+func httpSourceURL(base, rev, relativePath string) string {
+	u := strings.Replace(base, "{rev}", rev, -1)
+
+	for _, p := range strings.Split(relativePath, "/") {
+		if p != "" {
+			u += "/" + url.PathEscape(p)
+		}
+	}
+
+	return u
+}
+
+// hrefPattern matches the links in a directory listing.
+var hrefPattern = regexp.MustCompile(`(?i)href="([^"?#]+)"`)
+
+// listHTTPDir returns the names of the files in the directory listing at u,
+// and false if the server doesn't give one.
+func listHTTPDir(ctx context.Context, u string) ([]string, bool, error) {
+	req, err := http.NewRequest("GET", u+"/", nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		return nil, false, nil
+	}
+
+	d, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var names []string
+	for _, m := range hrefPattern.FindAllStringSubmatch(string(d), -1) {
+		// Subdirectories end in a slash, and links elsewhere have one in them.
+		name, err := url.PathUnescape(m[1])
+		if err != nil || strings.Contains(m[1], "/") || strings.Contains(m[1], ":") || name == "" {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, true, nil
+}
+
+// fetchHTTPFile downloads the file at u to p. It checks that the file exists
+// with a HEAD request first, and returns false if it doesn't.
+func fetchHTTPFile(ctx context.Context, u, p string) (bool, error) {
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return false, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HEAD %s: %s", u, res.Status)
+	}
+
+	size := res.ContentLength
+
+	req, err = http.NewRequest("GET", u, nil)
+	if err != nil {
+		return false, err
+	}
+
+	res, err = http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return false, err
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, res.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if size >= 0 && n != size {
+		return false, fmt.Errorf("GET %s: got %d bytes, but HEAD said there were %d", u, n, size)
+	}
+
+	return true, f.Close()
+}
+
+// fetchHTTPSource downloads the files of a repository at rev from the file
+// tree at base into dir, replacing whatever was there. There's no way to
+// fetch the whole tree, so only the files that are needed are: those that are
+// vendored, which are relative to the repository root, and those listed in
+// the directories of its packages, for finding the ones that weren't
+// vendored. A server that doesn't list directories can only be checked for
+// the vendored files.
+func fetchHTTPSource(ctx context.Context, base, rev string, vendored []string, dirs []string, dir string) error {
+	want := make(map[string]bool)
+	for _, p := range vendored {
+		want[p] = true
+	}
+
+	for _, d := range dirs {
+		names, ok, err := listHTTPDir(ctx, httpSourceURL(base, rev, d))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		for _, name := range names {
+			want[path.Join(d, name)] = true
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	var paths []string
+	for p := range want {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		u := httpSourceURL(base, rev, p)
+
+		if *verbose {
+			fmt.Fprintf(output, "downloading %s\n", u)
+		}
+
+		ok, err := fetchHTTPFile(ctx, u, filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+
+		if !ok && *verbose {
+			fmt.Fprintf(output, "%s isn't there\n", u)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// imageSource is a directory in a container image that holds the source of a
+// repository, as given with -image-source.
+type imageSource struct {
+	Image string
+	Path  string
+}
+
+// imageSourceMap maps repository roots to the images to compare them against.
+type imageSourceMap map[string]imageSource
+
+// imageSources are the mappings given with -image-source.
+var imageSources = make(imageSourceMap)
+
+func (m imageSourceMap) String() string {
+	var s []string
+	for root, src := range m {
+		s = append(s, root+"="+src.Image+":"+src.Path)
+	}
+	sort.Strings(s)
+
+	return strings.Join(s, ", ")
+}
+
+// Set adds a mapping of the form root=image:/path. Image references can't
+// have ":/" in them, so the first one starts the path.
+func (m imageSourceMap) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q isn't of the form root=image:/path", s)
+	}
+
+	root, ref := s[:i], s[i+1:]
+
+	j := strings.Index(ref, ":/")
+	if j <= 0 {
+		return fmt.Errorf("%q doesn't say which path in the image holds the source, as image:/path", ref)
+	}
+
+	m[root] = imageSource{Image: ref[:j], Path: ref[j+1:]}
+
+	return nil
+}
+
+// extractImageSource copies src.Path out of src.Image into dir, replacing
+// whatever was there, since a tag can be moved to another image. docker
+// pulls the image if it isn't there already.
+func extractImageSource(ctx context.Context, src imageSource, dir string) error {
+	out, err := dockerCommand(ctx, "create", src.Image)
+	if err != nil {
+		return err
+	}
+
+	id := strings.TrimSpace(string(out))
+	defer dockerCommand(context.Background(), "rm", id)
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return err
+	}
+
+	// A trailing "/." copies the directory's contents rather than the
+	// directory itself.
+	_, err = dockerCommand(ctx, "cp", id+":"+strings.TrimSuffix(src.Path, "/")+"/.", dir)
+	return err
+}
+
+func dockerCommand(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	if *verbose {
+		fmt.Fprintf(output, "$ %s\n", strings.Join(cmd.Args, " "))
+	}
+
+	out, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return nil, fmt.Errorf("docker %s: %s", args[0], strings.TrimSpace(string(ee.Stderr)))
+	}
+
+	return out, err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// sealPath is where the hash of the immutable checkout at dir is kept.
+func sealPath(dir string) string {
+	return dir + ".sha256"
+}
+
+// seal records the hash of the checkout at dir, so that later runs can tell
+// whether it's been changed.
+func seal(dir string) error {
+	h, err := hashTree(dirTree{}, dir)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(sealPath(dir), []byte(h+"\n"), 0644)
+}
+
+// checkSealed reports whether the checkout at dir has been sealed, failing if
+// its files have changed since.
+func checkSealed(dir string) (bool, error) {
+	d, err := ioutil.ReadFile(sealPath(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	// A seal from an older build is checked out and sealed again.
+	expected := strings.TrimSpace(string(d))
+	if !strings.HasPrefix(expected, treeHashVersion) {
+		return false, nil
+	}
+
+	h, err := hashTree(dirTree{}, dir)
+	if err != nil {
+		return false, err
+	}
+
+	if h != expected {
+		return false, fmt.Errorf("cache entry %q has changed since it was checked out (hash %s, expected %s)", dir, h, expected)
+	}
+
+	return true, nil
+}
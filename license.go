@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// licensePatterns pick out licenses by a phrase from their text, which is
+// matched after it's lower-cased and everything other than letters and digits
+// is squeezed into single spaces. They're tried in order, so licenses whose
+// text includes another's name come first: the LGPL and AGPL before the GPL.
+var licensePatterns = []struct {
+	ID      string
+	Phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license version 2 1"}},
+	{"GPL-3.0", []string{"gnu general public license version 3"}},
+	{"GPL-2.0", []string{"gnu general public license version 2"}},
+	{"MPL-2.0", []string{"mozilla public license version 2 0"}},
+	{"Apache-2.0", []string{"apache license version 2 0"}},
+	{"MIT", []string{"permission is hereby granted free of charge to any person obtaining a copy"}},
+	{"ISC", []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "may be used to endorse or promote products derived from this software"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+	{"CC0-1.0", []string{"cc0 1 0 universal"}},
+	{"Zlib", []string{"altered source versions must be plainly marked as such"}},
+}
+
+var (
+	spdxIdentifier  = regexp.MustCompile(`SPDX-License-Identifier:\s*([A-Za-z0-9.+-]+)`)
+	nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// classifyLicense returns the SPDX identifier of the license in text, going by
+// an SPDX-License-Identifier line if it has one, or "" if it isn't one it
+// knows.
+func classifyLicense(text []byte) string {
+	if m := spdxIdentifier.FindSubmatch(text); m != nil {
+		return string(m[1])
+	}
+
+	normalized := nonAlphanumeric.ReplaceAllString(strings.ToLower(string(text)), " ")
+
+	for _, p := range licensePatterns {
+		matched := true
+		for _, phrase := range p.Phrases {
+			if !strings.Contains(normalized, phrase) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return p.ID
+		}
+	}
+
+	return ""
+}
+
+// packageLicenses returns the licenses of the files in the nearest directory
+// with any to the package at dir (relative to the repository root, with
+// slashes) in co, going up to the root, sorted and without duplicates. It's
+// empty if there are no license files, and holds "unknown" for each that
+// isn't a license it knows.
+func packageLicenses(co *checkout, dir string) ([]string, error) {
+	for {
+		if inner, ok := co.relative(dir); ok {
+			entries, err := ioutil.ReadDir(filepath.Join(co.Dir, filepath.FromSlash(inner)))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			seen := make(map[string]bool)
+			var ids []string
+			for _, e := range entries {
+				if e.IsDir() || !isLicenseFile(e.Name()) {
+					continue
+				}
+
+				d, err := ioutil.ReadFile(filepath.Join(co.Dir, filepath.FromSlash(inner), e.Name()))
+				if err != nil {
+					return nil, err
+				}
+
+				id := classifyLicense(d)
+				if id == "" {
+					// NOTICE files and the like only go with a license.
+					if !strings.HasPrefix(strings.ToLower(e.Name()), "licen") && !strings.HasPrefix(strings.ToLower(e.Name()), "copying") {
+						continue
+					}
+
+					id = "unknown"
+				}
+
+				if !seen[id] {
+					ids = append(ids, id)
+					seen[id] = true
+				}
+			}
+
+			if len(ids) > 0 {
+				sort.Strings(ids)
+				return ids, nil
+			}
+		}
+
+		if dir == "" {
+			return nil, nil
+		}
+
+		if dir = path.Dir(dir); dir == "." {
+			dir = ""
+		}
+	}
+}
+
+// licenseAllowlist is the set of licenses given with -allowed-licenses, by
+// lower case SPDX identifier.
+type licenseAllowlist map[string]bool
+
+func parseLicenseAllowlist(s string) licenseAllowlist {
+	l := make(licenseAllowlist)
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			l[strings.ToLower(id)] = true
+		}
+	}
+
+	return l
+}
+
+// disallowed returns those of ids that aren't allowed.
+func (l licenseAllowlist) disallowed(ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		if !l[strings.ToLower(id)] {
+			out = append(out, id)
+		}
+	}
+
+	return out
+}
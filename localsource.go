@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// localSourceMap maps repository roots to local directories to compare them
+// with, as given with -local-src.
+type localSourceMap map[string]string
+
+// localSources are the mappings given with -local-src.
+var localSources = make(localSourceMap)
+
+func (m localSourceMap) String() string {
+	var s []string
+	for root, dir := range m {
+		s = append(s, root+"="+dir)
+	}
+	sort.Strings(s)
+
+	return strings.Join(s, ", ")
+}
+
+// Set adds a mapping of the form root=dir. The directory is made absolute,
+// since it's used from wherever the checkouts are.
+func (m localSourceMap) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("%q isn't of the form root=dir", s)
+	}
+
+	dir, err := filepath.Abs(s[i+1:])
+	if err != nil {
+		return err
+	}
+
+	m[s[:i]] = dir
+
+	return nil
+}
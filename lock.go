@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// heldLocks keeps the lock files open, and so locked, until we exit.
+var heldLocks []*os.File
+
+// lockCheckout takes an exclusive lock on the checkout directory dir, so that
+// other processes sharing the cache don't fetch or check out into it while
+// we're using it. The lock is on a file next to dir, and is held until we
+// exit. If another process holds it, lockCheckout waits for it.
+func lockCheckout(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dir+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	waiting := false
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		if ok {
+			heldLocks = append(heldLocks, f)
+			return nil
+		}
+
+		if !waiting {
+			fmt.Fprintf(output, "waiting for another process to finish with %s\n", dir)
+			waiting = true
+		}
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			f.Close()
+			return ctx.Err()
+		}
+	}
+}
@@ -2,240 +2,2970 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
+)
 
-	"github.com/pmezard/go-difflib/difflib"
-	"golang.org/x/tools/go/vcs"
+var (
+	manifestPath      = flag.String("manifest", "Godeps/Godeps.json", "Manifest file with dependencies.")
+	manifestAt        = flag.String("manifest-at", "", "Git ref of the project to read the manifest from, instead of the working tree.")
+	vendorAt          = flag.String("vendor-at", "", "Git ref of the project to read the vendor directory from, instead of the working tree.")
+	manifestGlob      = flag.String("manifest-glob", "", "Verify every manifest under the working directory matching this glob, like **/Godeps.json, each with the vendor directory next to it.")
+	packagesPath      = flag.String("packages", "", "File listing the vendored import paths, one per line, to use with -locks instead of -manifest.")
+	locksPath         = flag.String("locks", "", "Lock file with the revision of each package or repository listed in -packages.")
+	manifestType      = flag.String("manifest-format", "", "Format of the manifest file (godep, gomod, gowork). Detected from its contents if not set.")
+	vendorTool        = flag.String("vendor-tool", "", "Tool that made the vendor directory (godep, gomod), which decides which files it should have. Detected from the manifest if not set.")
+	vendorPath        = flag.String("vendor", "vendor", "Vendor directory holding dependencies, or a .zip or .tar.gz archive of one.")
+	cachePath         = flag.String("cache", os.TempDir(), "Temporary directory for checking out sources.")
+	cacheMaxAge       = flag.String("cache-max-age", "", "Remove checkouts from the cache that haven't been used for this long, like 72h or 30d, before starting.")
+	printVersion      = flag.Bool("version", false, "Print the version of this program and the Go version it was built with, and exit.")
+	printCachePath    = flag.Bool("print-cache-path", false, "Print the directory repositories are checked out into under -cache, and exit.")
+	configPath        = flag.String("config", "", "Configuration file with per-repository settings.")
+	gitBin            = flag.String("git-bin", "", "Path to the git executable. Defaults to $GODEP_VERIFY_GIT, or git from the PATH.")
+	verbose           = flag.Bool("v", false, "Turn on verbose logging.")
+	fix               = flag.Bool("fix", false, "Re-sync the vendor directory with the sources. Only shows what would change unless -yes is given.")
+	yes               = flag.Bool("yes", false, "Apply the changes made by -fix, instead of doing a dry run.")
+	includeTests      = flag.Bool("include-tests", false, "Compare _test.go files and testdata directories.")
+	treeHashPath      = flag.String("tree-hash-check", "", "Sidecar file with expected tree hashes to check each checkout against.")
+	useModCache       = flag.Bool("modcache", false, "Compare against modules already extracted in the Go module cache instead of cloning them, where possible.")
+	changedSince      = flag.String("only-changed-since-tag", "", "Only verify dependencies whose revision changed since the manifest at this git tag.")
+	regenerateCheck   = flag.Bool("regenerate-check", false, "Check that the vendor directory is exactly what go mod vendor makes of the module, instead of comparing it with each dependency's source.")
+	selfTest          = flag.Bool("self-test", false, "Verify a small built-in fixture to check that the tool works in this environment.")
+	modulesTxt        = flag.Bool("modules-txt", false, "Check that modules.txt in the vendor directory is consistent with go.mod.")
+	goModPath         = flag.String("gomod", "go.mod", "go.mod file to check modules.txt against.")
+	reportUnchanged   = flag.Bool("report-unchanged", false, "Print a line for every file that matched its source, as well as those that didn't.")
+	goProxy           = flag.String("goproxy", "", "Module proxies to download dependencies from instead of cloning them, in $GOPROXY syntax.")
+	goModDownload     = flag.Bool("go-mod-download", false, "Have go mod download fetch each module, checked against the checksum database, instead of cloning it, and check it against the go.sum next to the manifest before comparing.")
+	strict            = flag.Bool("strict", false, "Fail on problems with the vendor directory that are otherwise only warnings, like version control metadata in it or a dependency with nothing vendored.")
+	paranoid          = flag.Bool("paranoid", false, "Turn on the strictest combination of checks. See the README for which; each can still be turned off on its own.")
+	lenient           = flag.Bool("lenient", false, "Warn about duplicate manifest entries instead of failing.")
+	allowEmpty        = flag.Bool("allow-empty", false, "Pass even if no files were compared, as when every dependency is filtered out.")
+	watch             = flag.Bool("watch", false, "After verifying, keep watching the vendor directory and verify files again against the cached checkouts as they change.")
+	warnOnly          = flag.Bool("warn-only", false, "Report failures but always exit successfully.")
+	failOn            = flag.String("fail-on", "any", "Which failures make the exit status non-zero: mismatch for problems with the vendored files, infra for repositories that couldn't be checked out, or any. With mismatch, repositories that can't be checked out are skipped as with -keep-going.")
+	resolveOnly       = flag.String("resolve-only", "", "Resolve every import path, write the results to this file, and exit without verifying anything.")
+	useResolution     = flag.String("use-resolution", "", "File written by -resolve-only to take repositories from, instead of resolving import paths over the network.")
+	refreshResolution = flag.Bool("refresh-resolution", false, "Resolve every import path again, ignoring cached results.")
+	noRedirect        = flag.Bool("no-redirect", false, "Fail when an import path resolves to a repository on a different host.")
+	movedRepos        = flag.String("moved-repos", "report", "What to do when a repository's URL permanently redirects to another, as when it's moved to a new owner: report it, accept the new URL, fail, or ignore it without checking.")
+	reportFormat      = flag.String("format", "text", "Report format (text, json, html, csv, template). Reports other than text are written to -report-output.")
+	templateText      = flag.String("template", "", "Go text/template to write the report with, for -format=template: the name of a built-in one (summary, markdown), a file holding one, or the template itself. Implies -format=template.")
+	reportOutput      = flag.String("report-output", "", "File to write the report to, or - for stdout.")
+	incremental       = flag.Bool("incremental", false, "Skip repositories whose revisions and vendored files haven't changed since they last passed.")
+	quiet             = flag.Bool("quiet", false, "Don't print diffs, only the lines near which each changed file differs.")
+	checkUsageFlag    = flag.Bool("check-usage", false, "Check that every imported package is vendored and verified, and that every vendored package is imported.")
+	storePath         = flag.String("store", "", "Shared store of checked out trees, to avoid cloning a repository at the same revision twice.")
+	ignorePbVersion   = flag.Bool("ignore-pb-version", false, "Ignore the protoc and protoc-gen-go version comments at the top of .pb.go files when comparing them.")
+	semanticConfig    = flag.Bool("semantic-config", false, "Compare JSON and YAML files by their parsed contents, ignoring formatting and key order.")
+	caseInsensitive   = flag.Bool("case-insensitive-match", false, "Find the source of a vendored file even if its name differs in case, and report the difference in case separately.")
+	includeNative     = flag.Bool("include-native", false, "Always compare native source files (C, assembly and the like), even if -licenses-only or .vendorverifyignore would leave them out.")
+	collapseIdentical = flag.Bool("collapse-identical", false, "Show changed files with exactly the same changes as one already shown in a single line each, instead of repeating the diff.")
+	detectNondet      = flag.Bool("detect-nondeterministic", false, "Point out changed files that only differ in timestamps, absolute paths or -nondeterministic-pattern matches, which are likely regenerated differently each time.")
+	strictGenerated   = flag.Bool("strict-generated", false, "Single out changes to generated files, which fail the run even with -warn-only.")
+	validatorCommand  = flag.String("validator", "", "Program to run for each changed file, with the vendored file, its source and its package's import path as arguments. The change is accepted if it exits successfully.")
+	diffToolCommand   = flag.String("diff-tool", "", "Program to show changed files with, instead of printing a diff. See the README for how it's run.")
+	githubArchive     = flag.Bool("github-archive", false, "Download tarballs of GitHub repositories at the pinned revision instead of cloning them.")
+	sbomPath          = flag.String("sbom", "", "CycloneDX SBOM to cross-check the manifest against; every dependency must be listed in it at the same version, and everything it lists must be vendored.")
+	manifestSignature = flag.String("manifest-signature", "", "Detached GPG or minisign signature over the manifest, which has to be valid before the manifest is used.")
+	trustedKey        = flag.String("trusted-key", "", "GPG keyring or minisign public key to check -manifest-signature with. GPG signatures are checked against gpgv's default keyring without it.")
+	useGitArchive     = flag.Bool("use-git-archive", false, "Compare cloned repositories against what git archive makes of the pinned commit, with export-ignore applied, instead of the whole checkout.")
+	godepLayout       = flag.String("godep-layout", "auto", "Where a godep manifest's dependencies were copied to: vendor, workspace (Godeps/_workspace/src), or auto to tell from the manifest and what's there.")
+	diffAlgorithm     = flag.String("diff-algorithm", "difflib", "Algorithm to show changes with: difflib, or myers, minimal, patience or histogram to use git diff's.")
+	serveAddr         = flag.String("serve", "", "Address to serve verifications over HTTP on, e.g. :8080, rather than verifying anything on startup.")
+	serveJobs         = flag.Int("serve-jobs", 2, "Most verifications to run at once with -serve; the rest wait their turn.")
+	upstreamRoot      = flag.String("upstream-root", "", "Directory holding the source of every repository already, under its root (e.g. dir/github.com/pkg/errors), to compare with instead of checking anything out.")
+	recordMapping     = flag.String("record-mapping", "", "Directory to write the repository and revision every dependency resolved to into, as mapping-YYYY-MM-DD.json.")
+	checkOnly         = flag.String("check-only", "", "Comma-separated categories of mismatch to check for, out of missing, extra, modified, mode and symlink; the others aren't reported and don't fail the run. Without it, all but symlink are checked, and mode only with -check-executable.")
+	maxMemory         = flag.String("max-memory", "", "Rough limit on the memory used to compare files, like 256M. Files too big to read whole within it are compared a block at a time, and reported with where they first differ instead of a diff.")
+	emitGoSum         = flag.String("emit-gosum", "", "Directory to write a go.sum with the module hash of every dependency's checkout to, along with a go.mod requiring them, for migrating to modules.")
+	compareReport     = flag.String("compare-report", "", "JSON report from an earlier run, e.g. on the base branch, to list the mismatches that are new since and those that were resolved.")
+	previousMapping   = flag.String("previous-mapping", "", "Mapping written with -record-mapping on an earlier run, to list the dependencies that were added, removed or changed since.")
+	credentialHelper  = flag.String("credential-helper", "", "Git credential helper to use for every repository, as for git's credential.helper setting. $GODEP_VERIFY_TOKEN is used as a token too, if it's set.")
+	allowedLicenses   = flag.String("allowed-licenses", "", "Comma-separated SPDX identifiers of the licenses dependencies may have, e.g. MIT,BSD-3-Clause,Apache-2.0. Fail for every package whose license files in the source hold any other.")
+	fileManifest      = flag.String("file-manifest", "", "File of SHA-256 hashes and paths in the vendor directory, as sha256sum writes, to check those files against instead of verifying the manifest.")
+	golden            = flag.String("golden", "", "Known-good copy of the vendor directory, or a .zip, .tar.gz or .tgz archive of it, to compare the vendor directory with instead of verifying the manifest.")
+	checkLayout       = flag.Bool("check-layout", false, "Fail for every vendored directory that isn't a directory in the source, as a vendoring tool that renames or flattens directories leaves.")
+	testIntegrity     = flag.Bool("check-test-integrity", false, "Fail for every test file in a vendored package's source that isn't vendored, when some of the repository's test files are.")
+	checkExecutable   = flag.Bool("check-executable", false, "Fail for every vendored file with an execute bit set that its source doesn't have.")
+	checkPackages     = flag.Bool("check-packages", false, "Check that the Go files vendored in each directory declare the package upstream's do there, have no import comment for another path, and don't import internal packages they can't.")
+	onlyPackages      = flag.String("only-packages", "", "File listing import paths, one per line, or - for stdin; only the dependencies providing them are verified.")
+	pinFile           = flag.String("pin-file", "", "File of trusted commits for each repository; fail before cloning anything if the manifest doesn't match it.")
+	cloneDepth        = flag.Int("depth", 0, "Only clone this many commits of each branch's history. The clone is deepened if the pinned commit isn't in it.")
+	shallowSince      = flag.String("shallow-since", "", "Only clone the history after this date, or with auto, after the date in each pseudo-version. The clone is deepened if the pinned commit isn't in it.")
+	maxRepoSize       = flag.String("max-repo-size", "", "Fail if a clone takes up more than this much disk space, e.g. 500M or 2G.")
+	keepGoing         = flag.Bool("keep-going", false, "Report repositories that can't be checked out, and vendored files that can't be read, as failures and carry on with the rest.")
+	taintedBy         = flag.String("tainted-by", "", "Only verify the vendored packages that import this package, directly or indirectly, and the package itself.")
+	sample            = flag.Float64("sample", 100, "Percentage of files to verify, picked using -seed, for a quicker but partial check.")
+	seed              = flag.Int64("seed", 0, "Seed for picking the files to verify with -sample. A random one is used if it's 0.")
+	packageFilter     = flag.String("package-filter", "", "Only verify dependencies whose import path matches this regular expression.")
+	checkDowngrades   = flag.Bool("check-downgrades", false, "Warn about dependencies pinned at an older commit than they were on the last run with this flag.")
+	resume            = flag.Bool("resume", false, "Carry on from where an interrupted run stopped, skipping the repositories it had already verified.")
+	compareMode       = flag.String("compare-mode", "hash", "How to compare files (hash, or size-first to skip hashing files whose sizes differ).")
+	hashAlgorithm     = flag.String("hash", "sha256", "Hash algorithm for comparing files (sha256, sha1, sha512, xxhash).")
+	immutableCache    = flag.Bool("immutable-cache", false, "Never fetch into or check out again a cached checkout, and fail if one changed since it was made.")
+	licensesOnly      = flag.Bool("licenses-only", false, "Only compare license files (LICENSE, COPYING and the like), including those in the directories above each package.")
+	successOutput     = flag.String("success-output", "", "File to write a JSON record of the verified repositories to when the run passes. It's removed when the run fails.")
+	reportRepoURLs    = flag.Bool("report-repo-urls", false, "List the URL each repository was checked out from, once any overrides and rewrites are applied, and how, in the output and reports.")
+	coverageOutput    = flag.String("coverage-output", "", "File to write a JSON list of every file looked at to, with its import path and status, including those that matched.")
+	metricsOutput     = flag.String("metrics-output", "", "File to write Prometheus metrics about the run to, in the text format, e.g. for node_exporter's textfile collector.")
+	metricsPush       = flag.String("metrics-push", "", "Prometheus pushgateway URL to push metrics about the run to, with a job of godep_verify unless the URL has /metrics/job/ in it.")
+	attestationPath   = flag.String("attestation", "", "File to write a JSON attestation to when every vendored file matched its source.")
+	threadsPerRepo    = flag.Int("threads-per-repo", 1, "Number of files in each repository to read and hash at once.")
+	rateLimit         = flag.Float64("rate-limit", 0, "Maximum number of clones and fetches to start per second, or 0 for no limit.")
+	recentWindow      = flag.String("upstream-changed-since", "", "Only compare files changed upstream within this long, like 90d, before the pinned commit.")
+	upstreamLog       = flag.Bool("upstream-log", false, "For each changed file, list the upstream commits after the vendored revision that touch it.")
+	requireTags       = flag.Bool("require-tags", false, "Fail for every dependency that isn't pinned at a commit with an annotated tag.")
+	targetOS          = flag.String("goos", "", "Only compare Go and native source files that are built for this GOOS, going by their names and build constraints.")
+	targetArch        = flag.String("goarch", "", "Only compare Go and native source files that are built for this GOARCH, going by their names and build constraints.")
+	buildCheck        = flag.String("build-check", "", "After verifying, check that every vendored package compiles from the vendor directory alone, with go build, or go vet to vet it as well.")
+	buildTags         = flag.String("build-tags", "", "Comma-separated build tags, as for go build -tags; only compare Go and native source files whose build constraints are satisfied with them.")
+	detectDupes       = flag.Bool("detect-dupes", false, "Warn about vendored files in different packages with the same content, where their sources differ.")
+	vulncheck         = flag.Bool("vulncheck", false, "Fail if any dependency is at a version with known vulnerabilities in -vuln-db.")
+	vulnDB            = flag.String("vuln-db", "https://vuln.go.dev", "Go vulnerability database to check dependencies against with -vulncheck, or a local copy of it.")
+	emitPatch         = flag.String("emit-patch", "", "File to write a patch to, for git apply, that makes the vendor directory match the sources.")
+	tui               = flag.Bool("tui", false, "Once the run is done, browse the results interactively: pick a repository to see its changed files, and a file to see its diff.")
+	groupByRepo       = flag.Bool("group-by-repo", false, "Print a summary at the end listing each repository once, with whether it passed and the files in it that didn't.")
+	profileFiles      = flag.Int("profile-files", 0, "Time how long each file takes to hash and compare, and print this many of the slowest at the end.")
+	allowMissingRev   = flag.Bool("allow-missing-rev", false, "When a pinned revision no longer exists upstream, compare against the closest commit that does instead of failing.")
+	againstHead       = flag.Bool("against-head", false, "Compare against the tip of each repository's default branch instead of the pinned revision.")
 )
 
-var (
-	manifestPath = flag.String("manifest", "Godeps/Godeps.json", "Manifest file with dependencies.")
-	vendorPath   = flag.String("vendor", "vendor", "Vendor directory holding dependencies.")
-	cachePath    = flag.String("cache", os.TempDir(), "Temporary directory for checking out sources.")
-	verbose      = flag.Bool("v", false, "Turn on verbose logging.")
-	fix          = flag.Bool("fix", false, "Automatically restore files with differences from source.")
-)
+// excludeDirs are the directories given with -exclude-dir.
+var excludeDirs dirList
+
+// nondetPatterns are the patterns given with -nondeterministic-pattern.
+var nondetPatterns regexpList
+
+func init() {
+	flag.Var(&gitConfigSettings, "git-config", "Git setting as key=value to pass to every git command, e.g. http.sslVerify=false. Can be given more than once.")
+	flag.Var(&excludeDirs, "exclude-dir", "Directory in the vendor directory to leave out, along with everything under it. Can be given more than once.")
+	flag.Var(&nondetPatterns, "nondeterministic-pattern", "Regular expression matching content that changes every time a file is generated, for -detect-nondeterministic. Can be given more than once.")
+	flag.Var(rootOverrides, "repo-root-override", "Import path to resolve to a given repository no matter what, as importpath=root,repo or importpath=root,repo,vcs. Can be given more than once.")
+	flag.Var(imageSources, "image-source", "Repository root to compare against a directory in a container image instead of cloning, as root=image:/path. Can be given more than once.")
+	flag.Var(localSources, "local-src", "Repository root to compare against a local directory as it is, uncommitted changes and all, instead of its pinned revision, as root=dir. Can be given more than once.")
+	flag.Var(acceptRevs, "accept-rev", "Other revision a repository root's vendored files may match instead of the pinned one, as root=rev, e.g. while a bump is only partly vendored. Files are reported with the revision they matched. Can be given more than once.")
+	flag.Var(httpSources, "http-source", "Repository root to compare against a file tree served over HTTP instead of cloning, as root=url, where {rev} in the url is replaced by the pinned revision. Can be given more than once.")
+}
+
+// exitInterrupted is the exit code used when we're stopped by a signal,
+// following the shell convention of 128 + SIGINT.
+const exitInterrupted = 130
+
+func main() {
+	flag.Parse()
+
+	if *paranoid {
+		if err := applyParanoid(); err != nil {
+			panic(err)
+		}
+	}
+
+	if *printVersion {
+		t := currentTool()
+		fmt.Fprintf(output, "godep-verify %s, built with %s\n", t.Version, t.GoVersion)
+		return
+	}
+
+	if *printCachePath {
+		dir, err := filepath.Abs(checkoutCacheDir())
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Fprintln(output, dir)
+		return
+	}
+
+	if *manifestGlob != "" {
+		if *manifestSignature != "" {
+			panic(fmt.Errorf("-manifest-signature can't be used with -manifest-glob, as it's the signature of a single manifest"))
+		}
+
+		os.Exit(verifyManifests(*manifestGlob))
+	}
+
+	started := time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	// cloning holds the directory of a clone in progress, so that it can be
+	// removed if we're interrupted before it completes. A half-finished clone
+	// left in the cache would otherwise break the next run.
+	var cloning string
+
+	defer func() {
+		if ctx.Err() == nil {
+			return
+		}
+
+		recover()
+
+		fmt.Fprintf(output, "# Interrupted\n")
+
+		if cloning != "" {
+			if *verbose {
+				fmt.Fprintf(output, "removing incomplete clone %q\n", cloning)
+			}
+
+			// ctx is done, but git still has to prune a worktree.
+			removeCheckout(context.Background(), cloning)
+		}
+
+		os.Exit(exitInterrupted)
+	}()
+
+	if *selfTest {
+		fmt.Fprintf(output, "# Running self-test\n")
+
+		m, v, err := writeSelfTestFixture(filepath.Join(*cachePath, "vendor-verify-self-test"))
+		if err != nil {
+			panic(err)
+		}
+
+		*manifestPath, *manifestType, *vendorPath = m, "", v
+
+		defer func() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if r := recover(); r != nil {
+				fmt.Fprintf(output, "# Self-test failed: %v\n", r)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	if (*manifestAt != "" || *vendorAt != "") && (*packagesPath != "" || *locksPath != "" || *manifestSignature != "" || *fileManifest != "" || *golden != "") {
+		panic(fmt.Errorf("-manifest-at and -vendor-at can't be used with -packages and -locks, -manifest-signature, -file-manifest or -golden"))
+	}
+
+	if *fileManifest != "" && *golden != "" {
+		panic(fmt.Errorf("-file-manifest can't be used with -golden"))
+	}
+
+	// A file list is checked on its own, without the manifest or anything
+	// upstream.
+	if *fileManifest != "" {
+		tree, err := openVendorTree(*vendorPath)
+		if err != nil {
+			panic(err)
+		}
+
+		failed, err := checkFileManifest(tree, *vendorPath, *fileManifest)
+		if err != nil {
+			panic(err)
+		}
+
+		if failed {
+			fmt.Fprintf(output, "# Failures were detected\n")
+			if *warnOnly {
+				os.Exit(0)
+			}
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(output, "# All done\n")
+		os.Exit(0)
+	}
+
+	// So is a golden copy of the vendor directory.
+	if *golden != "" {
+		tree, err := openVendorTree(*vendorPath)
+		if err != nil {
+			panic(err)
+		}
+
+		failed, err := checkGolden(tree, *vendorPath, *golden)
+		if err != nil {
+			panic(err)
+		}
+
+		if failed {
+			fmt.Fprintf(output, "# Failures were detected\n")
+			if *warnOnly {
+				os.Exit(0)
+			}
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(output, "# All done\n")
+		os.Exit(0)
+	}
+
+	if err := resolveGitBin(ctx); err != nil {
+		panic(err)
+	}
+
+	remoteLimiter = newRateLimiter(*rateLimit)
+
+	if *serveAddr != "" {
+		if *fix || *yes || *watch || *tui || *attestationPath != "" || *metricsOutput != "" || *metricsPush != "" || *incremental || *resume {
+			panic(fmt.Errorf("-serve can't be used with -fix, -yes, -watch, -tui, -attestation, -metrics-output, -metrics-push, -incremental or -resume, which only make sense for a single run"))
+		}
+
+		if err := serve(ctx, *serveAddr, *serveJobs); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	switch *godepLayout {
+	case "auto", "vendor", "workspace":
+	default:
+		panic(fmt.Errorf("unknown -godep-layout %q; it has to be auto, vendor or workspace", *godepLayout))
+	}
+
+	if *trustedKey != "" && *manifestSignature == "" {
+		panic(fmt.Errorf("-trusted-key is only used with -manifest-signature"))
+	}
+
+	if *manifestSignature != "" {
+		if *packagesPath != "" || *locksPath != "" {
+			panic(fmt.Errorf("-manifest-signature can't be used with -packages and -locks, as there's no single manifest to sign"))
+		}
+
+		if err := verifySignature(ctx, *manifestPath, *manifestSignature, *trustedKey); err != nil {
+			panic(fmt.Errorf("couldn't verify the signature of manifest %q: %s", *manifestPath, err))
+		}
+
+		if *verbose {
+			fmt.Fprintf(output, "manifest %q has a valid signature in %q\n", *manifestPath, *manifestSignature)
+		}
+	}
+
+	var manifest Manifest
+	if *packagesPath != "" || *locksPath != "" {
+		if *packagesPath == "" || *locksPath == "" {
+			panic(fmt.Errorf("-packages and -locks have to be given together"))
+		}
+
+		if *changedSince != "" {
+			panic(fmt.Errorf("-only-changed-since-tag can't be used with -packages and -locks"))
+		}
+
+		manifest, err = readSplitManifest(*packagesPath, *locksPath)
+		if err != nil {
+			panic(&ManifestError{Path: *locksPath, Err: err})
+		}
+
+		// The revisions come from the lock file, so that's what's reported
+		// as the manifest.
+		*manifestPath = *locksPath
+	} else if *manifestAt != "" {
+		manifest, err = loadManifestAt(ctx, *manifestAt, *manifestPath, *manifestType)
+		if err != nil {
+			panic(&ManifestError{Path: *manifestPath, Err: err})
+		}
+
+		fmt.Fprintf(output, "# Verifying the manifest at %s\n", *manifestAt)
+	} else {
+		manifest, err = LoadManifest(*manifestPath, *manifestType)
+		if err != nil {
+			panic(&ManifestError{Path: *manifestPath, Err: err})
+		}
+	}
+
+	if m, ok := manifest.(*godepManifest); ok {
+		if *verbose {
+			fmt.Fprintf(output, "manifest has GodepVersion %q and GoVersion %q\n", m.GodepVersion, m.GoVersion)
+		}
+
+		explicit := false
+		flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "vendor" })
+
+		if explicit && *godepLayout == "workspace" {
+			panic(fmt.Errorf("-godep-layout=workspace can't be used with -vendor, which says where the dependencies are itself"))
+		}
+
+		var warnings []string
+		*vendorPath, warnings = m.vendorLayout(*manifestPath, *vendorPath, *godepLayout, explicit)
+		for _, w := range warnings {
+			fmt.Fprintf(output, "[!] %s\n", w)
+		}
+	}
+
+	if err := checkCacheLocation(*cachePath, *vendorPath); err != nil {
+		panic(err)
+	}
+
+	if *cacheMaxAge != "" {
+		maxAge, err := parseAge(*cacheMaxAge)
+		if err != nil {
+			panic(err)
+		}
+
+		evicted, err := evictCache(*cachePath, maxAge)
+		if err != nil {
+			panic(err)
+		}
+
+		if *verbose {
+			fmt.Fprintf(output, "evicted %d checkouts unused for more than %s from the cache\n", evicted, *cacheMaxAge)
+		}
+	}
+
+	if *useGitArchive && (*recentWindow != "" || *upstreamLog || *checkDowngrades) {
+		panic(fmt.Errorf("-use-git-archive can't be used with -upstream-changed-since, -upstream-log or -check-downgrades, as the archive has no history"))
+	}
+
+	var window time.Duration
+	if *recentWindow != "" {
+		w, err := parseAge(*recentWindow)
+		if err != nil {
+			panic(err)
+		}
+		window = w
+
+		if *useModCache || *goProxy != "" || *goModDownload || *storePath != "" || *githubArchive || len(imageSources) > 0 || len(httpSources) > 0 || *againstHead {
+			panic(fmt.Errorf("-upstream-changed-since can't be used with -modcache, -goproxy, -go-mod-download, -store, -github-archive, -image-source, -http-source or -against-head, as it needs the history of the pinned commit"))
+		}
+	}
+
+	// recent are the files changed within -upstream-changed-since in each
+	// checkout, worked out as they're needed.
+	recent := make(map[*checkout]map[string]bool)
+
+	if *treeHashPath != "" && (*useModCache || *goProxy != "" || *goModDownload || *storePath != "" || *githubArchive || len(imageSources) > 0 || len(httpSources) > 0) {
+		panic(fmt.Errorf("-tree-hash-check can't be used with -modcache, -goproxy, -go-mod-download, -store, -github-archive, -image-source or -http-source, as they don't have the commits to check"))
+	}
+
+	if *vendorAt != "" && (*fix || *checkUsageFlag || *taintedBy != "" || *emitPatch != "" || *watch || *validatorCommand != "") {
+		panic(fmt.Errorf("-fix, -check-usage, -tainted-by, -emit-patch, -watch and -validator need the vendor directory in the working tree, not -vendor-at"))
+	}
+
+	if isVendorArchive(*vendorPath) && (*fix || *checkUsageFlag || *taintedBy != "" || *emitPatch != "" || *watch || *validatorCommand != "") {
+		panic(fmt.Errorf("-fix, -check-usage, -tainted-by, -emit-patch, -watch and -validator need -vendor to be a directory, not an archive"))
+	}
+
+	if *watch && *fix {
+		panic(fmt.Errorf("-watch can't be used with -fix"))
+	}
+
+	if *tui && (*watch || !isTerminal(os.Stdin)) {
+		panic(fmt.Errorf("-tui needs to be run in a terminal, and can't be used with -watch"))
+	}
+
+	var tree vendorTree
+	if *vendorAt != "" {
+		tree, err = readGitTree(ctx, *vendorAt, *vendorPath)
+		fmt.Fprintf(output, "# Verifying the vendor directory at %s\n", *vendorAt)
+	} else {
+		tree, err = openVendorTree(*vendorPath)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if *templateText != "" {
+		if *reportFormat == "text" {
+			*reportFormat = "template"
+		}
+
+		if *reportFormat != "template" {
+			panic(fmt.Errorf("-template can't be used with -format=%s", *reportFormat))
+		}
+
+		t, err := parseReportTemplate(*templateText)
+		if err != nil {
+			panic(fmt.Errorf("couldn't parse -template: %s", err))
+		}
+
+		reportTemplate = t
+	} else if *reportFormat == "template" {
+		panic(fmt.Errorf("-format=template needs -template"))
+	}
+
+	if *reportFormat != "text" {
+		if _, ok := reportFormats[*reportFormat]; !ok {
+			panic(fmt.Errorf("unknown report format %q", *reportFormat))
+		}
+
+		if *reportOutput == "" {
+			panic(fmt.Errorf("-format=%s needs -report-output", *reportFormat))
+		}
+	}
+
+	// The earlier report is read before anything else is done, so a bad
+	// one doesn't waste a whole run.
+	var baseline *Report
+	if *compareReport != "" {
+		r, err := readReport(*compareReport)
+		if err != nil {
+			panic(err)
+		}
+
+		baseline = r
+	}
+
+	if *resolveOnly != "" && *useResolution != "" {
+		panic(fmt.Errorf("-resolve-only can't be used with -use-resolution"))
+	}
+
+	if *checkOnly != "" {
+		s, err := parseCategories(*checkOnly)
+		if err != nil {
+			panic(err)
+		}
+
+		if _, ok := tree.(dirTree); !ok && s["symlink"] {
+			panic(fmt.Errorf("-check-only symlink needs a vendor directory, as archives don't hold symlinks"))
+		}
+
+		checkCategories = s
+	}
+
+	if *buildCheck != "" {
+		if !buildTools[*buildCheck] {
+			panic(fmt.Errorf("unknown -build-check %q, expected build or vet", *buildCheck))
+		}
+
+		if _, ok := tree.(dirTree); !ok {
+			panic(fmt.Errorf("-build-check needs a vendor directory, not an archive"))
+		}
+	}
+
+	if *requireTags && (*useModCache || *goProxy != "" || *goModDownload || *storePath != "" || *githubArchive) {
+		panic(fmt.Errorf("-require-tags can't be used with -modcache, -goproxy, -go-mod-download, -store or -github-archive, as they don't have the tags to check"))
+	}
+
+	if downloaded := cfg.downloadedSources(); len(downloaded) > 0 && (*recentWindow != "" || *treeHashPath != "" || *requireTags || *againstHead) {
+		panic(fmt.Errorf("-upstream-changed-since, -tree-hash-check, -require-tags and -against-head need every repository to be cloned, but the config has another Source for %s", strings.Join(downloaded, ", ")))
+	}
+
+	// Modules from go mod download have to match the hashes in go.sum.
+	var modSums goSum
+	if *goModDownload {
+		s, err := readGoSum(filepath.Join(filepath.Dir(*manifestPath), "go.sum"))
+		if err != nil {
+			panic(fmt.Errorf("-go-mod-download needs the go.sum next to the manifest: %s", err))
+		}
+
+		modSums = s
+	}
+
+	if *resume && *againstHead {
+		panic(fmt.Errorf("-resume can't be used with -against-head"))
+	}
+
+	if *immutableCache && *againstHead {
+		panic(fmt.Errorf("-immutable-cache can't be used with -against-head, as the checkouts would have to move"))
+	}
+
+	if (*requireTags || *treeHashPath != "") && *againstHead {
+		panic(fmt.Errorf("-require-tags and -tree-hash-check can't be used with -against-head, as the pinned revisions aren't checked out"))
+	}
+
+	if *sample <= 0 || *sample > 100 {
+		panic(fmt.Errorf("-sample has to be more than 0 and at most 100, not %g", *sample))
+	}
+
+	sampling := *sample < 100
+	if sampling {
+		if *attestationPath != "" {
+			panic(fmt.Errorf("-attestation can't be used with -sample, as not every file is checked"))
+		}
+
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+
+		fmt.Fprintf(output, "# Verifying a %g%% sample of files with -seed %d\n", *sample, *seed)
+	}
+
+	// partial is set when not every file is compared, so the run doesn't show
+	// that everything matched.
+	partial := sampling || window > 0 || *licensesOnly || checkCategories.partial()
+	if window > 0 && *attestationPath != "" {
+		panic(fmt.Errorf("-attestation can't be used with -upstream-changed-since, as not every file is checked"))
+	}
+
+	if *licensesOnly && *attestationPath != "" {
+		panic(fmt.Errorf("-attestation can't be used with -licenses-only, as only license files are checked"))
+	}
+
+	if checkCategories.partial() && *attestationPath != "" {
+		panic(fmt.Errorf("-attestation can't be used with -check-only %s, as it doesn't check every kind of mismatch", *checkOnly))
+	}
+
+	if *attestationPath != "" && *againstHead {
+		panic(fmt.Errorf("-attestation can't be used with -against-head, as the pinned revisions aren't checked"))
+	}
+
+	var packageRegexp *regexp.Regexp
+	if *packageFilter != "" {
+		re, err := regexp.Compile(*packageFilter)
+		if err != nil {
+			panic(fmt.Errorf("invalid -package-filter: %s", err))
+		}
+
+		packageRegexp = re
+	}
+
+	var maxSize int64
+	if *maxRepoSize != "" {
+		n, err := parseByteSize(*maxRepoSize)
+		if err != nil {
+			panic(fmt.Errorf("invalid -max-repo-size: %s", err))
+		}
+
+		maxSize = n
+	}
+
+	if *maxMemory != "" {
+		n, err := parseByteSize(*maxMemory)
+		if err != nil {
+			panic(fmt.Errorf("invalid -max-memory: %s", err))
+		}
+
+		// Each thread holds a file and its source, and then their diff.
+		threads := *threadsPerRepo
+		if threads < 1 {
+			threads = 1
+		}
+		streamAbove = n / int64(4*threads)
+		if streamAbove < 1 {
+			streamAbove = 1
+		}
+	}
+
+	hashFunc, ok := hashFuncs[*hashAlgorithm]
+	if !ok {
+		panic(fmt.Errorf("unknown hash algorithm %q", *hashAlgorithm))
+	}
+
+	if !diffAlgorithms[*diffAlgorithm] {
+		panic(fmt.Errorf("unknown diff algorithm %q", *diffAlgorithm))
+	}
+
+	if *compareMode != "hash" && *compareMode != "size-first" {
+		panic(fmt.Errorf("unknown compare mode %q", *compareMode))
+	}
+
+	if *failOn != "any" && *failOn != "mismatch" && *failOn != "infra" {
+		panic(fmt.Errorf("unknown -fail-on %q; expected mismatch, infra or any", *failOn))
+	}
+
+	if !movedRepoActions[*movedRepos] {
+		panic(fmt.Errorf("unknown -moved-repos %q; expected report, accept, fail or ignore", *movedRepos))
+	}
+
+	if *regenerateCheck {
+		failed, err := checkRegenerated(ctx, *manifestPath, manifest, tree, hashFunc)
+		if err != nil {
+			panic(err)
+		}
+
+		if failed {
+			fmt.Fprintf(output, "# Failures were detected\n")
+			if *warnOnly {
+				os.Exit(0)
+			}
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(output, "# All done\n")
+		os.Exit(0)
+	}
+
+	report := &Report{Manifest: *manifestPath, Tool: currentTool()}
+
+	failed := false
+	// infraFailures counts the repositories that couldn't be checked out,
+	// which -fail-on tells apart from problems with the vendored files.
+	infraFailures := 0
+	editedGenerated := 0
+	truncatedFiles := 0
+
+	// identical groups the changed files with -collapse-identical by their
+	// vendored and source contents, in the order each was first seen.
+	identical := make(map[string][]string)
+	var identicalKeys []string
+
+	// patch makes the vendor directory match the sources, for -emit-patch.
+	var patch gitPatch
+
+	// timings are how long each file took to compare, for -profile-files.
+	var timings []fileTiming
+	// vendored are the hashes of each file and its source, for -detect-dupes.
+	var vendored []vendoredFile
+
+	if *modulesTxt {
+		fmt.Fprintf(output, "# Checking modules.txt against go.mod\n")
+
+		mod, err := readGoMod(*goModPath)
+		if err != nil {
+			panic(err)
+		}
+
+		modules, err := readModulesTxt(tree, filepath.Join(*vendorPath, "modules.txt"))
+		if err != nil {
+			panic(err)
+		}
+
+		for _, p := range checkModulesTxt(mod, modules) {
+			fmt.Fprintf(output, "[!] %s\n", p)
+			report.Problems = append(report.Problems, p)
+			failed = true
+		}
+	}
+
+	deps := manifest.Deps()
+
+	if dups := duplicateDeps(deps); len(dups) > 0 {
+		if !*lenient {
+			panic(fmt.Errorf("manifest %q has duplicate entries: %s", *manifestPath, strings.Join(dups, "; ")))
+		}
+
+		for _, d := range dups {
+			fmt.Fprintf(output, "[!] Duplicate manifest entry: %s; using the last one\n", d)
+		}
+
+		deps = dedupeDeps(deps)
+	}
+
+	if *changedSince != "" {
+		previousPath := filepath.ToSlash(*manifestPath)
+		if !filepath.IsAbs(*manifestPath) {
+			previousPath = "./" + previousPath
+		}
+
+		d, err := gitShow(ctx, *changedSince, previousPath)
+		if err != nil {
+			panic(fmt.Errorf("couldn't read manifest at %s: %s", *changedSince, err))
+		}
+
+		previous, err := ParseManifest(d, *changedSince+":"+*manifestPath, *manifestType)
+		if err != nil {
+			panic(err)
+		}
+
+		deps = changedDeps(deps, previous.Deps())
+
+		fmt.Fprintf(output, "# Verifying %d dependencies changed since %s\n", len(deps), *changedSince)
+	}
+
+	if packageRegexp != nil {
+		deps = matchingDeps(deps, packageRegexp)
+
+		fmt.Fprintf(output, "# Verifying %d dependencies matching %s\n", len(deps), *packageFilter)
+	}
+
+	if *onlyPackages != "" {
+		list, err := readLines(*onlyPackages)
+		if err != nil {
+			panic(err)
+		}
+
+		var unknown []string
+		deps, unknown = listedDeps(deps, list)
+
+		for _, p := range unknown {
+			fmt.Fprintf(output, "[!] %s isn't provided by any dependency in the manifest, so it can't be verified\n", p)
+			report.Problems = append(report.Problems, fmt.Sprintf("%s isn't in the manifest", p))
+			failed = true
+		}
+
+		fmt.Fprintf(output, "# Verifying %d dependencies providing the %d listed packages\n", len(deps), len(list))
+	}
+
+	var tainted map[string]bool
+	if *taintedBy != "" {
+		t, err := taintedPackages(*vendorPath, *taintedBy, *includeTests)
+		if err != nil {
+			panic(err)
+		}
+
+		tainted = t
+		deps = taintedDeps(deps, tainted)
+
+		fmt.Fprintf(output, "# Verifying %d dependencies with %d packages affected by %s\n", len(deps), len(tainted), *taintedBy)
+	}
+
+	if *sbomPath != "" && *resolveOnly == "" {
+		fmt.Fprintf(output, "# Checking dependencies against the SBOM\n")
+
+		modules, err := readSBOM(*sbomPath)
+		if err != nil {
+			panic(err)
+		}
+
+		// Every dependency is checked, not just those being verified, or
+		// the rest of the SBOM would look like it wasn't vendored.
+		all := manifest.Deps()
+		if *lenient {
+			all = dedupeDeps(all)
+		}
+
+		// The repositories aren't known yet, but only tags in subdirectories
+		// need them, and SBOMs record versions rather than tags anyway.
+		revs := revResolverFor(manifest)
+		for i := range all {
+			all[i].Rev = revs.resolveRev(all[i], "")
+		}
+
+		for _, p := range checkSBOM(all, modules) {
+			fmt.Fprintf(output, "[!] %s\n", p)
+			report.Problems = append(report.Problems, p)
+			failed = true
+		}
+	}
+
+	if *checkUsageFlag && *resolveOnly == "" {
+		fmt.Fprintf(output, "# Checking vendored packages against imports\n")
+
+		project := ""
+		if p, ok := manifest.(importPather); ok {
+			project = p.ProjectImportPath()
+		}
+
+		problems, err := checkUsage(project, deps, *vendorPath, *includeTests)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, p := range problems {
+			fmt.Fprintf(output, "[!] %s\n", p)
+			report.Problems = append(report.Problems, p)
+			failed = true
+		}
+	}
+
+	if *resolveOnly == "" {
+		found, err := findVCSMetadata(tree, *vendorPath)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, p := range found {
+			fmt.Fprintf(output, "[!] Found version control metadata in the vendor directory at %s\n", p)
+
+			if *strict {
+				report.Problems = append(report.Problems, fmt.Sprintf("version control metadata at %s", p))
+				failed = true
+			}
+		}
+
+		for _, d := range deps {
+			ok, err := hasFiles(tree, filepath.Join(*vendorPath, filepath.FromSlash(d.ImportPath)))
+			if err != nil {
+				panic(err)
+			}
+
+			if !ok {
+				fmt.Fprintf(output, "[!] %s is in the manifest, but nothing is vendored for it\n", d.ImportPath)
+
+				if *strict {
+					report.Problems = append(report.Problems, fmt.Sprintf("nothing vendored for %s", d.ImportPath))
+					failed = true
+				}
+			}
+		}
+	}
+
+	repos := make(map[string]*repository)
+
+	var resolver *resolutionCache
+	if *useResolution != "" {
+		resolver, err = loadFixedResolution(*useResolution)
+	} else {
+		resolver, err = loadResolutionCache(filepath.Join(*cachePath, "vendor-verify-resolution.json"))
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	// resolved collects the results for -resolve-only, which only includes
+	// the import paths in this manifest.
+	resolved := resolutionCache{path: *resolveOnly, entries: make(map[string]resolution)}
+
+	// overridden holds the repositories given with -repo-root-override,
+	// which are trusted to be where they're said to be, for -moved-repos.
+	overridden := make(map[string]bool)
+
+	replaces, _ := manifest.(replacer)
+	revs := revResolverFor(manifest)
+
+	// mapped is the mapping for -record-mapping and -previous-mapping.
+	mapped := mapping{Time: time.Now(), Manifest: *manifestPath}
+
+	fmt.Fprintf(output, "# Resolving package urls to repositories\n")
+	for _, d := range deps {
+		if replaces != nil {
+			if r, ok := replaces.replacement(d.ImportPath, d.Comment); ok {
+				repo, rd, err := replacedRepository(resolver, d, r, filepath.Dir(*manifestPath), *refreshResolution)
+				if err != nil {
+					resolver.save()
+					panic(&ResolutionError{ImportPath: r.New, Err: err})
+				}
+
+				if *verbose {
+					fmt.Fprintf(output, "%s is replaced by %s, verifying it against %s\n", d.ImportPath, strings.TrimSpace(r.New+" "+r.NewVersion), repo.Root.Repo)
+				}
+
+				if repo.LocalDir == "" {
+					resolved.entries[r.New] = resolution{Root: repo.Root.Root, Repo: repo.Root.Repo, VCS: repo.Root.VCS.Cmd, Time: time.Now()}
+				}
+
+				mapped.Dependencies = append(mapped.Dependencies, mappedDep{ImportPath: d.ImportPath, Root: repo.Root.Root, Repo: repo.Root.Repo, Rev: rd.Rev, Version: rd.Comment})
+
+				if existing := repos[repo.Name]; existing == nil {
+					repos[repo.Name] = repo
+				} else if existing.Root.Repo != repo.Root.Repo {
+					panic(&ResolutionError{ImportPath: d.ImportPath, Err: fmt.Errorf("it's vendored in %s, which is also vendored from %s", repo.Name, existing.Root.Repo)})
+				}
+				repos[repo.Name].add(rd)
+
+				continue
+			}
+		}
+
+		rr, err := resolver.resolve(d.ImportPath, *refreshResolution)
+		if err != nil {
+			resolver.save()
+			panic(&ResolutionError{ImportPath: d.ImportPath, Err: err})
+		}
+
+		// An override is trusted to point wherever it says.
+		if _, overridden := rootOverrides[d.ImportPath]; *noRedirect && !overridden {
+			if err := checkSameHost(d.ImportPath, rr); err != nil {
+				resolver.save()
+				panic(&ResolutionError{ImportPath: d.ImportPath, Err: err})
+			}
+		}
+
+		if _, ok := rootOverrides[d.ImportPath]; ok {
+			overridden[rr.Repo] = true
+		}
+
+		resolved.entries[d.ImportPath] = resolution{Root: rr.Root, Repo: rr.Repo, VCS: rr.VCS.Cmd, Time: time.Now()}
+
+		if repos[rr.Root] == nil {
+			repos[rr.Root] = &repository{Name: rr.Root, Root: rr}
+		} else if repos[rr.Root].Root.Repo != rr.Repo {
+			panic(&ResolutionError{ImportPath: d.ImportPath, Err: fmt.Errorf("it's vendored in %s, which is also vendored from %s", rr.Root, repos[rr.Root].Root.Repo)})
+		}
+
+		d.Rev = revs.resolveRev(d, rr.Root)
+		repos[rr.Root].add(d)
+
+		mapped.Dependencies = append(mapped.Dependencies, mappedDep{ImportPath: d.ImportPath, Root: rr.Root, Repo: rr.Repo, Rev: d.Rev, Version: d.Comment})
+	}
+
+	if err := resolver.save(); err != nil {
+		panic(err)
+	}
+
+	if *recordMapping != "" {
+		p := mappingFile(*recordMapping, mapped.Time)
+		if err := mapped.save(p); err != nil {
+			panic(err)
+		}
+
+		if *verbose {
+			fmt.Fprintf(output, "wrote the dependency mapping to %s\n", p)
+		}
+	}
+
+	if *previousMapping != "" {
+		previous, err := readMapping(*previousMapping)
+		if err != nil {
+			panic(err)
+		}
+
+		changes := mapped.diff(previous)
+
+		fmt.Fprintf(output, "# Dependency changes since %s (%s)\n", *previousMapping, previous.Time.Format("2006-01-02"))
+		for _, l := range changes {
+			fmt.Fprintf(output, "%s\n", l)
+		}
+		if len(changes) == 0 {
+			fmt.Fprintf(output, "none\n")
+		}
+	}
+
+	if *resolveOnly != "" {
+		if err := resolved.save(); err != nil {
+			panic(err)
+		}
+
+		fmt.Fprintf(output, "# Wrote %d resolved import paths to %s\n", len(resolved.entries), *resolveOnly)
+		return
+	}
+
+	// A repository being worked on locally is compared with the working tree,
+	// whatever revision it's pinned at.
+	for name, dir := range localSources {
+		if repo := repos[name]; repo != nil {
+			repo.LocalDir = dir
+		} else {
+			fmt.Fprintf(output, "[!] -local-src names %s, which nothing is vendored from\n", name)
+		}
+	}
+
+	// The config can have a repository compared against a local directory
+	// too, unless -local-src already names one.
+	for name, rc := range cfg.Repositories {
+		repo := repos[name]
+		switch {
+		case rc.Source == "":
+		case repo == nil:
+			fmt.Fprintf(output, "[!] The config has a Source for %s, which nothing is vendored from\n", name)
+		case rc.Source == "local" && repo.LocalDir == "":
+			repo.LocalDir = rc.LocalPath
+		}
+	}
+
+	for name, revs := range acceptRevs {
+		repo := repos[name]
+		switch {
+		case repo == nil:
+			fmt.Fprintf(output, "[!] -accept-rev names %s, which nothing is vendored from\n", name)
+		case repo.LocalDir != "":
+			fmt.Fprintf(output, "[!] -accept-rev names %s, which is compared against a local directory, so it has no other revisions\n", name)
+		default:
+			for _, rev := range revs {
+				if repo.checkout(rev) == nil {
+					repo.Accepted = append(repo.Accepted, &checkout{Rev: rev, Version: rev})
+				}
+			}
+		}
+	}
+
+	// Every repository has to be in a snapshot given with -upstream-root, so
+	// they're all looked for before anything's compared.
+	if *upstreamRoot != "" {
+		var missing []string
+		for _, repo := range repos {
+			if repo.LocalDir != "" {
+				continue
+			}
+
+			dir := filepath.Join(*upstreamRoot, filepath.FromSlash(repo.cacheName()))
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				missing = append(missing, repo.cacheName())
+				continue
+			}
+
+			repo.LocalDir = dir
+		}
+		sort.Strings(missing)
+
+		for _, name := range missing {
+			fmt.Fprintf(output, "[!] %s isn't in the upstream snapshot at %s\n", name, *upstreamRoot)
+		}
+
+		if len(missing) > 0 {
+			panic(fmt.Errorf("%d repositories are missing from the upstream snapshot at %q: %s", len(missing), *upstreamRoot, strings.Join(missing, ", ")))
+		}
+	}
+
+	var hashes treeHashes
+	if *treeHashPath != "" {
+		h, err := readTreeHashes(*treeHashPath)
+		if err != nil {
+			panic(err)
+		}
+
+		hashes = h
+	}
+
+	// Maps are iterated in a random order, so keep a sorted list of repository
+	// names to make the output the same from one run to the next. Within each
+	// repository, filepath.Walk already visits files in lexical order.
+	names := make([]string, 0, len(repos))
+	for name := range repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if *pinFile != "" {
+		p, err := readPins(*pinFile)
+		if err != nil {
+			panic(err)
+		}
+
+		var problems []string
+		for _, name := range names {
+			problems = append(problems, p.check(repos[name])...)
+		}
+
+		if len(problems) > 0 {
+			panic(fmt.Errorf("manifest %q doesn't match pin file %q: %s", *manifestPath, *pinFile, strings.Join(problems, "; ")))
+		}
+	}
+
+	checkouts := 0
+	for _, name := range names {
+		repo := repos[name]
+
+		repo.Report = &RepositoryReport{Root: name, Repo: repo.Root.Repo, Rev: repo.Checkouts[0].Rev}
+		report.Repositories = append(report.Repositories, repo.Report)
+
+		// A repository needed at more than one revision gets a separate
+		// checkout for each of them.
+		nested := repo.insideAnother(repos)
+		for _, co := range repo.Checkouts {
+			co.Dir = cfg.repositoryCachePath(repo.cacheName(), nested)
+			if len(repo.Checkouts) > 1 || *immutableCache {
+				co.Dir += "@" + co.Rev
+			}
+		}
+		for _, co := range repo.Accepted {
+			co.Dir = cfg.repositoryCachePath(repo.cacheName(), nested) + "@" + co.Rev
+		}
+
+		checkouts += len(repo.Checkouts) + len(repo.Accepted)
+	}
+
+	var project *projectState
+	var st *state
+	vendorHashes := make(map[string]string)
+
+	if *incremental || *resume || *checkDowngrades {
+		s, err := loadState(filepath.Join(*cachePath, "vendor-verify-state.json"))
+		if err != nil {
+			panic(err)
+		}
+
+		p, err := s.project(*vendorPath)
+		if err != nil {
+			panic(err)
+		}
+
+		st, project = s, p
+	}
+
+	if *incremental || *resume {
+		for _, name := range names {
+			repo := repos[name]
+
+			h, err := hashTree(tree, filepath.Join(*vendorPath, name))
+			if err != nil {
+				panic(err)
+			}
+			vendorHashes[name] = h
+
+			switch {
+			// A local directory has no revision to tell whether it changed.
+			case repo.LocalDir != "":
+				continue
+			case *incremental && project.Repositories[name].unchanged(repo.revs(), h):
+				if *verbose {
+					fmt.Fprintf(output, "skipping %s, unchanged since it last passed\n", name)
+				}
+			case *resume && project.Interrupted[name].unchanged(repo.revs(), h):
+				if *verbose {
+					fmt.Fprintf(output, "skipping %s, it passed before the last run was interrupted\n", name)
+				}
+
+				if *incremental {
+					project.Repositories[name] = project.Interrupted[name]
+				}
+			default:
+				continue
+			}
+
+			repo.Skip = true
+			repo.Report.Skipped = true
+			checkouts -= len(repo.Checkouts) + len(repo.Accepted)
+		}
+	}
+
+	var store checkoutStore
+	if *storePath != "" && !*againstHead {
+		s, err := openStore(*storePath)
+		if err != nil {
+			panic(err)
+		}
+
+		store = s
+	}
+
+	// checkOut gets a copy of the repository at co's revision into co.Dir, one
+	// way or another.
+	// moved holds where each repository has moved to, or "", so each is only
+	// checked once.
+	moved := make(map[string]string)
+
+	// checkMoved asks a repository that's about to be cloned or fetched
+	// whether it's moved, for -moved-repos, and returns where to, or "".
+	checkMoved := func(name, repo string) (string, error) {
+		if to, ok := moved[repo]; ok {
+			return to, nil
+		}
+
+		to, err := movedTo(ctx, repo)
+		if err != nil {
+			// The clone will fail too if the host can't be reached, and say
+			// why.
+			fmt.Fprintf(output, "couldn't check whether %s has moved: %s\n", repo, err)
+		}
+		moved[repo] = to
+
+		if to == "" {
+			return "", nil
+		}
+
+		switch *movedRepos {
+		case "fail":
+			return "", fmt.Errorf("%s has moved to %s", repo, to)
+		case "accept":
+			fmt.Fprintf(output, "%s has moved to %s, verifying against it there\n", repo, to)
+			moved[to] = ""
+		default:
+			fmt.Fprintf(output, "[!] %s has moved to %s, which git follows, so %s is verified against what's there now\n", repo, to, name)
+		}
+
+		return to, nil
+	}
+
+	checkOut := func(name string, repo *repository, co *checkout) error {
+		root := repo.Root
+
+		if repo.LocalDir != "" {
+			if *verbose {
+				fmt.Fprintf(output, "using %q from the local directory %q\n", name, repo.LocalDir)
+			}
+
+			co.Dir, co.URL, co.Type = repo.LocalDir, repo.LocalDir, "local"
+			return nil
+		}
+
+		if src, ok := imageSources[name]; ok {
+			dir := filepath.Join(*cachePath, "vendor-verify-image", name)
+
+			if *verbose {
+				fmt.Fprintf(output, "using %q from %s in the image %s\n", name, src.Path, src.Image)
+			}
+
+			if err := extractImageSource(ctx, src, dir); err != nil {
+				return atStage(stageDownload, err)
+			}
+
+			co.Dir, co.URL, co.Type = dir, src.Image+":"+src.Path, "image"
+			return nil
+		}
+
+		if base, ok := httpSources[name]; ok {
+			dir := filepath.Join(*cachePath, "vendor-verify-http", name+"@"+co.Rev)
+
+			if *verbose {
+				fmt.Fprintf(output, "using %q rev %s from the file tree at %s\n", name, co.Rev, base)
+			}
+
+			blobs, err := vendoredBlobs(tree, filepath.Join(*vendorPath, name), repo.nestedRoots(repos))
+			if err != nil {
+				return err
+			}
+
+			var vendored []string
+			for p := range blobs {
+				vendored = append(vendored, p)
+			}
+
+			var dirs []string
+			for _, pd := range repo.packageDirs(true) {
+				if pd.Checkout == co {
+					dirs = append(dirs, pd.Dir)
+				}
+			}
+
+			if err := fetchHTTPSource(ctx, base, co.Rev, vendored, dirs, dir); err != nil {
+				return atStage(stageDownload, err)
+			}
+
+			co.Dir, co.URL, co.Type = dir, strings.Replace(base, "{rev}", co.Rev, -1), "http"
+			return nil
+		}
+
+		// The module paths are those of the module being replaced, so a
+		// replacement is always cloned.
+		if cfg.uses(name, "modcache", *useModCache) && !*againstHead && repo.Replacement == "" {
+			for _, module := range repo.modulePaths(co) {
+				if dir, ok := findCachedModule(module, co.Version); ok {
+					if *verbose {
+						fmt.Fprintf(output, "using %q from the module cache at %q\n", module, dir)
+					}
+
+					co.Dir, co.Subdir = dir, strings.TrimPrefix(strings.TrimPrefix(module, name), "/")
+					co.URL, co.Type = dir, "modcache"
+					return nil
+				}
+			}
+		}
+
+		// A repository the config has taken from the module cache isn't
+		// cloned instead.
+		if cfg.source(name) == "modcache" {
+			return atStage(stageDownload, fmt.Errorf("%s at %s isn't in the module cache", name, co.Version))
+		}
+
+		if *goProxy != "" && cfg.source(name) == "" && !*againstHead && strings.HasPrefix(co.Version, "v") && repo.Replacement == "" {
+			module, dir, err := downloadFromProxy(ctx, *goProxy, repo.modulePaths(co), co.Version, filepath.Join(*cachePath, "vendor-verify-proxy"))
+			if err != nil {
+				return atStage(stageDownload, err)
+			}
+
+			if *verbose {
+				fmt.Fprintf(output, "using %q from the module proxy at %q\n", module, dir)
+			}
+
+			co.Dir, co.Subdir = dir, strings.TrimPrefix(strings.TrimPrefix(module, name), "/")
+			co.URL, co.Type = *goProxy+" "+module+"@"+co.Version, "goproxy"
+			return nil
+		}
+
+		if *goModDownload && cfg.source(name) == "" && !*againstHead && strings.HasPrefix(co.Version, "v") && repo.Replacement == "" {
+			module, dir, err := downloadWithGo(ctx, repo.modulePaths(co), co.Version, modSums, filepath.Join(*cachePath, "vendor-verify-download"))
+			if err != nil {
+				return atStage(stageDownload, err)
+			}
+
+			if *verbose {
+				fmt.Fprintf(output, "using %q from go mod download at %q, which matches go.sum\n", module, dir)
+			}
+
+			co.Dir, co.Subdir = dir, strings.TrimPrefix(strings.TrimPrefix(module, name), "/")
+			co.URL, co.Type = module+"@"+co.Version, "go-mod-download"
+			return nil
+		}
+
+		var key string
+		// A pull request can be pushed to, so its head is never reused from
+		// the store, archives or the immutable cache.
+		if store != nil && !isPullRef(co.Rev) {
+			key = storeKey(repo.cacheName(), co.Rev)
+			dir := filepath.Join(*cachePath, "vendor-verify-store", key)
+
+			_, err := os.Stat(dir)
+			ok := err == nil
+			if !ok {
+				ok, err = fetchFromStore(store, key, dir)
+				if err != nil {
+					return atStage(stageDownload, err)
+				}
+			}
+
+			if ok {
+				if *verbose {
+					fmt.Fprintf(output, "using %q rev %s from the store at %q\n", name, co.Rev, dir)
+				}
+
+				co.Dir, co.URL, co.Type, co.Cached = dir, *storePath+" "+key, "store", true
+				return nil
+			}
+		}
+
+		if cfg.source(name) == "tarball" {
+			u := strings.Replace(cfg.Repositories[name].Tarball, "{rev}", co.Rev, -1)
+			dir := filepath.Join(*cachePath, "vendor-verify-tarball", name+"@"+co.Rev)
+
+			if err := downloadArchive(ctx, u, dir); err != nil {
+				return atStage(stageDownload, err)
+			}
+
+			if *verbose {
+				fmt.Fprintf(output, "using %q rev %s from the tarball at %q\n", name, co.Rev, dir)
+			}
+
+			co.Dir, co.URL, co.Type = dir, u, "tarball"
+			return nil
+		}
+
+		if cfg.uses(name, "archive-api", *githubArchive) && !*againstHead && !isPullRef(co.Rev) {
+			u, ok := githubArchiveURL(root.Repo, co.Rev)
+			if !ok && cfg.source(name) == "archive-api" {
+				return fmt.Errorf("%s isn't hosted on GitHub, so it has no archive to download", name)
+			}
+
+			if ok {
+				dir := filepath.Join(*cachePath, "vendor-verify-archive", name+"@"+co.Rev)
+
+				err := downloadArchive(ctx, u, dir)
+				if err == nil {
+					if *verbose {
+						fmt.Fprintf(output, "using %q rev %s from the GitHub archive at %q\n", name, co.Rev, dir)
+					}
+
+					co.Dir, co.URL, co.Type = dir, u, "github-archive"
+					return nil
+				}
+
+				// Only -github-archive falls back to cloning, as the config
+				// asked for the archive of this one.
+				if ctx.Err() != nil || cfg.source(name) == "archive-api" {
+					return atStage(stageDownload, err)
+				}
+
+				fmt.Fprintf(output, "couldn't download the GitHub archive of %s, cloning it instead: %s\n", name, err)
+			}
+		}
+
+		dir := co.Dir
+
+		if err := lockCheckout(ctx, dir); err != nil {
+			return err
+		}
+
+		sealed := false
+		if *immutableCache && !isPullRef(co.Rev) {
+			s, err := checkSealed(dir)
+			if err != nil {
+				return err
+			}
+
+			sealed = s
+		}
+
+		if *verbose {
+			if sealed {
+				fmt.Fprintf(output, "using %q rev %s from the immutable cache at %q\n", name, co.Rev, dir)
+			} else {
+				fmt.Fprintf(output, "downloading %q rev %s to %q\n", name, co.Rev, dir)
+			}
+		}
+
+		if root.VCS.Name != "Git" {
+			return fmt.Errorf("currently we can only verify git dependencies")
+		}
+
+		// A resolution file is used where the network is limited to what's
+		// cloned, and the immutable cache isn't fetched into.
+		if *movedRepos != "ignore" && *useResolution == "" && !sealed && !overridden[root.Repo] {
+			to, err := checkMoved(name, root.Repo)
+			if err != nil {
+				return err
+			}
+
+			if to != "" && *movedRepos == "accept" {
+				accepted := *root
+				accepted.Repo = to
+				repo.Root, root = &accepted, &accepted
+			}
+		}
+
+		if st, err := os.Stat(dir); err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+
+			if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+				return err
+			}
+
+			cloning = dir
+			if local := cfg.Repositories[name].LocalRepository; local != "" {
+				if err := gitWorktreeAdd(ctx, local, dir); err != nil {
+					return atStage(stageClone, err)
+				}
+
+				if !gitHasCommit(ctx, dir, co.Rev) {
+					if err := fetchWithFallback(ctx, dir, cfg.Repositories[name].FallbackRemotes); err != nil {
+						return atStage(stageFetch, err)
+					}
+				}
+			} else {
+				since := *shallowSince
+				if since == "auto" {
+					since = ""
+					// Leave a day's leeway, in case the time in the
+					// pseudo-version was rounded or in a different zone.
+					if t, ok := pseudoVersionTime(co.Version); ok {
+						since = t.Add(-24 * time.Hour).Format("2006-01-02")
+					}
+				}
+
+				err := cloneWithFallback(ctx, dir, root.Repo, since, *cloneDepth, cfg.Repositories[name].FallbackRemotes)
+				if err != nil && since != "" && ctx.Err() == nil {
+					// git refuses to make a shallow clone with no commits in
+					// it, so fall back to a full one.
+					fmt.Fprintf(output, "couldn't clone %s since %s (%s), cloning all of it instead\n", name, since, err)
+
+					if err := os.RemoveAll(dir); err != nil {
+						return err
+					}
+
+					err = cloneWithFallback(ctx, dir, root.Repo, "", *cloneDepth, cfg.Repositories[name].FallbackRemotes)
+				}
+				if err != nil {
+					return atStage(stageClone, err)
+				}
+
+			}
+			cloning = ""
+		} else if !sealed && st.IsDir() && isPartialClone(ctx, dir) {
+			// Whatever was fetched before is kept, and only the rest is
+			// fetched now.
+			fmt.Fprintf(output, "%s wasn't cloned completely, fetching the rest of it\n", name)
+
+			if err := fetchWithFallback(ctx, dir, cfg.Repositories[name].FallbackRemotes); err != nil {
+				return atStage(stageFetch, err)
+			}
+
+			if err := gitSetRemoteHead(ctx, dir); err != nil {
+				return err
+			}
+		} else {
+			if !st.IsDir() {
+				return fmt.Errorf("%q should be a directory", dir)
+			}
+
+			co.Cached = true
+
+			rev, err := gitHead(ctx, dir)
+			if err != nil {
+				return err
+			}
+
+			if sealed && !strings.HasPrefix(strings.TrimSpace(string(rev)), co.Rev) {
+				return fmt.Errorf("cache entry %q was checked out at %s, but is now at %s", dir, co.Rev, strings.TrimSpace(string(rev)))
+			}
+
+			if !sealed && (*againstHead || *upstreamLog || !strings.HasPrefix(strings.TrimSpace(string(rev)), co.Rev)) {
+				if err := fetchWithFallback(ctx, dir, cfg.Repositories[name].FallbackRemotes); err != nil {
+					return atStage(stageFetch, err)
+				}
+			}
+		}
+
+		// The URL is asked of git, as that's what -git-config and fallback
+		// remotes change.
+		if *reportRepoURLs {
+			u, err := gitRemoteURL(ctx, dir)
+			if err != nil {
+				return err
+			}
+
+			co.URL, co.Type = u, "git"
+		}
+
+		if *verbose || maxSize > 0 {
+			size, err := dirSize(dir)
+			if err != nil {
+				return err
+			}
+
+			if *verbose {
+				fmt.Fprintf(output, "%s takes up %s on disk\n", dir, formatByteSize(size))
+			}
+
+			if maxSize > 0 && size > maxSize {
+				return fmt.Errorf("checkout takes up %s, more than -max-repo-size of %s", formatByteSize(size), formatByteSize(maxSize))
+			}
+		}
+
+		if *againstHead {
+			count, err := gitCountCommits(ctx, dir, co.Rev, "origin/HEAD")
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(output, "%s is %s commits behind upstream HEAD\n", name, strings.TrimSpace(string(count)))
+
+			if err := gitCheckout(ctx, dir, "origin/HEAD"); err != nil {
+				return atStage(stageCheckout, err)
+			}
+
+			head, err := gitHead(ctx, dir)
+			if err != nil {
+				return err
+			}
+
+			// The report names the commit that was compared, not the pinned
+			// one.
+			repo.Report.Rev = strings.TrimSpace(string(head))
+
+			return nil
+		}
+
+		if !sealed {
+			if isPullRef(co.Rev) {
+				if err := gitFetchPullRef(ctx, dir, co.Rev); err != nil {
+					return atStage(stageFetch, err)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, ".git", "shallow")); err == nil && !gitHasCommit(ctx, dir, co.Rev) {
+				fmt.Fprintf(output, "%s at %s isn't in the shallow clone, fetching more of its history\n", name, co.Version)
+
+				step := *cloneDepth
+				if step <= 0 {
+					step = defaultDeepen
+				}
+
+				if err := deepenFor(ctx, dir, co.Rev, step); err != nil {
+					return atStage(stageFetch, err)
+				}
+			}
+
+			if !isPullRef(co.Rev) && !gitHasCommit(ctx, dir, co.Rev) {
+				if !*allowMissingRev {
+					return fmt.Errorf("pinned revision %s no longer exists upstream; it was probably removed by a force push", co.Rev)
+				}
+
+				var expected string
+				if hashes != nil {
+					expected, _ = hashes.lookup(name, co.Version, co.Rev)
+				}
+
+				blobs, err := vendoredBlobs(tree, filepath.Join(*vendorPath, name), repo.nestedRoots(repos))
+				if err != nil {
+					return err
+				}
+
+				closest, matching, err := closestCommit(ctx, dir, blobs, expected)
+				if err != nil {
+					return err
+				}
+
+				if closest == "" {
+					return fmt.Errorf("pinned revision %s no longer exists upstream, and no other commit has any of the vendored files", co.Rev)
+				}
+
+				fmt.Fprintf(output, "[!] %s is pinned at %s, which no longer exists upstream; comparing against %s instead, which has %d of the %d vendored files\n", name, co.Version, closest, matching, len(blobs))
+				repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("%s no longer exists upstream, compared against %s instead", co.Version, closest))
+				co.Substitute = closest
+			}
+
+			if err := gitCheckout(ctx, dir, co.commit()); err != nil {
+				return atStage(stageCheckout, err)
+			}
+
+			if *immutableCache && !isPullRef(co.Rev) && co.Substitute == "" {
+				if err := seal(dir); err != nil {
+					return err
+				}
+			}
+		}
+
+		if key != "" && !sealed && co.Substitute == "" {
+			if err := saveToStore(store, key, dir); err != nil {
+				return err
+			}
+		}
+
+		// The checkout itself is still used for the checks below, which
+		// need its history.
+		if *useGitArchive {
+			head, err := gitHead(ctx, dir)
+			if err != nil {
+				return err
+			}
+
+			archive := filepath.Join(*cachePath, "vendor-verify-git-archive", name+"@"+strings.TrimSpace(string(head)))
+			if *verbose {
+				fmt.Fprintf(output, "comparing %q rev %s against its git archive at %q\n", name, co.Rev, archive)
+			}
+
+			if err := extractGitArchive(ctx, dir, "HEAD", archive); err != nil {
+				return err
+			}
+
+			co.Dir = archive
+		}
+
+		// Accepted revisions are only compared against, so they aren't
+		// held to what the pinned ones are.
+		if repo.isAccepted(co) {
+			return nil
+		}
+
+		if *requireTags {
+			tag, err := gitDescribeTag(ctx, dir, co.commit())
+			if err != nil {
+				return err
+			}
+
+			if tag == "" {
+				fmt.Fprintf(output, "[!] %s is pinned at %s, which isn't a tagged release\n", name, co.Version)
+				repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("%s isn't a tagged release", co.Version))
+				failed = true
+			} else if *verbose {
+				fmt.Fprintf(output, "%s at %s is tagged %s\n", name, co.Version, tag)
+			}
+		}
+
+		if hashes != nil {
+			expected, ok := hashes.lookup(name, co.Version, co.Rev)
+			if !ok {
+				fmt.Fprintf(output, "[!] No expected tree hash recorded for %s at %s\n", name, co.Version)
+				repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("no expected tree hash recorded for %s", co.Version))
+				failed = true
+				return nil
+			}
+
+			tree, err := gitTreeHash(ctx, dir, co.commit())
+			if err != nil {
+				return err
+			}
+
+			if actual := strings.TrimSpace(string(tree)); actual != expected {
+				fmt.Fprintf(output, "[!] Tree hash of %s at %s is %s, expected %s\n", name, co.Version, actual, expected)
+				repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("tree hash at %s is %s, expected %s", co.Version, actual, expected))
+				failed = true
+			} else if *verbose {
+				fmt.Fprintf(output, "tree hash of %s at %s matches %s\n", name, co.Version, expected)
+			}
+		}
+
+		return nil
+	}
+
+	fmt.Fprintf(output, "# Checking out %d repositories locally\n", checkouts)
+	// madeCheckouts and cacheHits are for -metrics-output.
+	var madeCheckouts, cacheHits int
+	for _, name := range names {
+		repo := repos[name]
+
+		if repo.Skip {
+			continue
+		}
+
+		for _, co := range append(append([]*checkout(nil), repo.Checkouts...), repo.Accepted...) {
+			began := time.Now()
+			err := checkOut(name, repo, co)
+			repo.Report.checkoutTime += time.Since(began)
+
+			if err != nil {
+				ce := newCheckoutError(name, co.Version, err)
+
+				// An interrupted clone is removed on the way out, but one
+				// that failed has to be removed here, whether or not the run
+				// carries on, or the next run would find it in the cache.
+				if cloning != "" && ctx.Err() == nil {
+					removeCheckout(ctx, cloning)
+					cloning = ""
+				}
+
+				if !(*keepGoing || *failOn == "mismatch") || ctx.Err() != nil {
+					panic(ce)
+				}
+
+				fmt.Fprintf(output, "[!] Couldn't check out %s at %s: %s\n", name, co.Version, ce.reason())
+				repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("couldn't check out %s: %s", co.Version, ce.reason()))
+				repo.Report.Unchecked = true
+				report.InfraFailures = append(report.InfraFailures, &InfraFailure{
+					Root:   name,
+					Repo:   repo.Root.Repo,
+					Rev:    co.Version,
+					Stage:  ce.Stage,
+					Error:  ce.Err.Error(),
+					Stderr: ce.Stderr,
+				})
+				repo.Broken = true
+				infraFailures++
+				break
+			}
+
+			if err := touchCacheEntry(co.Dir); err != nil {
+				panic(err)
+			}
+
+			madeCheckouts++
+			if co.Cached {
+				cacheHits++
+			}
+		}
+	}
+
+	if *reportRepoURLs {
+		fmt.Fprintf(output, "# Repository URLs\n")
+
+		for _, name := range names {
+			repo := repos[name]
+
+			if repo.Skip || repo.Broken {
+				continue
+			}
+
+			for _, co := range append(append([]*checkout(nil), repo.Checkouts...), repo.Accepted...) {
+				src := &CheckoutSource{Rev: co.Rev, Type: co.Type, URL: hidePassword(co.URL)}
+				if co.Type == "git" && co.URL != repo.Root.Repo {
+					src.Resolved = hidePassword(repo.Root.Repo)
+				}
+				repo.Report.Sources = append(repo.Report.Sources, src)
+
+				if src.Resolved != "" {
+					fmt.Fprintf(output, "%s at %s: %s %s, resolved as %s\n", name, co.Version, src.Type, src.URL, src.Resolved)
+				} else {
+					fmt.Fprintf(output, "%s at %s: %s %s\n", name, co.Version, src.Type, src.URL)
+				}
+			}
+		}
+	}
+
+	if *checkDowngrades {
+		for _, name := range names {
+			repo := repos[name]
+
+			if repo.Skip || repo.Broken {
+				continue
+			}
+
+			for _, co := range repo.Checkouts {
+				for _, previous := range project.Revisions[name] {
+					older, err := isDowngrade(ctx, co, previous)
+					if err != nil {
+						panic(err)
+					}
+
+					if older {
+						fmt.Fprintf(output, "[!] %s is pinned at %s, which is older than %s, where it was pinned last time\n", name, co.Version, previous)
+					}
+				}
+			}
+		}
+
+		for _, name := range names {
+			project.Revisions[name] = repos[name].revs()
+		}
+
+		if err := st.save(); err != nil {
+			panic(err)
+		}
+	}
+
+	var tool *diffTool
+	if *diffToolCommand != "" {
+		if tool = newDiffTool(*diffToolCommand); tool == nil {
+			fmt.Fprintf(output, "couldn't find -diff-tool %q, using the built in diff\n", *diffToolCommand)
+		}
+	}
+
+	var validate *validator
+	if *validatorCommand != "" {
+		if validate, err = newValidator(*validatorCommand); err != nil {
+			panic(err)
+		}
+	}
+
+	filter, err := newFileFilter(".vendorverifyignore")
+	if err != nil {
+		panic(err)
+	}
+	filter.packages = tainted
+	filter.excludeDirs = excludeDirs.relativeTo(*vendorPath)
+	filter.platform = platformContext()
+
+	filter.vendorTool = *vendorTool
+	if filter.vendorTool == "" {
+		filter.vendorTool = "godep"
+		switch manifest.(type) {
+		case *goMod, *goWork:
+			filter.vendorTool = "gomod"
+		}
+	}
+	if filter.vendorTool != "godep" && filter.vendorTool != "gomod" {
+		panic(fmt.Errorf("unknown vendoring tool %q", filter.vendorTool))
+	}
+
+	// sampleTotal and sampleChecked count the files that could have been
+	// compared with -sample, and those that were.
+	sampleTotal, sampleChecked := 0, 0
+
+	fmt.Fprintf(output, "# Comparing file contents\n")
+	for _, name := range names {
+		repo := repos[name]
+		vendorPath := filepath.Join(*vendorPath, name)
+
+		if repo.Skip || repo.Broken {
+			continue
+		}
+
+		seen := make(map[string]bool)
+
+		// unreadableDirs are the directories that couldn't be read, with
+		// slashes, which can't be looked in for missing files.
+		var unreadableDirs []string
+
+		// unreadable reports a file or directory that couldn't be read, with
+		// -keep-going, in place of comparing it.
+		unreadable := func(relativePath string, err error) {
+			if !failed {
+				fmt.Fprintf(output, "\n")
+			}
+
+			fmt.Fprintf(output, "[!] Couldn't read %s: %s\n", filepath.Join(name, relativePath), err)
+
+			failed = true
+
+			repo.Report.Files = append(repo.Report.Files, &FileReport{
+				Path:   relativePath,
+				Status: statusUnreadable,
+				Error:  err.Error(),
+			})
+		}
+
+		nested := repo.nestedRoots(repos)
+
+		var pending []*comparison
+		if err := tree.Walk(vendorPath, func(path string, fi os.FileInfo, err error) error {
+			// Nothing vendored at all has already been pointed out, and the
+			// source's files are all reported missing below.
+			if err != nil {
+				if os.IsNotExist(err) && path == vendorPath {
+					return nil
+				}
+
+				if os.IsPermission(err) && (*keepGoing || *failOn == "mismatch") && path != vendorPath {
+					relativePath := strings.TrimLeft(strings.TrimPrefix(path, vendorPath), "/")
+					unreadable(relativePath, err)
+					unreadableDirs = append(unreadableDirs, filepath.ToSlash(relativePath))
+					return filepath.SkipDir
+				}
+
+				return err
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			relativePath := strings.TrimLeft(strings.TrimPrefix(path, vendorPath), "/")
+
+			// Version control metadata has already been reported.
+			if vcsMetadataNames[fi.Name()] {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if fi.IsDir() {
+				if relativePath == "" {
+					return nil
+				}
+
+				// Another repository vendored under this one is compared
+				// on its own.
+				if nested[filepath.ToSlash(relativePath)] {
+					if *verbose {
+						fmt.Fprintf(output, "skipping %s/ (vendored from another repository)\n", filepath.Join(name, relativePath))
+					}
+
+					return filepath.SkipDir
+				}
+
+				reason, err := filter.excluded(name, "", relativePath, true)
+				if err != nil {
+					return err
+				}
+
+				if reason != "" {
+					if *verbose {
+						fmt.Fprintf(output, "skipping %s/ (%s)\n", filepath.Join(name, relativePath), reason)
+					}
+
+					return filepath.SkipDir
+				}
+
+				if *checkLayout && !repo.hasSourceDir(filepath.ToSlash(relativePath)) {
+					if !failed {
+						fmt.Fprintf(output, "\n")
+					}
+
+					fmt.Fprintf(output, "[!] Directory %s isn't in the source\n", filepath.Join(name, relativePath))
+					repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("directory %s isn't in the source", relativePath))
+
+					failed = true
+				}
+
+				return nil
+			}
+
+			seen[relativePath] = true
+
+			co := repo.checkoutFor(relativePath)
+
+			reason, err := filter.excluded(name, co.Dir, relativePath, false)
+			if err != nil {
+				return err
+			}
+
+			if reason != "" {
+				if *verbose {
+					fmt.Fprintf(output, "skipping %s (%s)\n", filepath.Join(name, relativePath), reason)
+				}
+
+				return nil
+			}
+
+			if window > 0 && repo.LocalDir == "" {
+				changed, ok := recent[co]
+				if !ok {
+					changed, err = co.recentlyChanged(ctx, window)
+					if err != nil {
+						return err
+					}
+					recent[co] = changed
+				}
+
+				if !changed[filepath.ToSlash(relativePath)] {
+					if *verbose {
+						fmt.Fprintf(output, "skipping %s (not changed upstream within %s)\n", filepath.Join(name, relativePath), *recentWindow)
+					}
+					repo.Report.skippedFiles = append(repo.Report.skippedFiles, relativePath)
+
+					return nil
+				}
+			}
+
+			if sampling {
+				sampleTotal++
+
+				if !inSample(name+"/"+filepath.ToSlash(relativePath), *sample, *seed) {
+					if *verbose {
+						fmt.Fprintf(output, "skipping %s (not in the sample)\n", filepath.Join(name, relativePath))
+					}
+					repo.Report.skippedFiles = append(repo.Report.skippedFiles, relativePath)
+
+					return nil
+				}
+			}
+
+			if *verbose {
+				fmt.Fprintf(output, "checking %s\n", filepath.Join(name, relativePath))
+			}
+
+			repo.Report.Checked++
+			sampleChecked++
+
+			pending = append(pending, &comparison{relativePath: relativePath, co: co, executable: fi.Mode().IsRegular() && fi.Mode()&0111 != 0, size: int(fi.Size())})
+
+			return nil
+		}); err != nil {
+			panic(err)
+		}
+
+		compareFiles(ctx, tree, vendorPath, pending, *threadsPerRepo, hashFunc)
+
+		if *detectDupes {
+			for _, c := range pending {
+				if c.sourceHash != nil {
+					vendored = append(vendored, vendoredFile{Path: filepath.Join(name, c.relativePath), VendoredHash: string(c.vendoredHash), SourceHash: string(c.sourceHash)})
+				}
+			}
+		}
+
+		if *profileFiles > 0 {
+			for _, c := range pending {
+				timings = append(timings, fileTiming{Path: filepath.Join(name, c.relativePath), Size: c.size, Elapsed: c.elapsed})
+			}
+		}
+
+		for _, c := range pending {
+			if ce, ok := c.err.(*ComparisonError); ok && os.IsPermission(ce.Err) && (*keepGoing || *failOn == "mismatch") {
+				unreadable(c.relativePath, ce.Err)
+				continue
+			}
+
+			if c.err != nil {
+				panic(c.err)
+			}
+
+			// A file that matches one of the accepted revisions instead of
+			// its own is always listed, so it's clear which it matched.
+			accepted := false
+			if !c.same && len(repo.Accepted) > 0 {
+				ok, err := c.matchAccepted(tree, vendorPath, repo.Accepted, hashFunc)
+				if err != nil {
+					panic(err)
+				}
+
+				accepted = ok
+				if ok {
+					file := filepath.ToSlash(c.relativePath)
+					repo.acceptedFiles = append(repo.acceptedFiles, acceptedFile{ImportPath: path.Join(name, path.Dir(file)), File: path.Base(file), Rev: c.co.Rev})
+				}
+			}
+
+			relativePath, co := c.relativePath, c.co
+			d1, d2 := c.vendored, c.source
+
+			if c.missing {
+				if !checkCategories.checks("extra") {
+					continue
+				}
+
+				if !failed {
+					fmt.Fprintf(output, "\n")
+				}
+
+				fmt.Fprintf(output, "[!] File %s isn't in the source\n", filepath.Join(name, relativePath))
+
+				failed = true
+
+				repo.Report.Files = append(repo.Report.Files, &FileReport{
+					Path:   relativePath,
+					Status: statusExtra,
+					Rev:    repo.fileRev(co),
+				})
+
+				if *emitPatch != "" {
+					p := filepath.Join(vendorPath, relativePath)
+					if c.streamed || !checkCategories.checks("modified") {
+						if d1, err = tree.ReadFile(p); err != nil {
+							panic(err)
+						}
+					}
+					if err := patch.add(filepath.ToSlash(p), d1, nil, gitFileMode(p), ""); err != nil {
+						panic(err)
+					}
+				}
+
+				if *fix {
+					p := filepath.Join(vendorPath, relativePath)
+					if err := applyFix("Removing "+p, "remove "+p, func() error { return os.Remove(p) }); err != nil {
+						panic(err)
+					}
+				}
+
+				fmt.Fprintf(output, "\n")
+
+				continue
+			}
+
+			if c.sourcePath != "" {
+				if !failed {
+					fmt.Fprintf(output, "\n")
+				}
+
+				fmt.Fprintf(output, "[!] File %s is named %s in the source\n", filepath.Join(name, relativePath), filepath.Join(name, c.sourcePath))
+				repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("%s is named %s in the source", relativePath, c.sourcePath))
+				seen[filepath.ToSlash(c.sourcePath)] = true
+
+				failed = true
+			}
+
+			// An executable that shouldn't be one is suspicious whether or not
+			// its contents match, so it's a problem of its own.
+			if checkCategories.checks("mode") && c.executable {
+				sourcePath := relativePath
+				if c.sourcePath != "" {
+					sourcePath = c.sourcePath
+				}
+				inner, _ := co.relative(sourcePath)
+
+				if gitFileMode(filepath.Join(co.Dir, inner)) != "100755" {
+					if !failed {
+						fmt.Fprintf(output, "\n")
+					}
+
+					fmt.Fprintf(output, "[!] File %s is executable, but its source isn't\n", filepath.Join(name, relativePath))
+					repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("%s is executable, but its source isn't", relativePath))
+
+					failed = true
+				}
+			}
+
+			if checkCategories.checks("symlink") {
+				sourcePath := relativePath
+				if c.sourcePath != "" {
+					sourcePath = c.sourcePath
+				}
+				inner, _ := co.relative(sourcePath)
+
+				difference, err := symlinkDifference(filepath.Join(vendorPath, relativePath), filepath.Join(co.Dir, inner))
+				if err != nil {
+					panic(err)
+				}
+
+				if difference != "" {
+					if !failed {
+						fmt.Fprintf(output, "\n")
+					}
+
+					fmt.Fprintf(output, "[!] File %s %s\n", filepath.Join(name, relativePath), difference)
+					repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("%s %s", relativePath, difference))
+
+					failed = true
+				}
+			}
+
+			// A file too big to diff within -max-memory is only reported
+			// with where it starts to differ.
+			if !c.same && c.streamed {
+				if !failed {
+					fmt.Fprintf(output, "\n")
+				}
+
+				fmt.Fprintf(output, "[!] File %s has changes from byte %d, and is too big to diff within -max-memory\n", filepath.Join(name, relativePath), c.differsAt)
+
+				failed = true
+
+				sourcePath := relativePath
+				if c.sourcePath != "" {
+					sourcePath = c.sourcePath
+				}
+				inner, _ := co.relative(sourcePath)
+
+				p, source := filepath.Join(vendorPath, relativePath), filepath.Join(co.Dir, inner)
+
+				truncated := ""
+				if fi, err := os.Stat(source); err == nil {
+					truncated = truncation(int64(c.size), fi.Size(), false)
+				}
+				if truncated != "" {
+					fmt.Fprintf(output, "[!] File %s is possibly truncated: %s\n", filepath.Join(name, relativePath), truncated)
+					truncatedFiles++
+				}
+
+				repo.Report.Files = append(repo.Report.Files, &FileReport{
+					Path:      relativePath,
+					Status:    statusModified,
+					Rev:       repo.fileRev(co),
+					Streamed:  true,
+					DiffersAt: c.differsAt,
+					Truncated: truncated,
+				})
+
+				if *emitPatch != "" {
+					d1, err := tree.ReadFile(p)
+					if err != nil {
+						panic(err)
+					}
+
+					d2, err := ioutil.ReadFile(source)
+					if err != nil {
+						panic(err)
+					}
+
+					if err := patch.add(filepath.ToSlash(p), d1, d2, gitFileMode(p), gitFileMode(source)); err != nil {
+						panic(err)
+					}
+				}
+
+				if *fix {
+					if err := applyFix("Restoring "+p+" from source", "restore "+p+" from source", func() error { return copyFile(source, p) }); err != nil {
+						panic(err)
+					}
+				}
+
+				fmt.Fprintf(output, "\n")
+
+				continue
+			}
+
+			same := c.same
+			if !same && *semanticConfig {
+				equal, err := semanticEqual(relativePath, d1, d2)
+				if err != nil {
+					fmt.Fprintf(output, "couldn't compare %s semantically, comparing bytes instead: %s\n", filepath.Join(name, relativePath), err)
+				}
+
+				if equal {
+					if *verbose {
+						fmt.Fprintf(output, "%s only differs from its source in formatting\n", filepath.Join(name, relativePath))
+					}
+
+					same = true
+				}
+			}
+
+			// Files that only match once their generator versions are ignored,
+			// or that -validator accepts, are always listed, so it's clear the
+			// comparison was relaxed.
+			relaxed := ""
+			if accepted {
+				relaxed = "matches accepted rev " + co.Version
+			}
+			if !same && *ignorePbVersion && strings.HasSuffix(relativePath, ".pb.go") && pbEqualIgnoringVersion(d1, d2) {
+				relaxed = "ignoring protoc versions"
+				same = true
+			}
+
+			if !same && validate != nil {
+				sourcePath := relativePath
+				if c.sourcePath != "" {
+					sourcePath = c.sourcePath
+				}
+				inner, _ := co.relative(sourcePath)
+				importPath := filepath.ToSlash(filepath.Dir(filepath.Join(name, relativePath)))
+
+				ok, err := validate.accepts(ctx, filepath.Join(vendorPath, relativePath), filepath.Join(co.Dir, inner), importPath)
+				if err != nil {
+					panic(fmt.Errorf("couldn't run -validator for %s: %s", filepath.Join(name, relativePath), err))
+				}
+
+				if ok {
+					relaxed = "accepted by -validator"
+					same = true
+				}
+			}
+
+			if same && (*reportUnchanged || relaxed != "") {
+				if relaxed != "" {
+					fmt.Fprintf(output, "ok %s (%s)\n", filepath.Join(name, relativePath), relaxed)
+				} else {
+					fmt.Fprintf(output, "ok %s\n", filepath.Join(name, relativePath))
+				}
+
+				repo.Report.Files = append(repo.Report.Files, &FileReport{
+					Path:    relativePath,
+					Status:  statusOK,
+					Rev:     repo.fileRev(co),
+					Relaxed: relaxed,
+				})
+			} else if same {
+				repo.Report.unchanged = append(repo.Report.unchanged, relativePath)
+			}
+
+			if !same {
+				if !failed {
+					fmt.Fprintf(output, "\n")
+				}
+
+				a, b := splitLines(string(d1)), splitLines(string(d2))
+				lines := changedLines(a, b)
+
+				where := ""
+				if *quiet {
+					where = " " + describeLines(lines)
+				}
+
+				cosmetic := cosmeticDifference(d1, d2)
+				if cosmetic == "" && strings.HasSuffix(relativePath, ".go") && reindented(d1, d2) {
+					cosmetic = "only tab/space indentation"
+				}
+				if cosmetic == "" && *detectNondet && nondeterministic(d1, d2, append(nondeterministicPatterns, nondetPatterns...)) {
+					cosmetic = "likely non-deterministic, only timestamps or paths differ"
+				}
+				if cosmetic != "" {
+					where += " (" + cosmetic + ")"
+				}
+
+				native := isNativeSource(filepath.Base(relativePath))
+				if native {
+					where += " (native source)"
+				}
+
+				sameAs := ""
+				if *collapseIdentical {
+					key := fmt.Sprintf("%x %x", hashFunc(d1), hashFunc(d2))
+					if paths := identical[key]; len(paths) > 0 {
+						sameAs = paths[0]
+					} else {
+						identicalKeys = append(identicalKeys, key)
+					}
+					identical[key] = append(identical[key], filepath.Join(name, relativePath))
+				}
+
+				if sameAs != "" {
+					fmt.Fprintf(output, "[!] File %s has the same changes as %s\n", filepath.Join(name, relativePath), sameAs)
+				} else if len(repo.Checkouts) > 1 {
+					fmt.Fprintf(output, "[!] File %s has changes from rev %s%s\n", filepath.Join(name, relativePath), co.Rev, where)
+				} else {
+					fmt.Fprintf(output, "[!] File %s has changes%s\n", filepath.Join(name, relativePath), where)
+				}
+
+				failed = true
+
+				generated := *strictGenerated && (isGenerated(d1) || isGenerated(d2))
+				if generated {
+					fmt.Fprintf(output, "[!] File %s is generated code, and has been edited by hand\n", filepath.Join(name, relativePath))
+					editedGenerated++
+				}
+
+				eol := lineEndingDifference(d1, d2)
+				if eol != "" {
+					fmt.Fprintf(output, "[!] File %s has %s\n", filepath.Join(name, relativePath), eol)
+				}
+
+				truncated := truncation(int64(len(d1)), int64(len(d2)), bytes.HasPrefix(d2, d1) && !bytes.HasSuffix(d1, []byte("\n")))
+				if truncated != "" {
+					fmt.Fprintf(output, "[!] File %s is possibly truncated: %s\n", filepath.Join(name, relativePath), truncated)
+					truncatedFiles++
+				}
+
+				var upstream []string
+				if *upstreamLog && sameAs == "" {
+					commits, ok, err := co.upstreamCommits(ctx, relativePath)
+					if err != nil {
+						panic(err)
+					}
 
-type godepManifest struct {
-	ImportPath   string
-	GoVersion    string
-	GodepVersion string
-	Deps         []struct {
-		ImportPath string
-		Comment    string
-		Rev        string
-	}
-}
+					switch {
+					case !ok:
+						fmt.Fprintf(output, "upstream history isn't available, as the source wasn't cloned\n")
+					case len(commits) == 0:
+						fmt.Fprintf(output, "upstream has no later commits to this file, so it was changed locally\n")
+					default:
+						fmt.Fprintf(output, "upstream has %d later commits to this file:\n", len(commits))
+						for _, c := range commits {
+							fmt.Fprintf(output, "  %s\n", c)
+						}
+					}
 
-func gitClone(dir, repo string) error {
-	cmd := exec.Command("git", "clone", repo, dir)
-	if *verbose {
-		fmt.Printf("$ %s\n", strings.Join(cmd.Args, " "))
-	}
-	return cmd.Run()
-}
+					upstream = commits
+				}
 
-func gitFetch(dir string) error {
-	cmd := exec.Command("git", "fetch", "origin")
-	cmd.Dir = dir
-	if *verbose {
-		fmt.Printf("$ cd %s; %s\n", cmd.Dir, strings.Join(cmd.Args, " "))
-	}
-	return cmd.Run()
-}
+				diff, err := unifiedDiff(ctx, d1, d2, "a/"+filepath.ToSlash(filepath.Join(vendorPath, relativePath)), "b/"+filepath.ToSlash(filepath.Join(vendorPath, relativePath)))
 
-func gitCheckout(dir, rev string) error {
-	cmd := exec.Command("git", "checkout", rev)
-	cmd.Dir = dir
-	if *verbose {
-		fmt.Printf("$ cd %s; %s\n", cmd.Dir, strings.Join(cmd.Args, " "))
-	}
-	return cmd.Run()
-}
+				if err == nil && !*quiet && sameAs == "" {
+					shown := false
+					if tool != nil {
+						if err := tool.show(relativePath, d1, d2, diff); err != nil {
+							fmt.Fprintf(output, "couldn't run -diff-tool: %s\n", err)
+						} else {
+							shown = true
+						}
+					}
 
-func gitHead(dir string) ([]byte, error) {
-	cmd := exec.Command("git", "rev-parse", "HEAD")
-	cmd.Dir = dir
-	if *verbose {
-		fmt.Printf("$ cd %s; %s\n", cmd.Dir, strings.Join(cmd.Args, " "))
-	}
-	return cmd.Output()
-}
+					if !shown {
+						for _, l := range strings.Split(strings.TrimSpace(diff), "\n") {
+							fmt.Fprintf(output, "> %s\n", l)
+						}
+					}
+				}
 
-func main() {
-	flag.Parse()
+				repo.Report.Files = append(repo.Report.Files, &FileReport{
+					Path:   relativePath,
+					Status: statusModified,
+					Rev:    repo.fileRev(co),
+					Lines:  lines,
+					Diff:   diff,
 
-	manifestJSON, err := ioutil.ReadFile(*manifestPath)
-	if err != nil {
-		panic(err)
-	}
+					Cosmetic:        cosmetic,
+					SameAs:          sameAs,
+					Generated:       generated,
+					Native:          native,
+					LineEndings:     eol,
+					Truncated:       truncated,
+					UpstreamCommits: upstream,
+				})
 
-	var manifest godepManifest
-	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
-		panic(err)
-	}
+				if *emitPatch != "" {
+					sourcePath := relativePath
+					if c.sourcePath != "" {
+						sourcePath = c.sourcePath
+					}
+					p := filepath.Join(vendorPath, relativePath)
+					inner, _ := co.relative(sourcePath)
+					if err := patch.add(filepath.ToSlash(p), d1, d2, gitFileMode(p), gitFileMode(filepath.Join(co.Dir, inner))); err != nil {
+						panic(err)
+					}
+				}
 
-	paths := make(map[string][]string)
-	roots := make(map[string]*vcs.RepoRoot)
-	revs := make(map[string]string)
+				if *fix {
+					p := filepath.Join(vendorPath, relativePath)
+					if err := applyFix("Restoring "+p+" from source", "restore "+p+" from source", func() error { return ioutil.WriteFile(p, d2, 0644) }); err != nil {
+						panic(err)
+					}
+				}
 
-	fmt.Printf("# Resolving package urls to repositories\n")
-	for _, d := range manifest.Deps {
-		rr, err := vcs.RepoRootForImportPath(d.ImportPath, *verbose)
-		if err != nil {
-			panic(err)
+				fmt.Fprintf(output, "\n")
+			}
 		}
 
-		paths[rr.Root] = append(paths[rr.Root], d.ImportPath)
-		roots[rr.Root] = rr
-		revs[rr.Root] = d.Rev
-	}
+		// A file can match some upstream file and still not belong where it
+		// was vendored.
+		if *checkPackages {
+			dirs := goFilesByDir(seen)
 
-	fmt.Printf("# Checking out %d repositories locally\n", len(roots))
-	for name, root := range roots {
-		dir := filepath.Join(*cachePath, "vendor-verify", name)
+			var sorted []string
+			for dir := range dirs {
+				sorted = append(sorted, dir)
+			}
+			sort.Strings(sorted)
 
-		if *verbose {
-			fmt.Printf("downloading %q rev %s to %q\n", name, revs[name], dir)
-		}
+			for _, dir := range sorted {
+				files := make(map[string][]byte)
+				for _, f := range dirs[dir] {
+					d, err := tree.ReadFile(filepath.Join(vendorPath, filepath.FromSlash(dir), f))
+					if err != nil {
+						panic(err)
+					}
 
-		if root.VCS.Name != "Git" {
-			panic(fmt.Errorf("currently we can only verify git dependencies"))
+					files[f] = d
+				}
+
+				co := repo.checkoutFor(path.Join(dir, dirs[dir][0]))
+				var expected string
+				if inner, ok := co.relative(dir); ok {
+					expected, err = sourcePackage(filepath.Join(co.Dir, filepath.FromSlash(inner)))
+					if err != nil {
+						panic(err)
+					}
+				}
+
+				for _, p := range packageProblems(path.Join(name, dir), files, expected) {
+					if !failed {
+						fmt.Fprintf(output, "\n")
+					}
+
+					fmt.Fprintf(output, "[!] File %s\n", filepath.Join(name, filepath.FromSlash(dir), p))
+					repo.Report.Problems = append(repo.Report.Problems, path.Join(dir, p))
+
+					failed = true
+				}
+			}
 		}
 
-		if st, err := os.Stat(dir); err != nil {
-			if !os.IsNotExist(err) {
-				panic(err)
+		// Files can also be missing from the vendor directory entirely. godep
+		// vendors whole package directories, so look for files in each
+		// package's directory in the source that weren't in the vendor tree.
+		for _, pd := range repo.packageDirs(*licensesOnly) {
+			dir, co := pd.Dir, pd.Checkout
+
+			if inDirs(dir, unreadableDirs) || !checkCategories.checks("missing") {
+				continue
 			}
 
-			if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+			missing, err := filter.missingFiles(name, co, dir, seen)
+			if err != nil {
 				panic(err)
 			}
 
-			if err := gitClone(dir, root.Repo); err != nil {
+			for _, relativePath := range missing {
+				// A file that one of the accepted revisions doesn't have
+				// either may legitimately not be vendored.
+				if a := repo.acceptedWithout(relativePath); a != nil {
+					if *verbose {
+						fmt.Fprintf(output, "%s isn't vendored, but isn't in accepted rev %s either\n", filepath.Join(name, relativePath), a.Version)
+					}
+
+					continue
+				}
+
+				if !failed {
+					fmt.Fprintf(output, "\n")
+				}
+
+				fmt.Fprintf(output, "[!] File %s is missing\n", filepath.Join(name, relativePath))
+
+				failed = true
+
+				repo.Report.Files = append(repo.Report.Files, &FileReport{
+					Path:   relativePath,
+					Status: statusMissing,
+					Rev:    repo.fileRev(co),
+				})
+
+				if *emitPatch != "" {
+					inner, _ := co.relative(relativePath)
+					from, to := filepath.Join(co.Dir, inner), filepath.Join(vendorPath, relativePath)
+
+					d, err := ioutil.ReadFile(from)
+					if err != nil {
+						panic(err)
+					}
+
+					if err := patch.add(filepath.ToSlash(to), nil, d, "", gitFileMode(from)); err != nil {
+						panic(err)
+					}
+				}
+
+				if *fix {
+					inner, _ := co.relative(relativePath)
+					from, to := filepath.Join(co.Dir, inner), filepath.Join(vendorPath, relativePath)
+					if err := applyFix("Adding "+to+" from source", "add "+to+" from source", func() error { return copyFile(from, to) }); err != nil {
+						panic(err)
+					}
+				}
+
+				fmt.Fprintf(output, "\n")
+			}
+		}
+
+		// Leaving out some tests but not others could be hiding what they'd
+		// catch, so it's a problem even when tests aren't being compared.
+		if *testIntegrity {
+			removed, err := removedTests(repo, filter, seen)
+			if err != nil {
 				panic(err)
 			}
-		} else {
-			if !st.IsDir() {
-				panic(fmt.Errorf("%q should be a directory", dir))
+
+			for _, relativePath := range removed {
+				if !failed {
+					fmt.Fprintf(output, "\n")
+				}
+
+				fmt.Fprintf(output, "[!] Test file %s isn't vendored, but other tests from %s are\n", filepath.Join(name, relativePath), name)
+				repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("test file %s was left out, but other tests were vendored", relativePath))
+
+				failed = true
 			}
+		}
 
-			rev, err := gitHead(dir)
-			if err != nil {
+		// Record each repository as it passes, so that if we're stopped
+		// before the end, the next run can carry on from here.
+		if *resume && !partial && repo.Report.Passed() {
+			project.Interrupted[name] = &repositoryState{Revs: repo.revs(), VendorHash: vendorHashes[name]}
+			if err := st.save(); err != nil {
 				panic(err)
 			}
+		}
+	}
+
+	if sampling {
+		fmt.Fprintf(output, "# Compared %d of %d files in a %g%% sample with -seed %d\n", sampleChecked, sampleTotal, *sample, *seed)
+	}
+
+	// A run that compared nothing verified nothing, which is more likely a
+	// wrong -vendor or a filter that left everything out than what was meant.
+	// Repositories skipped because they passed before were verified then, and
+	// those that couldn't be checked out already fail the run.
+	compared, passedBefore := 0, 0
+	for _, name := range names {
+		compared += repos[name].Report.Checked
+		if repos[name].Report.Skipped {
+			passedBefore++
+		}
+	}
+
+	if compared == 0 && passedBefore == 0 && infraFailures == 0 && !*allowEmpty {
+		fmt.Fprintf(output, "[!] %d files were compared, so nothing was verified; check -vendor and the filters, or give -allow-empty if that's expected\n", compared)
+		report.Problems = append(report.Problems, fmt.Sprintf("%d files were compared", compared))
+		failed = true
+	}
+
+	if *allowedLicenses != "" {
+		fmt.Fprintf(output, "# Checking licenses\n")
+
+		allowed := parseLicenseAllowlist(*allowedLicenses)
+
+		for _, name := range names {
+			repo := repos[name]
+
+			if repo.Skip || repo.Broken {
+				continue
+			}
 
-			if strings.TrimSpace(string(rev)) != revs[name] {
-				if err := gitFetch(dir); err != nil {
+			repo.Report.Licenses = make(map[string]string)
+
+			for _, d := range repo.Packages {
+				ids, err := packageLicenses(repo.checkout(d.Rev), strings.TrimPrefix(strings.TrimPrefix(d.ImportPath, repo.Name), "/"))
+				if err != nil {
 					panic(err)
 				}
+
+				if len(ids) == 0 {
+					ids = []string{"none"}
+				}
+
+				license := strings.Join(ids, " AND ")
+				repo.Report.Licenses[d.ImportPath] = license
+
+				if bad := allowed.disallowed(ids); len(bad) > 0 {
+					fmt.Fprintf(output, "[!] %s is licensed under %s, which isn't allowed\n", d.ImportPath, license)
+					repo.Report.Problems = append(repo.Report.Problems, fmt.Sprintf("%s is licensed under %s, which isn't allowed", d.ImportPath, strings.Join(bad, ", ")))
+					failed = true
+				} else {
+					fmt.Fprintf(output, "%s: %s\n", d.ImportPath, license)
+				}
+			}
+		}
+	}
+
+	// The hashes are of the checkouts, not of what's vendored, so they're
+	// what go mod verify would expect whether or not the files matched.
+	if *emitGoSum != "" {
+		fmt.Fprintf(output, "# Hashing dependencies as modules\n")
+
+		var modules []*moduleVersion
+		for _, name := range names {
+			repo := repos[name]
+
+			switch {
+			case repo.Skip || repo.Broken:
+				fmt.Fprintf(output, "[!] %s wasn't checked out, so it's left out of go.sum\n", name)
+				continue
+			case repo.LocalDir != "":
+				fmt.Fprintf(output, "[!] %s is compared against a local directory, which isn't a version of it, so it's left out of go.sum\n", name)
+				continue
+			}
+
+			for _, co := range repo.Checkouts {
+				m, err := checkoutModule(ctx, repo.Root.Root, co)
+				if err != nil {
+					panic(fmt.Errorf("couldn't hash %s at %s as a module: %s", name, co.Version, err))
+				}
+
+				if *verbose {
+					fmt.Fprintf(output, "%s %s %s\n", m.Path, m.Version, m.Hash)
+				}
+
+				modules = append(modules, m)
 			}
 		}
 
-		if err := gitCheckout(dir, revs[name]); err != nil {
+		project := ""
+		if p, ok := manifest.(importPather); ok {
+			project = p.ProjectImportPath()
+		}
+
+		if err := writeGoSum(*emitGoSum, project, modules); err != nil {
 			panic(err)
 		}
+
+		fmt.Fprintf(output, "# Wrote go.sum and go.mod for %d modules to %s\n", len(modules), *emitGoSum)
 	}
 
-	failed := false
+	// Whether the vendored packages build is a separate question from whether
+	// they match their sources, so it's asked of all of them, whatever was
+	// compared.
+	if *buildCheck != "" {
+		fmt.Fprintf(output, "# Checking that the vendored packages build with go %s\n", *buildCheck)
 
-	fmt.Printf("# Comparing file contents\n")
-	for name := range paths {
-		vendorPath := filepath.Join(*vendorPath, name)
-		cleanPath := filepath.Join(*cachePath, "vendor-verify", name)
+		failures, n, err := checkBuild(ctx, *buildCheck, *vendorPath)
+		if err != nil {
+			panic(err)
+		}
 
-		if err := filepath.Walk(vendorPath, func(path string, fi os.FileInfo, err error) error {
-			if err != nil {
-				return err
+		for _, f := range failures {
+			fmt.Fprintf(output, "[!] %s doesn't build:\n", f.ImportPath)
+			for _, l := range strings.Split(f.Output, "\n") {
+				fmt.Fprintf(output, "    %s\n", l)
 			}
 
-			if fi.IsDir() {
-				return nil
-			}
+			report.Problems = append(report.Problems, fmt.Sprintf("%s doesn't build with go %s", f.ImportPath, *buildCheck))
+			failed = true
+		}
 
-			relativePath := strings.TrimLeft(strings.TrimPrefix(path, vendorPath), "/")
+		if *verbose {
+			fmt.Fprintf(output, "%d of %d vendored packages built\n", n-len(failures), n)
+		}
+	}
 
-			if *verbose {
-				fmt.Printf("checking %s\n", filepath.Join(name, relativePath))
+	if *vulncheck {
+		fmt.Fprintf(output, "# Checking for known vulnerabilities\n")
+
+		vulns, unversioned, err := checkVulnerabilities(ctx, vulnDatabase(*vulnDB), deps)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, p := range unversioned {
+			fmt.Fprintf(output, "%s isn't pinned at a version, so it can't be checked\n", p)
+		}
+
+		for _, v := range vulns {
+			fmt.Fprintf(output, "[!] %s\n", v)
+			report.Problems = append(report.Problems, v.String())
+			failed = true
+		}
+	}
+
+	report.Failed = failed || infraFailures > 0
+
+	// A partial run doesn't show that every file matched, so it isn't
+	// recorded as passing.
+	if *incremental && !*againstHead && !(*fix && *yes) && !partial {
+		for _, name := range names {
+			repo := repos[name]
+
+			if repo.Skip {
+				continue
 			}
 
-			d1, err := ioutil.ReadFile(filepath.Join(vendorPath, relativePath))
-			if err != nil {
-				return err
+			if repo.Report.Passed() {
+				project.Repositories[name] = &repositoryState{Revs: repo.revs(), VendorHash: vendorHashes[name]}
+			} else {
+				delete(project.Repositories, name)
 			}
+		}
 
-			h1 := sha256.New()
-			if _, err := io.Copy(h1, bytes.NewReader(d1)); err != nil {
-				return err
+		if err := st.save(); err != nil {
+			panic(err)
+		}
+	}
+
+	if *resume {
+		project.Interrupted = nil
+		if err := st.save(); err != nil {
+			panic(err)
+		}
+	}
+
+	if *collapseIdentical {
+		for _, key := range identicalKeys {
+			if paths := identical[key]; len(paths) > 1 {
+				fmt.Fprintf(output, "# %d files have identical changes: %s\n", len(paths), strings.Join(paths, ", "))
 			}
-			sum1 := h1.Sum(nil)
+		}
+	}
+
+	if *detectDupes {
+		fmt.Fprintf(output, "# Checking for duplicated files\n")
+
+		for _, group := range duplicatedFiles(vendored) {
+			fmt.Fprintf(output, "[!] %s have the same content, but differ in their sources\n", strings.Join(group, ", "))
+		}
+	}
+
+	if baseline != nil {
+		introduced, resolved := compareReports(baseline, report)
+		report.Changes = &ReportChanges{Baseline: *compareReport, Introduced: introduced, Resolved: resolved}
+
+		fmt.Fprintf(output, "# Changes since %s: %d new mismatches, %d resolved\n", *compareReport, len(introduced), len(resolved))
+		for _, l := range introduced {
+			fmt.Fprintf(output, "+ %s\n", l)
+		}
+		for _, l := range resolved {
+			fmt.Fprintf(output, "- %s\n", l)
+		}
+	}
+
+	if *groupByRepo {
+		fmt.Fprintf(output, "# Results by repository\n")
+
+		if err := writeGroupedSummary(output, report); err != nil {
+			panic(err)
+		}
+	}
+
+	if *profileFiles > 0 {
+		printSlowestFiles(timings, *profileFiles)
+	}
+
+	if *emitPatch != "" {
+		if err := ioutil.WriteFile(*emitPatch, patch.Bytes(), 0644); err != nil {
+			panic(err)
+		}
+
+		fmt.Fprintf(output, "# Wrote a patch for %s to %s\n", *vendorPath, *emitPatch)
+	}
+
+	if *reportFormat != "text" {
+		if err := writeReport(report, *reportFormat, *reportOutput); err != nil {
+			panic(err)
+		}
+	}
+
+	if *tui {
+		fmt.Fprintf(output, "# Browsing the results\n")
+
+		if err := browseReport(report, os.Stdin, output); err != nil {
+			panic(err)
+		}
+	}
 
-			d2, err := ioutil.ReadFile(filepath.Join(cleanPath, relativePath))
+	if *attestationPath != "" {
+		if failed || infraFailures > 0 {
+			fmt.Fprintf(output, "not writing an attestation, as verification failed\n")
+		} else {
+			a, err := newAttestation(*manifestPath, *vendorPath, names, repos)
 			if err != nil {
-				return err
+				panic(err)
 			}
+			a.Passed = true
 
-			h2 := sha256.New()
-			if _, err := io.Copy(h2, bytes.NewReader(d2)); err != nil {
-				return err
+			if err := a.write(*attestationPath); err != nil {
+				panic(err)
 			}
-			sum2 := h2.Sum(nil)
+		}
+	}
 
-			if !bytes.Equal(sum1, sum2) {
-				if !failed {
-					fmt.Printf("\n")
-				}
+	if *coverageOutput != "" {
+		if err := writeCoverageManifest(*coverageOutput, report); err != nil {
+			panic(err)
+		}
+	}
 
-				fmt.Printf("[!] File %s has changes\n", filepath.Join(name, relativePath))
+	if *metricsOutput != "" || *metricsPush != "" {
+		m := &runMetrics{
+			Report:    report,
+			Passed:    !failed && infraFailures == 0,
+			Started:   started,
+			Duration:  time.Since(started),
+			Checkouts: madeCheckouts,
+			CacheHits: cacheHits,
+		}
+		d := m.metricsText()
 
-				failed = true
+		if *metricsOutput != "" {
+			if err := ioutil.WriteFile(*metricsOutput, d, 0644); err != nil {
+				panic(err)
+			}
+		}
 
-				diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-					A:        difflib.SplitLines(string(d1)),
-					B:        difflib.SplitLines(string(d2)),
-					FromFile: "vendor",
-					ToFile:   "original",
-					Context:  3,
-					Eol:      "\n",
-				})
+		if *metricsPush != "" {
+			if err := pushMetrics(ctx, *metricsPush, d); err != nil {
+				panic(fmt.Errorf("couldn't push metrics: %s", err))
+			}
 
-				if err == nil {
-					for _, l := range strings.Split(strings.TrimSpace(diff), "\n") {
-						fmt.Printf("> %s\n", l)
-					}
-				}
+			if *verbose {
+				fmt.Fprintf(output, "pushed metrics to %s\n", *metricsPush)
+			}
+		}
+	}
 
-				if *fix {
-					fmt.Printf("[+] Restoring %s from source\n", filepath.Join(name, relativePath))
+	if *successOutput != "" {
+		if err := writeSuccessProof(*successOutput, failed || infraFailures > 0, *manifestPath, names, repos); err != nil {
+			panic(err)
+		}
+	}
 
-					if err := ioutil.WriteFile(filepath.Join(vendorPath, relativePath), d2, 0644); err != nil {
-						panic(err)
-					}
-				}
+	if *watch {
+		if err := watchVendor(ctx, *vendorPath, repos, filter, hashFunc); err != nil {
+			panic(err)
+		}
 
-				fmt.Printf("\n")
-			}
+		// Watching only stops when the program is interrupted, which is
+		// handled on the way out.
+		return
+	}
 
-			return nil
-		}); err != nil {
-			panic(err)
+	if *selfTest {
+		if failed || infraFailures > 0 {
+			fmt.Fprintf(output, "# Self-test failed: the fixture didn't match its source\n")
+			os.Exit(1)
 		}
+
+		fmt.Fprintf(output, "# Self-test passed\n")
+		os.Exit(0)
 	}
 
-	if failed && !*fix {
-		fmt.Printf("# Failures were detected\n")
+	if (failed || infraFailures > 0) && !(*fix && *yes) {
+		fmt.Fprintf(output, "# Failures were detected\n")
+		if truncatedFiles > 0 {
+			fmt.Fprintf(output, "# %d files look truncated\n", truncatedFiles)
+		}
+		if editedGenerated > 0 && *failOn != "infra" {
+			fmt.Fprintf(output, "# %d generated files were edited by hand\n", editedGenerated)
+			os.Exit(1)
+		}
+		if *warnOnly {
+			os.Exit(0)
+		}
+		if *failOn == "mismatch" && !failed {
+			fmt.Fprintf(output, "# %d repositories couldn't be checked out, which -fail-on=mismatch ignores\n", infraFailures)
+			os.Exit(0)
+		}
+		if *failOn == "infra" && infraFailures == 0 {
+			fmt.Fprintf(output, "# Only problems with the vendored files were found, which -fail-on=infra ignores\n")
+			os.Exit(0)
+		}
 		os.Exit(1)
 	} else {
-		fmt.Printf("# All done\n")
+		fmt.Fprintf(output, "# All done\n")
 		os.Exit(0)
 	}
 }
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Dep is a single dependency listed in a manifest.
+type Dep struct {
+	ImportPath string
+	Rev        string
+	Comment    string
+}
+
+// Manifest is a list of dependencies, independent of the file format it was
+// read from.
+type Manifest interface {
+	Deps() []Dep
+}
+
+// manifestFormat describes one manifest file format we know how to read.
+// detect is used to guess the format from the file contents when it wasn't
+// given explicitly.
+type manifestFormat struct {
+	name   string
+	detect func(d []byte) bool
+	parse  func(d []byte) (Manifest, error)
+}
+
+var manifestFormats = []manifestFormat{
+	{name: "godep", detect: detectGodepManifest, parse: parseGodepManifest},
+	{name: "gomod", detect: detectGoModManifest, parse: parseGoModManifest},
+	{name: "gowork", detect: detectGoWorkManifest, parse: parseGoWorkManifest},
+}
+
+// LoadManifest reads the manifest at path. If format is empty, it is detected
+// from the file contents.
+func LoadManifest(path, format string) (Manifest, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := ParseManifest(d, path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	// A workspace only lists its modules, which have the dependencies.
+	if w, ok := m.(*goWork); ok {
+		if err := w.readModules(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// ParseManifest parses the contents of a manifest. The name is only used in
+// error messages. If format is empty, it is detected from the contents.
+func ParseManifest(d []byte, name, format string) (Manifest, error) {
+	for _, f := range manifestFormats {
+		if format == f.name || (format == "" && f.detect(d)) {
+			return f.parse(d)
+		}
+	}
+
+	if format != "" {
+		return nil, fmt.Errorf("unknown manifest format %q", format)
+	}
+
+	return nil, fmt.Errorf("couldn't detect the format of manifest %q", name)
+}
+
+type godepManifest struct {
+	ImportPath   string
+	GoVersion    string
+	GodepVersion string
+	Dependencies []struct {
+		ImportPath string
+		Comment    string
+		Rev        string
+	} `json:"Deps"`
+}
+
+// duplicateDeps describes each import path that's listed more than once in
+// deps, along with every revision it's listed at.
+func duplicateDeps(deps []Dep) []string {
+	revs := make(map[string][]string)
+	var order []string
+	for _, d := range deps {
+		if len(revs[d.ImportPath]) == 0 {
+			order = append(order, d.ImportPath)
+		}
+		revs[d.ImportPath] = append(revs[d.ImportPath], d.Rev)
+	}
+
+	var dups []string
+	for _, p := range order {
+		if len(revs[p]) > 1 {
+			dups = append(dups, fmt.Sprintf("%s is listed %d times, at revisions %s", p, len(revs[p]), strings.Join(revs[p], ", ")))
+		}
+	}
+
+	return dups
+}
+
+// dedupeDeps removes all but the last entry for each import path in deps.
+func dedupeDeps(deps []Dep) []Dep {
+	last := make(map[string]int)
+	for i, d := range deps {
+		last[d.ImportPath] = i
+	}
+
+	var deduped []Dep
+	for i, d := range deps {
+		if last[d.ImportPath] == i {
+			deduped = append(deduped, d)
+		}
+	}
+
+	return deduped
+}
+
+// changedDeps returns the dependencies in deps whose revision differs from
+// that of the same import path in previous, including any that weren't in
+// previous at all.
+func changedDeps(deps, previous []Dep) []Dep {
+	revs := make(map[string]string)
+	for _, d := range previous {
+		revs[d.ImportPath] = d.Rev
+	}
+
+	var changed []Dep
+	for _, d := range deps {
+		if rev, ok := revs[d.ImportPath]; !ok || rev != d.Rev {
+			changed = append(changed, d)
+		}
+	}
+
+	return changed
+}
+
+// matchingDeps returns the dependencies in deps whose import path matches re.
+func matchingDeps(deps []Dep, re *regexp.Regexp) []Dep {
+	var matching []Dep
+	for _, d := range deps {
+		if re.MatchString(d.ImportPath) {
+			matching = append(matching, d)
+		}
+	}
+
+	return matching
+}
+
+// listedDeps returns the dependencies in deps that provide any of the import
+// paths in list, which can be the dependencies themselves or packages in
+// them. The import paths that aren't provided by any dependency are returned
+// too.
+func listedDeps(deps []Dep, list []string) ([]Dep, []string) {
+	listed := make(map[string]bool)
+	var unknown []string
+
+	for _, p := range list {
+		found := false
+		for _, d := range deps {
+			if p == d.ImportPath || strings.HasPrefix(p, d.ImportPath+"/") {
+				listed[d.ImportPath], found = true, true
+			}
+		}
+
+		if !found {
+			unknown = append(unknown, p)
+		}
+	}
+
+	var matching []Dep
+	for _, d := range deps {
+		if listed[d.ImportPath] {
+			matching = append(matching, d)
+		}
+	}
+
+	return matching, unknown
+}
+
+func detectGodepManifest(d []byte) bool {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(d, &m); err != nil {
+		return false
+	}
+
+	_, ok := m["Deps"]
+	return ok
+}
+
+func parseGodepManifest(d []byte) (Manifest, error) {
+	var m godepManifest
+	if err := json.Unmarshal(d, &m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// vendorLayout works out where the dependencies listed in m, read from
+// manifestPath, were copied to. godep used to keep them in a workspace next to
+// the manifest instead of the vendor directory, so if vendorPath doesn't exist
+// but the workspace does, the workspace is returned, unless explicit is set to
+// say vendorPath was chosen by the user. If both exist, the workspace is only
+// used if the manifest was written with a Go from before vendor directories.
+// layout is "vendor" or "workspace" to skip all that, or "auto". Any
+// surprises are returned as warnings.
+func (m *godepManifest) vendorLayout(manifestPath, vendorPath, layout string, explicit bool) (string, []string) {
+	version := m.GodepVersion
+	if version == "" {
+		version = "of unknown version"
+	}
+
+	workspacePath := filepath.Join(filepath.Dir(manifestPath), "_workspace", "src")
+
+	switch layout {
+	case "vendor":
+		return vendorPath, nil
+	case "workspace":
+		return workspacePath, nil
+	}
+
+	_, err := os.Stat(vendorPath)
+	hasVendor := err == nil
+	_, err = os.Stat(workspacePath)
+	hasWorkspace := err == nil
+
+	goVersion := strings.TrimPrefix(m.GoVersion, "go")
+	preVendor := goVersionKnown(goVersion) && !goVersionAtLeast(goVersion, 1, 5)
+
+	switch {
+	case hasWorkspace && hasVendor && preVendor && !explicit:
+		return workspacePath, []string{fmt.Sprintf("Found both %s and %s; verifying %s, as Go %s didn't have vendor directories", workspacePath, vendorPath, workspacePath, goVersion)}
+	case hasWorkspace && hasVendor:
+		return vendorPath, []string{fmt.Sprintf("Found both %s and %s; verifying %s", workspacePath, vendorPath, vendorPath)}
+	case hasWorkspace && !explicit:
+		return workspacePath, []string{fmt.Sprintf("Manifest was written by godep %s using the old workspace layout; verifying %s", version, workspacePath)}
+	}
+
+	return vendorPath, nil
+}
+
+func (m *godepManifest) ProjectImportPath() string {
+	return m.ImportPath
+}
+
+func (m *godepManifest) Deps() []Dep {
+	deps := make([]Dep, len(m.Dependencies))
+	for i, d := range m.Dependencies {
+		deps[i] = Dep{ImportPath: d.ImportPath, Rev: d.Rev, Comment: d.Comment}
+	}
+	return deps
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// findManifests returns the files under the working directory that match the
+// gitignore-style glob pattern, like **/Godeps.json. Vendor directories and
+// version control metadata aren't searched.
+func findManifests(pattern string) ([]string, error) {
+	re, err := regexp.Compile(globRegexp(strings.TrimPrefix(pattern, "/")))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []string
+
+	err = filepath.Walk(".", func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if p != "." && (fi.Name() == "vendor" || fi.Name() == "_workspace" || vcsMetadataNames[fi.Name()]) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if re.MatchString(filepath.ToSlash(p)) {
+			manifests = append(manifests, p)
+		}
+
+		return nil
+	})
+
+	return manifests, err
+}
+
+// siblingVendorPath returns the vendor directory that goes with the manifest
+// at p: next to it, or for a godep manifest, next to its Godeps directory.
+func siblingVendorPath(p string) string {
+	dir := filepath.Dir(p)
+	if filepath.Base(dir) == "Godeps" {
+		dir = filepath.Dir(dir)
+	}
+
+	return filepath.Join(dir, "vendor")
+}
+
+// withoutFlags returns args without the flags with the given names, and their
+// values. The flags have to take values (e.g. -manifest-glob), or be booleans
+// given no value or one after an "=".
+func withoutFlags(args []string, names ...string) []string {
+	drop := make(map[string]bool)
+	for _, n := range names {
+		drop[n] = true
+	}
+
+	var out []string
+
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		value := strings.Contains(name, "=")
+		if value {
+			name = name[:strings.Index(name, "=")]
+		}
+
+		if !strings.HasPrefix(args[i], "-") || !drop[name] {
+			out = append(out, args[i])
+			continue
+		}
+
+		if f := flag.Lookup(name); !value && (f == nil || !isBoolFlag(f)) {
+			i++
+		}
+	}
+
+	return out
+}
+
+// isBoolFlag reports whether f is a boolean flag, which doesn't take the next
+// argument as its value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// verifyManifests verifies each manifest matching -manifest-glob with its
+// sibling vendor directory, by running this program again for each in turn
+// with the rest of the same flags, and so the same cache. It returns the exit
+// code for the whole run: 1 if any of them failed.
+func verifyManifests(pattern string) int {
+	manifests, err := findManifests(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(manifests) == 0 {
+		panic(fmt.Errorf("no manifests match %q", pattern))
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+
+	args := withoutFlags(os.Args[1:], "manifest-glob")
+
+	var failed []string
+	for _, m := range manifests {
+		vendor := siblingVendorPath(m)
+
+		fmt.Fprintf(output, "# Verifying %s against %s\n", vendor, m)
+
+		a := append(append([]string(nil), args...), "-manifest", m, "-vendor", vendor)
+		if filepath.Base(m) == "go.mod" {
+			a = append(a, "-gomod", m)
+		}
+
+		cmd := exec.Command(self, a...)
+		cmd.Stdout, cmd.Stderr = output, errOutput
+
+		if err := cmd.Run(); err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				panic(err)
+			}
+
+			fmt.Fprintf(output, "# %s failed\n", m)
+			failed = append(failed, m)
+		} else {
+			fmt.Fprintf(output, "# %s passed\n", m)
+		}
+	}
+
+	fmt.Fprintf(output, "# %d of %d manifests passed\n", len(manifests)-len(failed), len(manifests))
+	for _, m := range failed {
+		fmt.Fprintf(output, "[!] %s failed\n", m)
+	}
+
+	if len(failed) > 0 {
+		return 1
+	}
+
+	return 0
+}
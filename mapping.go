@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// mapping records which repository and revision every dependency in the
+// manifest resolved to on one run, for keeping track of how they move over
+// time.
+type mapping struct {
+	Time         time.Time
+	Manifest     string
+	Dependencies []mappedDep
+}
+
+// mappedDep is one dependency in a mapping. Version is what the manifest
+// calls Rev, when that's a tag or the like.
+type mappedDep struct {
+	ImportPath string
+	Root       string
+	Repo       string
+	Rev        string
+	Version    string `json:",omitempty"`
+}
+
+// mappingFile returns the path of the mapping file for a run at t in dir.
+// There's one a day, so a later run on the same day replaces it.
+func mappingFile(dir string, t time.Time) string {
+	return filepath.Join(dir, "mapping-"+t.Format("2006-01-02")+".json")
+}
+
+func readMapping(path string) (*mapping, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m mapping
+	if err := json.Unmarshal(d, &m); err != nil {
+		return nil, fmt.Errorf("couldn't read mapping %q: %s", path, err)
+	}
+
+	return &m, nil
+}
+
+func (m *mapping) save(path string) error {
+	sort.Slice(m.Dependencies, func(i, j int) bool { return m.Dependencies[i].ImportPath < m.Dependencies[j].ImportPath })
+
+	d, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(d, '\n'), 0644)
+}
+
+// diff describes how the dependencies changed between previous and m, one
+// line for each that was added, removed, or moved to another revision or
+// repository, in order of import path.
+func (m *mapping) diff(previous *mapping) []string {
+	old := make(map[string]mappedDep)
+	for _, d := range previous.Dependencies {
+		old[d.ImportPath] = d
+	}
+
+	seen := make(map[string]bool)
+
+	var lines []string
+	for _, d := range m.Dependencies {
+		seen[d.ImportPath] = true
+
+		o, ok := old[d.ImportPath]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("+ %s at %s (%s)", d.ImportPath, d.describe(), d.Repo))
+		case o.Repo != d.Repo:
+			lines = append(lines, fmt.Sprintf("~ %s moved from %s at %s to %s at %s", d.ImportPath, o.Repo, o.describe(), d.Repo, d.describe()))
+		case o.Rev != d.Rev:
+			lines = append(lines, fmt.Sprintf("~ %s changed from %s to %s", d.ImportPath, o.describe(), d.describe()))
+		}
+	}
+
+	for _, o := range previous.Dependencies {
+		if !seen[o.ImportPath] {
+			lines = append(lines, fmt.Sprintf("- %s at %s (%s)", o.ImportPath, o.describe(), o.Repo))
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+
+	return lines
+}
+
+// describe returns the dependency's revision, with its version if it has one.
+func (d mappedDep) describe() string {
+	if d.Version != "" && d.Version != d.Rev {
+		return d.Version + " (" + d.Rev + ")"
+	}
+
+	return d.Rev
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runMetrics is what -metrics-output and -metrics-push report about a run.
+type runMetrics struct {
+	Report   *Report
+	Passed   bool
+	Started  time.Time
+	Duration time.Duration
+	// Checkouts is how many checkouts were made, and CacheHits how many of
+	// them were already in the cache or the store.
+	Checkouts int
+	CacheHits int
+}
+
+// metricLabelEscaper escapes label values for the Prometheus text format.
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsText writes m in the Prometheus text format. Every metric is a
+// gauge, as each run replaces the last one's, and those about a repository
+// are labelled with its root.
+func (m *runMetrics) metricsText() []byte {
+	var b bytes.Buffer
+
+	gauge := func(name, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+
+	failed, unchecked := m.Report.repositoryCounts()
+
+	mismatches := len(m.Report.Problems)
+	for _, repo := range m.Report.Repositories {
+		mismatches += repo.mismatches()
+	}
+
+	passed := 0
+	if m.Passed {
+		passed = 1
+	}
+
+	gauge("godep_verify_passed", "Whether the last run passed.")
+	fmt.Fprintf(&b, "godep_verify_passed %d\n", passed)
+	gauge("godep_verify_last_run_timestamp_seconds", "When the last run started.")
+	fmt.Fprintf(&b, "godep_verify_last_run_timestamp_seconds %d\n", m.Started.Unix())
+	gauge("godep_verify_duration_seconds", "How long the last run took.")
+	fmt.Fprintf(&b, "godep_verify_duration_seconds %g\n", m.Duration.Seconds())
+	gauge("godep_verify_repositories", "Repositories in the manifest.")
+	fmt.Fprintf(&b, "godep_verify_repositories %d\n", len(m.Report.Repositories))
+	gauge("godep_verify_repositories_failed", "Repositories that didn't match.")
+	fmt.Fprintf(&b, "godep_verify_repositories_failed %d\n", failed)
+	gauge("godep_verify_repositories_unchecked", "Repositories that couldn't be checked out.")
+	fmt.Fprintf(&b, "godep_verify_repositories_unchecked %d\n", unchecked)
+	gauge("godep_verify_mismatches", "Files that didn't match and other problems found.")
+	fmt.Fprintf(&b, "godep_verify_mismatches %d\n", mismatches)
+	gauge("godep_verify_checkouts", "Checkouts made.")
+	fmt.Fprintf(&b, "godep_verify_checkouts %d\n", m.Checkouts)
+	gauge("godep_verify_checkout_cache_hits", "Checkouts that were already in the cache or the store.")
+	fmt.Fprintf(&b, "godep_verify_checkout_cache_hits %d\n", m.CacheHits)
+
+	repos := append([]*RepositoryReport(nil), m.Report.Repositories...)
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Root < repos[j].Root })
+
+	perRepo := []struct {
+		name, help string
+		value      func(r *RepositoryReport) float64
+	}{
+		{"godep_verify_repository_passed", "Whether the repository matched, if it was checked.", func(r *RepositoryReport) float64 {
+			if r.Passed() {
+				return 1
+			}
+			return 0
+		}},
+		{"godep_verify_repository_files_checked", "Files compared in the repository.", func(r *RepositoryReport) float64 { return float64(r.Checked) }},
+		{"godep_verify_repository_mismatches", "Files in the repository that didn't match and other problems with it.", func(r *RepositoryReport) float64 { return float64(r.mismatches()) }},
+		{"godep_verify_repository_checkout_seconds", "How long checking out the repository took.", func(r *RepositoryReport) float64 { return r.checkoutTime.Seconds() }},
+	}
+
+	for _, g := range perRepo {
+		gauge(g.name, g.help)
+		for _, r := range repos {
+			if r.Skipped || r.Unchecked {
+				continue
+			}
+
+			fmt.Fprintf(&b, "%s{root=\"%s\"} %g\n", g.name, metricLabelEscaper.Replace(r.Root), g.value(r))
+		}
+	}
+
+	return b.Bytes()
+}
+
+// mismatches returns how many files in r didn't match and how many other
+// problems it has.
+func (r *RepositoryReport) mismatches() int {
+	return r.Changed() + len(r.Problems)
+}
+
+// pushMetrics replaces the metrics for this job in the Prometheus pushgateway
+// at u with d. u is the pushgateway's address, with the job and any other
+// grouping labels after /metrics/job/ in its path, or a job of godep_verify
+// if it has none.
+func pushMetrics(ctx context.Context, u string, d []byte) error {
+	if !strings.Contains(u, "/metrics/job/") {
+		u = strings.TrimSuffix(u, "/") + "/metrics/job/godep_verify"
+	}
+
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(d))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s: %s", u, res.Status)
+	}
+
+	return nil
+}
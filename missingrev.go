@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxClosestCandidates is how many of the newest commits closestCommit looks
+// through.
+const maxClosestCandidates = 500
+
+// vendoredBlobs returns the git blob hash of every file vendored under dir in
+// tree, keyed by its path relative to dir, with slashes. The directories in
+// nested, relative to dir, belong to other repositories and are left out.
+func vendoredBlobs(tree vendorTree, dir string, nested map[string]bool) (map[string]string, error) {
+	blobs := make(map[string]string)
+
+	err := tree.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() && (vcsMetadataNames[fi.Name()] || nested[filepath.ToSlash(strings.TrimLeft(strings.TrimPrefix(path, dir), "/"))]) {
+			return filepath.SkipDir
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		d, err := tree.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		blobs[filepath.ToSlash(strings.TrimLeft(strings.TrimPrefix(path, dir), "/"))] = blobHash(d)
+
+		return nil
+	})
+
+	return blobs, err
+}
+
+// closestCommit finds the commit in the repository at dir that's most likely
+// to be what a revision removed from it looked like, for when upstream was
+// rebased or force pushed. A commit whose tree is expectedTree wins outright;
+// otherwise it's the commit with the most files matching blobs, preferring
+// newer ones. It returns an empty string if no commit has any of them, along
+// with how many of blobs match.
+func closestCommit(ctx context.Context, dir string, blobs map[string]string, expectedTree string) (string, int, error) {
+	out, err := gitCommitTrees(ctx, dir, maxClosestCandidates)
+	if err != nil {
+		return "", 0, err
+	}
+
+	best, bestMatching := "", 0
+	for _, l := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(l)
+		if len(fields) != 2 {
+			continue
+		}
+
+		matching, err := matchingBlobs(ctx, dir, fields[0], blobs)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if expectedTree != "" && fields[1] == expectedTree {
+			return fields[0], matching, nil
+		}
+
+		if matching > bestMatching {
+			best, bestMatching = fields[0], matching
+		}
+	}
+
+	return best, bestMatching, nil
+}
+
+// matchingBlobs counts the files in blobs that are the same in rev.
+func matchingBlobs(ctx context.Context, dir, rev string, blobs map[string]string) (int, error) {
+	out, err := gitListTree(ctx, dir, rev)
+	if err != nil {
+		return 0, err
+	}
+
+	matching := 0
+	for _, l := range strings.Split(string(out), "\n") {
+		i := strings.Index(l, "\t")
+		if i < 0 {
+			continue
+		}
+
+		fields := strings.Fields(l[:i])
+		if len(fields) == 3 && blobs[l[i+1:]] == fields[2] {
+			matching++
+		}
+	}
+
+	return matching, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// moduleCacheDir returns the location of the Go module cache, following the
+// same rules as the go command: $GOMODCACHE if set, otherwise pkg/mod in the
+// first entry of $GOPATH.
+func moduleCacheDir() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// escapeModulePath applies the module cache's case encoding, where each
+// upper case letter is replaced by "!" followed by its lower case form.
+func escapeModulePath(path string) string {
+	var b bytes.Buffer
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// findCachedModule looks for an extracted copy of the module at root, at the
+// given version, in the Go module cache.
+func findCachedModule(root, version string) (string, bool) {
+	cache := moduleCacheDir()
+	if cache == "" || !strings.HasPrefix(version, "v") {
+		return "", false
+	}
+
+	dir := filepath.Join(cache, escapeModulePath(root)+"@"+escapeModulePath(version))
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		return "", false
+	}
+
+	return dir, true
+}
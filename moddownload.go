@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// goSum holds the module hashes in a go.sum file, keyed by "path version"
+// (with "/go.mod" after the version for the hashes of go.mod files).
+type goSum map[string]string
+
+func readGoSum(path string) (goSum, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := make(goSum)
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s: expected \"<module> <version> <hash>\", got %q", path, l)
+		}
+
+		sum[fields[0]+" "+fields[1]] = fields[2]
+	}
+
+	return sum, nil
+}
+
+// moduleDownload is what go mod download -json says about a module.
+type moduleDownload struct {
+	Path    string
+	Version string
+	Error   string
+	Zip     string
+	Sum     string
+}
+
+// downloadWithGo has the go command download the module holding the
+// packages, which is the first of modules that go.sum has a hash for at
+// version, and checks it against go.sum twice: the hash the go command
+// reports, which it checked against the checksum database, and the hash of
+// the files extracted from its zip under dir. It returns the module path and
+// the directory holding its files.
+func downloadWithGo(ctx context.Context, modules []string, version string, sum goSum, dir string) (string, string, error) {
+	module, expected := "", ""
+	for _, m := range modules {
+		if h, ok := sum[m+" "+version]; ok {
+			module, expected = m, h
+			break
+		}
+	}
+
+	if module == "" {
+		return "", "", fmt.Errorf("go.sum has no hash for %s at %s", strings.Join(modules, " or "), version)
+	}
+
+	d, err := goModDownloadJSON(ctx, module, version)
+	if err != nil {
+		return "", "", err
+	}
+
+	if d.Sum != expected {
+		return "", "", fmt.Errorf("go mod download says %s@%s has the hash %s, but go.sum expects %s", module, version, d.Sum, expected)
+	}
+
+	prefix := module + "@" + version
+	target := filepath.Join(dir, escapeModulePath(module)+"@"+escapeModulePath(version))
+
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		if err := extractModuleZip(d.Zip, prefix, target); err != nil {
+			return "", "", err
+		}
+	} else if err != nil {
+		return "", "", err
+	}
+
+	// The extracted files are what's compared against, so they're hashed
+	// again, whether they were just extracted or kept from before.
+	files, err := listFiles(target)
+	if err != nil {
+		return "", "", err
+	}
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = prefix + "/" + f
+	}
+
+	actual, err := hash1(names, func(name string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(strings.TrimPrefix(name, prefix+"/"))))
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if actual != expected {
+		return "", "", fmt.Errorf("the files of %s@%s in %s have the hash %s, but go.sum expects %s", module, version, target, actual, expected)
+	}
+
+	return module, target, nil
+}
+
+// goModDownloadJSON runs go mod download -json for module@version, outside
+// of any module, so that only the go command's own settings apply.
+func goModDownloadJSON(ctx context.Context, module, version string) (*moduleDownload, error) {
+	tmp, err := ioutil.TempDir("", "godep-verify-download-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	cmd := exec.CommandContext(ctx, "go", "mod", "download", "-json", module+"@"+version)
+	cmd.Dir = tmp
+	cmd.Env = append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")
+	if *verbose {
+		fmt.Fprintf(output, "$ %s\n", strings.Join(cmd.Args, " "))
+	}
+
+	// go mod download still prints the JSON when it fails, with an Error.
+	out, runErr := cmd.Output()
+
+	var d moduleDownload
+	if err := json.Unmarshal(out, &d); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("go mod download %s@%s failed: %s", module, version, runErr)
+		}
+
+		return nil, fmt.Errorf("couldn't read what go mod download said about %s@%s: %s", module, version, err)
+	}
+
+	if d.Error != "" {
+		return nil, fmt.Errorf("go mod download %s@%s failed: %s", module, version, d.Error)
+	}
+	if runErr != nil {
+		return nil, runErr
+	}
+
+	return &d, nil
+}
+
+// listFiles returns the regular files under dir, with slashes.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, filepath.ToSlash(rel))
+
+		return nil
+	})
+
+	return files, err
+}
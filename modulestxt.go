@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// vendoredModule is a module entry in vendor/modules.txt.
+type vendoredModule struct {
+	Path        string
+	Version     string
+	Explicit    bool
+	Replacement *goModReplace
+	Packages    []string
+}
+
+// readModulesTxt parses vendor/modules.txt as written by `go mod vendor`.
+// Module lines look like "# path version [=> new [version]]", annotations
+// like "## explicit; go 1.17", and every other line names a package vendored
+// from the module above it.
+func readModulesTxt(tree vendorTree, path string) ([]*vendoredModule, error) {
+	d, err := tree.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []*vendoredModule
+	var current *vendoredModule
+
+	for i, l := range strings.Split(string(d), "\n") {
+		l = strings.TrimSpace(l)
+
+		switch {
+		case l == "":
+			continue
+		case strings.HasPrefix(l, "## "):
+			if current == nil {
+				return nil, fmt.Errorf("%s:%d: annotation before any module", path, i+1)
+			}
+
+			for _, a := range strings.Split(strings.TrimPrefix(l, "## "), ";") {
+				if strings.TrimSpace(a) == "explicit" {
+					current.Explicit = true
+				}
+			}
+		case strings.HasPrefix(l, "# "):
+			fields := strings.Fields(strings.TrimPrefix(l, "# "))
+
+			current = &vendoredModule{Path: fields[0]}
+
+			if len(fields) > 1 && fields[1] != "=>" {
+				current.Version = fields[1]
+			}
+
+			for _, f := range fields {
+				if f == "=>" {
+					r, err := parseGoModReplace(fields)
+					if err != nil {
+						return nil, fmt.Errorf("%s:%d: %s", path, i+1, err)
+					}
+
+					current.Replacement = &r
+				}
+			}
+
+			modules = append(modules, current)
+		default:
+			if current == nil {
+				return nil, fmt.Errorf("%s:%d: package before any module", path, i+1)
+			}
+
+			current.Packages = append(current.Packages, l)
+		}
+	}
+
+	return modules, nil
+}
+
+// checkModulesTxt compares vendor/modules.txt with the go.mod it was
+// generated from, returning a description of each inconsistency. Every
+// required module must be listed at the same version, with the same
+// replacement, and (from go 1.14 on) be marked explicit; nothing else may be
+// marked explicit.
+func checkModulesTxt(mod *goMod, modules []*vendoredModule) []string {
+	var problems []string
+
+	listed := make(map[string]*vendoredModule)
+	for _, v := range modules {
+		if v.Version != "" {
+			listed[v.Path] = v
+		}
+	}
+
+	explicit := goVersionAtLeast(mod.Go, 1, 14)
+
+	required := make(map[string]bool)
+	for _, r := range mod.Require {
+		required[r.Path] = true
+
+		v, ok := listed[r.Path]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s %s is required by go.mod but isn't listed in modules.txt", r.Path, r.Version))
+			continue
+		}
+
+		if v.Version != r.Version {
+			problems = append(problems, fmt.Sprintf("%s is required at %s by go.mod but listed at %s in modules.txt", r.Path, r.Version, v.Version))
+		}
+
+		if explicit && !v.Explicit {
+			problems = append(problems, fmt.Sprintf("%s is required by go.mod but isn't marked explicit in modules.txt", r.Path))
+		}
+
+		want, replaced := mod.replacement(r.Path, r.Version)
+		switch {
+		case replaced && v.Replacement == nil:
+			problems = append(problems, fmt.Sprintf("%s is replaced by %s in go.mod but not in modules.txt", r.Path, strings.TrimSpace(want.New+" "+want.NewVersion)))
+		case !replaced && v.Replacement != nil:
+			problems = append(problems, fmt.Sprintf("%s is replaced by %s in modules.txt but not in go.mod", r.Path, strings.TrimSpace(v.Replacement.New+" "+v.Replacement.NewVersion)))
+		case replaced && (v.Replacement.New != want.New || v.Replacement.NewVersion != want.NewVersion):
+			problems = append(problems, fmt.Sprintf("%s is replaced by %s in go.mod but by %s in modules.txt", r.Path, strings.TrimSpace(want.New+" "+want.NewVersion), strings.TrimSpace(v.Replacement.New+" "+v.Replacement.NewVersion)))
+		}
+	}
+
+	for _, v := range modules {
+		if v.Explicit && !required[v.Path] {
+			problems = append(problems, fmt.Sprintf("%s is marked explicit in modules.txt but isn't required by go.mod", v.Path))
+		}
+	}
+
+	return problems
+}
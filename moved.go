@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// movedRepoActions are what -moved-repos accepts.
+var movedRepoActions = map[string]bool{"report": true, "accept": true, "fail": true, "ignore": true}
+
+// noFollowClient makes requests without following redirects, so that they can
+// be seen. A host that doesn't answer in time is assumed not to have moved
+// anything, rather than holding the run up.
+var noFollowClient = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// movedTo returns the URL the git repository at repo permanently redirects to,
+// as a host does when a repository is moved to a new owner, or "" if it
+// doesn't. git follows such a redirect when cloning without failing, so the
+// code is verified against wherever the repository is now. Only repositories
+// served over HTTP are checked.
+func movedTo(ctx context.Context, repo string) (string, error) {
+	u, err := url.Parse(repo)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", nil
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(repo, "/")+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return "", err
+	}
+
+	if err := remoteLimiter.wait(ctx); err != nil {
+		return "", err
+	}
+
+	res, err := noFollowClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusMovedPermanently && res.StatusCode != http.StatusPermanentRedirect {
+		return "", nil
+	}
+
+	loc, err := res.Location()
+	if err != nil {
+		return "", err
+	}
+
+	loc.RawQuery = ""
+	loc.Path = strings.TrimSuffix(loc.Path, "/info/refs")
+
+	if moved := loc.String(); moved != strings.TrimSuffix(repo, "/") {
+		return moved, nil
+	}
+
+	return "", nil
+}
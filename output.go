@@ -0,0 +1,15 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// output is where everything we print goes: the log, diffs and summaries.
+// It's os.Stdout when run from the command line, and can be pointed at a
+// buffer or a log sink by code embedding the verifier.
+var output io.Writer = os.Stdout
+
+// errOutput is where the output of programs we run that isn't part of the
+// report, like what -diff-tool prints to stderr, goes.
+var errOutput io.Writer = os.Stderr
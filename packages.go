@@ -0,0 +1,232 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importCommentRegexp matches a canonical import comment, as in
+// package foo // import "example.com/foo".
+var importCommentRegexp = regexp.MustCompile(`^//\s*import\s+"([^"]+)"\s*$`)
+
+// ignoreConstraintRegexp matches a build constraint that keeps a file out of
+// every build, like those on generators that are go run by hand.
+var ignoreConstraintRegexp = regexp.MustCompile(`^//\s*(\+build|go:build)\s.*\bignore\b`)
+
+// goFileHeader is what a Go file says about where it belongs.
+type goFileHeader struct {
+	Package       string
+	ImportComment string
+	Imports       []string
+	// Ignored is set for files that are never built.
+	Ignored bool
+}
+
+func parseGoFileHeader(name string, d []byte) (*goFileHeader, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, name, d, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &goFileHeader{Package: f.Name.Name}
+
+	line := fset.Position(f.Package).Line
+	for _, g := range f.Comments {
+		if g.Pos() < f.Package {
+			h.Ignored = h.Ignored || ignoredByConstraint(g)
+			continue
+		}
+
+		if fset.Position(g.Pos()).Line == line {
+			if m := importCommentRegexp.FindStringSubmatch(g.List[0].Text); m != nil {
+				h.ImportComment = m[1]
+			}
+		}
+	}
+
+	for _, i := range f.Imports {
+		p, err := strconv.Unquote(i.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		h.Imports = append(h.Imports, p)
+	}
+
+	return h, nil
+}
+
+func ignoredByConstraint(g *ast.CommentGroup) bool {
+	for _, c := range g.List {
+		if ignoreConstraintRegexp.MatchString(c.Text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourcePackage returns the package the Go files in dir declare, leaving out
+// tests and files that are never built, or "" if there aren't any. If they
+// don't agree, it's the one most of them declare.
+func sourcePackage(dir string) (string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") || strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+
+		d, err := ioutil.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return "", err
+		}
+
+		// A file the go command couldn't parse doesn't say anything.
+		h, err := parseGoFileHeader(e.Name(), d)
+		if err != nil || h.Ignored {
+			continue
+		}
+
+		names = append(names, h.Package)
+	}
+
+	return mostCommon(names), nil
+}
+
+// mostCommon returns the string that's in names most often, the first of
+// them in order if more than one is, or "" if names is empty.
+func mostCommon(names []string) string {
+	counts := make(map[string]int)
+	for _, n := range names {
+		counts[n]++
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	best := ""
+	for _, n := range sorted {
+		if counts[n] > counts[best] {
+			best = n
+		}
+	}
+
+	return best
+}
+
+// packageProblems checks that the vendored Go files in a directory belong in
+// it: that they all declare the package expected (or expected_test, for
+// tests), that any import comment names importPath, the directory's import
+// path, and that they don't import internal packages they can't. files holds
+// the contents of each of them, keyed by name. If expected is "", the package
+// most of the files declare is expected. Files that don't parse are left to
+// the comparison.
+func packageProblems(importPath string, files map[string][]byte, expected string) []string {
+	headers := make(map[string]*goFileHeader)
+
+	var names, declared []string
+	for name, d := range files {
+		h, err := parseGoFileHeader(name, d)
+		if err != nil || h.Ignored {
+			continue
+		}
+
+		headers[name] = h
+		names = append(names, name)
+
+		if !strings.HasSuffix(name, "_test.go") {
+			declared = append(declared, h.Package)
+		}
+	}
+	sort.Strings(names)
+
+	if expected == "" {
+		expected = mostCommon(declared)
+	}
+
+	var problems []string
+	for _, name := range names {
+		h := headers[name]
+
+		switch {
+		case expected == "", h.Package == expected:
+		case strings.HasSuffix(name, "_test.go") && h.Package == expected+"_test":
+		default:
+			problems = append(problems, name+" declares package "+h.Package+", but "+importPath+" is package "+expected)
+		}
+
+		if h.ImportComment != "" && h.ImportComment != importPath {
+			problems = append(problems, name+" has the import comment \""+h.ImportComment+"\", but it's vendored as "+importPath)
+		}
+
+		for _, i := range h.Imports {
+			if !canImport(importPath, i) {
+				problems = append(problems, name+" imports "+i+", an internal package that "+importPath+" can't use")
+			}
+		}
+	}
+
+	return problems
+}
+
+// canImport reports whether the package at importer may import the one at
+// imported, by the go command's rule that an internal package can only be
+// imported from under the directory above it.
+func canImport(importer, imported string) bool {
+	var parent string
+	switch {
+	case strings.HasSuffix(imported, "/internal"):
+		parent = strings.TrimSuffix(imported, "/internal")
+	case strings.Contains(imported, "/internal/"):
+		parent = imported[:strings.LastIndex(imported, "/internal/")]
+	case imported == "internal", strings.HasPrefix(imported, "internal/"):
+		// The standard library's internal packages are its own.
+		return false
+	default:
+		return true
+	}
+
+	return importer == parent || strings.HasPrefix(importer, parent+"/")
+}
+
+// goFilesByDir groups the paths in seen that are Go files by their
+// directory, leaving out testdata, which isn't built.
+func goFilesByDir(seen map[string]bool) map[string][]string {
+	dirs := make(map[string][]string)
+
+	for p := range seen {
+		p = filepath.ToSlash(p)
+		if !strings.HasSuffix(p, ".go") || strings.HasPrefix(p, "testdata/") || strings.Contains(p, "/testdata/") {
+			continue
+		}
+
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = ""
+		}
+
+		dirs[dir] = append(dirs[dir], path.Base(p))
+	}
+
+	return dirs
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// nullBlob is the hash git uses for the side of a patch that has no file.
+const nullBlob = "0000000000000000000000000000000000000000"
+
+// gitPatch collects a patch, in the format git apply takes, that makes the
+// vendor directory match the sources, for -emit-patch.
+type gitPatch struct {
+	bytes.Buffer
+}
+
+// add adds the change of the file at name (relative to where the patch is to
+// be applied) from the content from to the content to. A nil from adds the
+// file, and a nil to deletes it. The modes are git's, like 100644.
+func (p *gitPatch) add(name string, from, to []byte, fromMode, toMode string) error {
+	fmt.Fprintf(p, "diff --git a/%s b/%s\n", name, name)
+
+	fromFile, toFile := "a/"+name, "b/"+name
+	fromBlob, toBlob := blobHash(from), blobHash(to)
+
+	switch {
+	case from == nil:
+		fmt.Fprintf(p, "new file mode %s\nindex %s..%s\n", toMode, nullBlob, toBlob)
+		fromFile = "/dev/null"
+	case to == nil:
+		fmt.Fprintf(p, "deleted file mode %s\nindex %s..%s\n", fromMode, fromBlob, nullBlob)
+		toFile = "/dev/null"
+	case fromMode != toMode:
+		fmt.Fprintf(p, "old mode %s\nnew mode %s\nindex %s..%s\n", fromMode, toMode, fromBlob, toBlob)
+	default:
+		fmt.Fprintf(p, "index %s..%s %s\n", fromBlob, toBlob, fromMode)
+	}
+
+	if isBinary(from) || isBinary(to) {
+		p.WriteString("GIT binary patch\n")
+		if err := p.writeBinaryLiteral(to); err != nil {
+			return err
+		}
+		return p.writeBinaryLiteral(from)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(from)),
+		B:        splitLines(string(to)),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+		Eol:      "\n",
+	})
+	if err != nil {
+		return err
+	}
+
+	p.WriteString(diff)
+	return nil
+}
+
+// blobHash returns the hash of d as a git blob, or nullBlob if it's nil.
+func blobHash(d []byte) string {
+	if d == nil {
+		return nullBlob
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(d))
+	h.Write(d)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isBinary guesses whether d is binary the same way git does, by looking for
+// a NUL byte near the start.
+func isBinary(d []byte) bool {
+	if len(d) > 8000 {
+		d = d[:8000]
+	}
+
+	return bytes.IndexByte(d, 0) != -1
+}
+
+// base85Alphabet is the alphabet git encodes binary patches with.
+const base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// writeBinaryLiteral writes d as a literal binary patch hunk: compressed with
+// zlib, then in lines of up to 52 bytes encoded in base 85, each starting with
+// a letter giving its length.
+func (p *gitPatch) writeBinaryLiteral(d []byte) error {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	if _, err := zw.Write(d); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(p, "literal %d\n", len(d))
+
+	data := z.Bytes()
+	for len(data) > 0 {
+		n := len(data)
+		if n > 52 {
+			n = 52
+		}
+
+		if n <= 26 {
+			p.WriteByte(byte('A' + n - 1))
+		} else {
+			p.WriteByte(byte('a' + n - 27))
+		}
+
+		for i := 0; i < n; i += 4 {
+			var acc uint32
+			for j := 0; j < 4; j++ {
+				acc <<= 8
+				if i+j < n {
+					acc |= uint32(data[i+j])
+				}
+			}
+
+			var enc [5]byte
+			for j := 4; j >= 0; j-- {
+				enc[j] = base85Alphabet[acc%85]
+				acc /= 85
+			}
+			p.Write(enc[:])
+		}
+
+		p.WriteByte('\n')
+		data = data[n:]
+	}
+
+	p.WriteByte('\n')
+	return nil
+}
+
+// gitFileMode returns git's mode for the file at path: 100755 if it's
+// executable, and 100644 otherwise.
+func gitFileMode(path string) string {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&0111 != 0 {
+		return "100755"
+	}
+
+	return "100644"
+}
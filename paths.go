@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkoutDirs are the directories under the cache directory that sources are
+// checked out or extracted into.
+var checkoutDirs = []string{"vendor-verify", "vendor-verify-proxy", "vendor-verify-store", "vendor-verify-archive", "vendor-verify-image", "vendor-verify-http", "vendor-verify-git-archive", "vendor-verify-download", "vendor-verify-tarball"}
+
+// checkCacheLocation returns an error if the cache directory is inside the
+// vendor directory, where the checkouts would be walked as if they were
+// vendored, or if the vendor directory is inside one of the checkouts. The
+// vendor directory can be elsewhere in the cache, as it is for -self-test.
+func checkCacheLocation(cache, vendor string) error {
+	inVendor, err := insideDir(cache, vendor)
+	if err != nil {
+		return err
+	}
+
+	if inVendor {
+		return fmt.Errorf("-cache %q is inside -vendor %q, so checkouts would be compared as vendored files; use a cache directory outside the vendor directory", cache, vendor)
+	}
+
+	for _, d := range checkoutDirs {
+		inCheckouts, err := insideDir(vendor, filepath.Join(cache, d))
+		if err != nil {
+			return err
+		}
+
+		if inCheckouts {
+			return fmt.Errorf("-vendor %q is inside the checkouts in -cache %q; use a vendor directory outside the cache directory", vendor, cache)
+		}
+	}
+
+	return nil
+}
+
+// insideDir reports whether dir is parent, or inside it. Symbolic links are
+// followed where the directories exist.
+func insideDir(dir, parent string) (bool, error) {
+	dir, err := absPath(dir)
+	if err != nil {
+		return false, err
+	}
+
+	parent, err = absPath(parent)
+	if err != nil {
+		return false, err
+	}
+
+	return dir == parent || strings.HasPrefix(dir, strings.TrimSuffix(parent, string(filepath.Separator))+string(filepath.Separator)), nil
+}
+
+func absPath(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	if resolved, err := filepath.EvalSymlinks(p); err == nil {
+		return resolved, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return p, nil
+}
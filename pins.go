@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// pins maps a repository root to the commits it's trusted to be vendored at,
+// kept apart from the manifest so that edits to the manifest can be caught.
+type pins map[string][]string
+
+// readPins parses a pin file. Each line has the form "<repo root> <commit>";
+// a root can be listed more than once if it's vendored at several commits.
+// Blank lines and lines starting with "#" are ignored.
+func readPins(path string) (pins, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := make(pins)
+	for i, l := range strings.Split(string(d), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		fields := strings.Fields(l)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<repo root> <commit>\"", path, i+1)
+		}
+
+		p[fields[0]] = append(p[fields[0]], fields[1])
+	}
+
+	return p, nil
+}
+
+// check describes each revision of repo that isn't pinned.
+func (p pins) check(repo *repository) []string {
+	var problems []string
+
+	for _, co := range repo.Checkouts {
+		pinned := false
+		for _, rev := range p[repo.Name] {
+			if rev == co.Rev {
+				pinned = true
+			}
+		}
+
+		switch {
+		case pinned:
+		case len(p[repo.Name]) == 0:
+			problems = append(problems, fmt.Sprintf("%s is at %s, but isn't pinned", repo.Name, co.Rev))
+		default:
+			problems = append(problems, fmt.Sprintf("%s is at %s, but is pinned at %s", repo.Name, co.Rev, strings.Join(p[repo.Name], ", ")))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"go/build"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// platformContext returns the build context for the platform given with -goos
+// and -goarch and the tags given with -build-tags, or nil if none of them were
+// given. As with go build, cgo is only enabled when building for the platform
+// we're running on.
+func platformContext() *build.Context {
+	if *targetOS == "" && *targetArch == "" && *buildTags == "" {
+		return nil
+	}
+
+	ctxt := build.Default
+	if *targetOS != "" {
+		ctxt.GOOS = *targetOS
+	}
+	if *targetArch != "" {
+		ctxt.GOARCH = *targetArch
+	}
+
+	ctxt.CgoEnabled = ctxt.CgoEnabled && ctxt.GOOS == runtime.GOOS && ctxt.GOARCH == runtime.GOARCH
+
+	// Like go build, spaces are accepted between tags as well as commas.
+	ctxt.BuildTags = strings.FieldsFunc(*buildTags, func(r rune) bool { return r == ',' || r == ' ' })
+
+	return &ctxt
+}
+
+// describePlatform describes the build ctxt is for, as in "linux/arm64 with
+// tags integration,netgo".
+func describePlatform(ctxt *build.Context) string {
+	s := ctxt.GOOS + "/" + ctxt.GOARCH
+	if len(ctxt.BuildTags) > 0 {
+		s += " with tags " + strings.Join(ctxt.BuildTags, ",")
+	}
+
+	return s
+}
+
+// builtFor reports whether the file at relativePath in the source checkout at
+// root would be compiled for ctxt, going by its name and build constraints.
+// Files that aren't Go or native source, like licenses, are always kept, as
+// are files that can't be read, so that they're still reported.
+func builtFor(ctxt *build.Context, root, relativePath string) bool {
+	base := path.Base(relativePath)
+	if !strings.HasSuffix(base, ".go") && !isNativeSource(base) {
+		return true
+	}
+
+	ok, err := ctxt.MatchFile(filepath.Join(root, filepath.FromSlash(path.Dir(relativePath))), base)
+	return ok || err != nil
+}
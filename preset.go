@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+)
+
+// paranoidFlags are the flags -paranoid turns on.
+var paranoidFlags = []string{
+	"strict",
+	"strict-generated",
+	"require-tags",
+	"no-redirect",
+	"check-usage",
+	"include-tests",
+	"include-native",
+	"check-executable",
+	"check-test-integrity",
+	"check-layout",
+}
+
+// applyParanoid turns on each of paranoidFlags that wasn't given explicitly,
+// so that, e.g., -paranoid -include-tests=false still leaves out test files.
+func applyParanoid() error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, name := range paranoidFlags {
+		if given[name] {
+			continue
+		}
+
+		if err := flag.Set(name, "true"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
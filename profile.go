@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// fileTiming is how long one vendored file took to read, hash and compare.
+type fileTiming struct {
+	Path    string
+	Size    int
+	Elapsed time.Duration
+}
+
+// printSlowestFiles prints the n files in timings that took the longest, along
+// with how much of the comparison time went on all of them, which tells a few
+// huge files apart from many small ones.
+func printSlowestFiles(timings []fileTiming, n int) {
+	sort.SliceStable(timings, func(i, j int) bool { return timings[i].Elapsed > timings[j].Elapsed })
+
+	var total, top time.Duration
+	for i, t := range timings {
+		total += t.Elapsed
+		if i < n {
+			top += t.Elapsed
+		}
+	}
+
+	if n > len(timings) {
+		n = len(timings)
+	}
+
+	fmt.Fprintf(output, "# Slowest %d of %d files compared\n", n, len(timings))
+
+	for _, t := range timings[:n] {
+		fmt.Fprintf(output, "%s: %s (%s)\n", t.Path, t.Elapsed, formatByteSize(int64(t.Size)))
+	}
+
+	if total > 0 {
+		fmt.Fprintf(output, "these took %s of %s in total (%.0f%%)\n", top, total, 100*float64(top)/float64(total))
+	}
+}
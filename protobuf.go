@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// pbVersionRegexp matches the lines protoc-gen-go puts in the header of the
+// files it generates to say which versions of itself and protoc were used.
+var pbVersionRegexp = regexp.MustCompile(`^//\s*(versions:|protoc(-gen-[\w-]+)?\s+(v\S+|\(unknown\)))\s*$`)
+
+// withoutPbVersion returns d without the version lines in its leading comment
+// block, which is all that changes when a .pb.go file is regenerated with a
+// different protoc-gen-go.
+func withoutPbVersion(d []byte) []byte {
+	lines := bytes.SplitAfter(d, []byte("\n"))
+
+	var out [][]byte
+	for i, l := range lines {
+		trimmed := bytes.TrimSpace(l)
+		if len(trimmed) > 0 && !bytes.HasPrefix(trimmed, []byte("//")) {
+			out = append(out, lines[i:]...)
+			break
+		}
+
+		if !pbVersionRegexp.Match(trimmed) {
+			out = append(out, l)
+		}
+	}
+
+	return bytes.Join(out, nil)
+}
+
+// pbEqualIgnoringVersion reports whether the generated files a and b only
+// differ in the generator versions in their headers.
+func pbEqualIgnoringVersion(a, b []byte) bool {
+	return bytes.Equal(withoutPbVersion(a), withoutPbVersion(b))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errNotInProxy is returned by fetchProxyZip when a proxy doesn't have the
+// requested module version, meaning the next proxy in the list should be
+// tried.
+var errNotInProxy = fmt.Errorf("module not found in proxy")
+
+// downloadFromProxy fetches the zip of the first of modules that the proxies
+// in list (with the same syntax as $GOPROXY) have at version, and extracts it
+// under dir. It returns the module path and the directory holding its files.
+// Extracted modules are kept, so the download only happens once per version.
+func downloadFromProxy(ctx context.Context, list string, modules []string, version, dir string) (string, string, error) {
+	for _, module := range modules {
+		target, err := downloadModuleFromProxy(ctx, list, module, version, dir)
+		if err == errNotInProxy {
+			continue
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("couldn't download %s@%s: %s", module, version, err)
+		}
+
+		return module, target, nil
+	}
+
+	return "", "", fmt.Errorf("couldn't download %s@%s: %s", strings.Join(modules, " or "), version, errNotInProxy)
+}
+
+// downloadModuleFromProxy downloads and extracts one module for
+// downloadFromProxy, returning errNotInProxy if no proxy has it.
+func downloadModuleFromProxy(ctx context.Context, list, module, version, dir string) (string, error) {
+	target := filepath.Join(dir, escapeModulePath(module)+"@"+escapeModulePath(version))
+	if st, err := os.Stat(target); err == nil && st.IsDir() {
+		return target, nil
+	}
+
+	var lastErr error = errNotInProxy
+
+	for _, proxy := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '|' }) {
+		if proxy == "direct" || proxy == "off" {
+			break
+		}
+
+		zipPath, err := fetchProxyZip(ctx, strings.TrimSuffix(proxy, "/"), module, version)
+		if err == errNotInProxy {
+			continue
+		}
+		if err != nil {
+			lastErr = err
+			break
+		}
+
+		err = extractModuleZip(zipPath, module+"@"+version, target)
+		os.Remove(zipPath)
+		if err != nil {
+			return "", err
+		}
+
+		return target, nil
+	}
+
+	return "", lastErr
+}
+
+// fetchProxyZip downloads a module zip from a single proxy into a temporary
+// file, returning its path.
+func fetchProxyZip(ctx context.Context, proxy, module, version string) (string, error) {
+	u := proxy + "/" + escapeModulePath(module) + "/@v/" + escapeModulePath(version) + ".zip"
+
+	if *verbose {
+		fmt.Fprintf(output, "downloading %s\n", u)
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return "", errNotInProxy
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+
+	f, err := ioutil.TempFile("", "godep-verify-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, res.Body); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// extractModuleZip extracts a module zip, whose entries all start with
+// prefix (module@version), into target. It's extracted next to target first
+// and then renamed, so an interrupted extraction never looks complete.
+func extractModuleZip(zipPath, prefix, target string) error {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(target), ".extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, f := range r.File {
+		name := strings.TrimPrefix(f.Name, prefix+"/")
+		if name == f.Name || strings.HasSuffix(name, "/") {
+			continue
+		}
+
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if !strings.HasPrefix(p, tmp+string(filepath.Separator)) {
+			return fmt.Errorf("zip entry %q is outside the module", f.Name)
+		}
+
+		if err := extractZipFile(f, p); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp, target)
+}
+
+func extractZipFile(f *zip.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	rd, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	wr, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(wr, rd); err != nil {
+		wr.Close()
+		return err
+	}
+
+	return wr.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"regexp"
+	"time"
+)
+
+// pseudoVersionRegexp matches all three forms of pseudo-version, with or
+// without a +incompatible suffix:
+//
+//	vX.0.0-yyyymmddhhmmss-abcdefabcdef
+//	vX.Y.Z-pre.0.yyyymmddhhmmss-abcdefabcdef
+//	vX.Y.(Z+1)-0.yyyymmddhhmmss-abcdefabcdef
+var pseudoVersionRegexp = regexp.MustCompile(`^v[0-9]+\.(?:0\.0-|[0-9]+\.[0-9]+-(?:[^+]*\.)?0\.)([0-9]{14})-([0-9a-f]{12,40})(?:\+incompatible)?$`)
+
+// pseudoVersionRev returns the commit embedded in a pseudo-version, or false
+// if version isn't one. The timestamp only has to be a plausible date; the
+// go command is stricter, but the commit is what we need.
+func pseudoVersionRev(version string) (string, bool) {
+	m := pseudoVersionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return "", false
+	}
+
+	if _, err := time.Parse("20060102150405", m[1]); err != nil {
+		return "", false
+	}
+
+	return m[2], true
+}
+
+// pseudoVersionTime returns the commit time embedded in a pseudo-version, or
+// false if version isn't one.
+func pseudoVersionTime(version string) (time.Time, bool) {
+	m := pseudoVersionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse("20060102150405", m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// regenerateVendor runs go mod vendor (or go work vendor, for a workspace)
+// for the module in moduleDir, writing the result to dir instead of the
+// module's own vendor directory. Modules are downloaded into a module cache
+// of our own under the cache directory, so the user's isn't touched.
+func regenerateVendor(ctx context.Context, moduleDir, dir string, workspace bool) error {
+	kind := "mod"
+	if workspace {
+		kind = "work"
+	}
+
+	cmd := exec.CommandContext(ctx, "go", kind, "vendor", "-o", dir)
+	cmd.Dir = moduleDir
+	cmd.Env = append(os.Environ(), "GOMODCACHE="+filepath.Join(*cachePath, "vendor-verify-modcache"))
+	if *verbose {
+		fmt.Fprintf(output, "$ cd %s; %s\n", cmd.Dir, strings.Join(cmd.Args, " "))
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go %s vendor failed: %s: %s", kind, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// checkRegenerated compares the vendor directory in tree with what go mod
+// vendor makes of the module the manifest at manifestPath belongs to, file by
+// file, printing every difference. It reports whether there were any.
+func checkRegenerated(ctx context.Context, manifestPath string, manifest Manifest, tree vendorTree, hash func([]byte) []byte) (bool, error) {
+	_, workspace := manifest.(*goWork)
+	if _, ok := manifest.(*goMod); !ok && !workspace {
+		return false, fmt.Errorf("-regenerate-check needs a go.mod or go.work manifest")
+	}
+
+	dir, err := ioutil.TempDir("", "godep-verify-regenerate-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	generated := filepath.Join(dir, "vendor")
+
+	fmt.Fprintf(output, "# Regenerating the vendor directory\n")
+	if err := regenerateVendor(ctx, filepath.Dir(manifestPath), generated, workspace); err != nil {
+		return false, err
+	}
+
+	// The regenerated tree stands in for a checkout, so that the files are
+	// compared the same way they are against their sources.
+	co := &checkout{Dir: generated}
+
+	var files []*comparison
+	err = tree.Walk(*vendorPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		files = append(files, &comparison{relativePath: strings.TrimLeft(strings.TrimPrefix(path, *vendorPath), "/"), co: co})
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(output, "# Comparing %d files with the regenerated vendor directory\n", len(files))
+	compareFiles(ctx, tree, *vendorPath, files, *threadsPerRepo, hash)
+
+	failed := false
+	seen := make(map[string]bool)
+
+	for _, c := range files {
+		if c.err != nil {
+			return false, c.err
+		}
+
+		seen[filepath.ToSlash(c.relativePath)] = true
+
+		switch {
+		case c.missing:
+			fmt.Fprintf(output, "[!] File %s isn't in the regenerated vendor directory\n", c.relativePath)
+			failed = true
+		case !c.same:
+			a, b := splitLines(string(c.vendored)), splitLines(string(c.source))
+			fmt.Fprintf(output, "[!] File %s differs from the regenerated one %s\n", c.relativePath, describeLines(changedLines(a, b)))
+			failed = true
+
+			if *quiet {
+				continue
+			}
+
+			diff, err := unifiedDiff(ctx, c.vendored, c.source, "a/"+filepath.ToSlash(filepath.Join(*vendorPath, c.relativePath)), "b/"+filepath.ToSlash(filepath.Join(*vendorPath, c.relativePath)))
+			if err != nil {
+				return false, err
+			}
+
+			for _, l := range strings.Split(strings.TrimSpace(diff), "\n") {
+				fmt.Fprintf(output, "> %s\n", l)
+			}
+		}
+	}
+
+	err = filepath.Walk(generated, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(generated, path)
+		if err != nil {
+			return err
+		}
+
+		if !seen[filepath.ToSlash(rel)] {
+			fmt.Fprintf(output, "[!] File %s is missing\n", rel)
+			failed = true
+		}
+
+		return nil
+	})
+
+	return failed, err
+}
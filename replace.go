@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// replacer is a manifest with replace directives, which change where a
+// module's source comes from.
+type replacer interface {
+	replacement(path, version string) (goModReplace, bool)
+}
+
+// replacement returns the replace directive in the go.work file itself that
+// applies to path at version. The modules' own replace directives aren't
+// looked at.
+func (w *goWork) replacement(path, version string) (goModReplace, bool) {
+	return w.file.replacement(path, version)
+}
+
+// replacedRepository works out what to verify the module d against when it's
+// replaced by r, as read from a manifest in manifestDir. A replacement by a
+// local directory is compared against that directory as it is. A replacement
+// by another module is compared against that module's repository at the
+// replacement's version. Either way, the returned dependency is still
+// vendored where d was.
+func replacedRepository(resolver *resolutionCache, d Dep, r goModReplace, manifestDir string, refresh bool) (*repository, Dep, error) {
+	if r.NewVersion == "" {
+		dir := filepath.FromSlash(r.New)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(manifestDir, dir)
+		}
+
+		repo := &repository{
+			Name:     d.ImportPath,
+			Root:     &vcs.RepoRoot{Root: d.ImportPath, Repo: dir},
+			LocalDir: dir,
+		}
+
+		return repo, Dep{ImportPath: d.ImportPath, Rev: r.New, Comment: r.New}, nil
+	}
+
+	rr, err := resolver.resolve(r.New, refresh)
+	if err != nil {
+		return nil, Dep{}, err
+	}
+
+	// The replacement's files are vendored where d's are, so the repository
+	// is named after the directory that takes the place of its root.
+	name := d.ImportPath
+	if sub := strings.TrimPrefix(strings.TrimPrefix(r.New, rr.Root), "/"); sub != "" {
+		if !strings.HasSuffix(d.ImportPath, "/"+sub) {
+			return nil, Dep{}, fmt.Errorf("replacement %s is in the directory %s of its repository, which doesn't match where %s is vendored", r.New, sub, d.ImportPath)
+		}
+
+		name = strings.TrimSuffix(d.ImportPath, "/"+sub)
+	}
+
+	rev := moduleRevs{}.resolveRev(Dep{ImportPath: r.New, Rev: r.NewVersion}, rr.Root)
+
+	repo := &repository{Name: name, Root: rr, Replacement: r.New}
+
+	return repo, Dep{ImportPath: d.ImportPath, Rev: rev, Comment: r.NewVersion}, nil
+}
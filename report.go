@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File statuses used in reports.
+const (
+	statusOK       = "ok"
+	statusModified = "modified"
+	// statusExtra is a vendored file that isn't in the source.
+	statusExtra = "extra"
+	// statusMissing is a file in the source that isn't vendored.
+	statusMissing = "missing"
+	// statusUnreadable is a vendored file, or its source, that couldn't be
+	// read, with -keep-going.
+	statusUnreadable = "unreadable"
+)
+
+// Report is the structured result of a run, used by every output format
+// other than the plain text log.
+type Report struct {
+	Manifest     string
+	Tool         toolInfo
+	Failed       bool
+	Problems     []string `json:",omitempty"`
+	Repositories []*RepositoryReport
+	// InfraFailures are the repositories that couldn't be checked at all,
+	// with -keep-going, as opposed to those that were checked and didn't
+	// match.
+	InfraFailures []*InfraFailure `json:",omitempty"`
+	// Changes are the differences from the report given with
+	// -compare-report.
+	Changes *ReportChanges `json:",omitempty"`
+}
+
+// InfraFailure describes a repository that couldn't be checked out.
+type InfraFailure struct {
+	Root string
+	Repo string
+	Rev  string
+	// Stage is what failed: download, clone, fetch, checkout or other.
+	Stage string
+	Error string
+	// Stderr is what git printed, if it was a git command that failed.
+	Stderr string `json:",omitempty"`
+}
+
+// RepositoryReport holds the results for one repository.
+type RepositoryReport struct {
+	Root     string
+	Repo     string
+	Rev      string
+	Checked  int
+	Skipped  bool     `json:",omitempty"`
+	Problems []string `json:",omitempty"`
+	// Unchecked is set when the repository couldn't be checked out, which is
+	// described in the report's InfraFailures.
+	Unchecked bool `json:",omitempty"`
+	Files     []*FileReport
+	// Licenses are the licenses found for each package, with
+	// -allowed-licenses, as SPDX identifiers joined with " AND ".
+	Licenses map[string]string `json:",omitempty"`
+	// Sources are where each of the repository's checkouts came from, with
+	// -report-repo-urls.
+	Sources []*CheckoutSource `json:",omitempty"`
+
+	// unchanged and skippedFiles are the files that matched without being in
+	// Files, and those -sample or -upstream-changed-since left out, for
+	// -coverage-output.
+	unchanged    []string
+	skippedFiles []string
+	// checkoutTime is how long its checkouts took, for -metrics-output.
+	checkoutTime time.Duration
+}
+
+// CheckoutSource is where a checkout came from. Type is how it was made, e.g.
+// git for a clone, and URL is what it was made from, with any password
+// hidden.
+type CheckoutSource struct {
+	Rev  string
+	Type string
+	URL  string
+	// Resolved is the repository URL the import paths resolved to, if the
+	// clone was made from some other URL.
+	Resolved string `json:",omitempty"`
+}
+
+// FileReport holds the result for one file. Files that matched are only
+// included when -report-unchanged is given.
+type FileReport struct {
+	Path   string
+	Status string
+	// Rev is the revision the file was compared against, if the repository
+	// is vendored at more than one.
+	Rev string `json:",omitempty"`
+	// Lines are the vendored file's line numbers near which its first few
+	// differences start.
+	Lines []int  `json:",omitempty"`
+	Diff  string `json:",omitempty"`
+	// Cosmetic describes the difference if it's only a byte order mark,
+	// trailing whitespace or, for Go files, indentation.
+	Cosmetic string `json:",omitempty"`
+	// SameAs is the first file found with exactly the same changes, with
+	// -collapse-identical, as a path in the vendor directory.
+	SameAs string `json:",omitempty"`
+	// Relaxed describes what was ignored to make a file match, e.g. with
+	// -ignore-pb-version.
+	Relaxed string `json:",omitempty"`
+	// Generated is set for generated files, with -strict-generated.
+	Generated bool `json:",omitempty"`
+	// Native is set for native source files, like C and assembly.
+	Native bool `json:",omitempty"`
+	// LineEndings describes how the file's line endings are more or less
+	// consistent than upstream's.
+	LineEndings string `json:",omitempty"`
+	// Truncated describes the file's size against upstream's, if it's empty
+	// or much smaller and so possibly truncated.
+	Truncated string `json:",omitempty"`
+	// UpstreamCommits are the commits after Rev in the source that touch the
+	// file, when -upstream-log is given.
+	UpstreamCommits []string `json:",omitempty"`
+	// Error is why an unreadable file couldn't be read.
+	Error string `json:",omitempty"`
+	// Streamed is set for a file too big to diff within -max-memory, which
+	// has DiffersAt, the offset of the first block that differs, instead.
+	Streamed  bool  `json:",omitempty"`
+	DiffersAt int64 `json:",omitempty"`
+}
+
+// Changed returns the number of files in r that didn't match their source.
+func (r *RepositoryReport) Changed() int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Status != statusOK {
+			n++
+		}
+	}
+	return n
+}
+
+// Passed reports whether everything in the repository checked out.
+func (r *RepositoryReport) Passed() bool {
+	return len(r.Problems) == 0 && r.Changed() == 0
+}
+
+var reportFormats = map[string]func(w io.Writer, r *Report) error{
+	"json":     writeJSONReport,
+	"html":     writeHTMLReport,
+	"csv":      writeCSVReport,
+	"template": writeTemplateReport,
+}
+
+// writeReport writes r in the given format to path, or to stdout if path is
+// "-".
+func writeReport(r *Report, format, path string) error {
+	fn, ok := reportFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown report format %q", format)
+	}
+
+	if path == "-" {
+		return fn(output, r)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeJSONReport(w io.Writer, r *Report) error {
+	d, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", d)
+	return err
+}
+
+// writeGroupedSummary writes each repository in r once, with whether it
+// passed and a nested list of the files that didn't match and any other
+// problems, followed by how many of them failed.
+func writeGroupedSummary(w io.Writer, r *Report) error {
+	failed, unchecked := 0, 0
+
+	for _, repo := range r.Repositories {
+		status := "ok"
+		switch {
+		case repo.Skipped:
+			status = "skipped"
+		case repo.Unchecked:
+			status = "ERROR"
+			unchecked++
+		case !repo.Passed():
+			status = "FAIL"
+			failed++
+		}
+
+		if _, err := fmt.Fprintf(w, "%-7s %s\n", status, repo.Root); err != nil {
+			return err
+		}
+
+		for _, f := range repo.Files {
+			if f.Status == statusOK {
+				continue
+			}
+
+			line := f.Status + " " + f.Path
+			if s := f.summary(); s != "" && (f.Status == statusModified || f.Status == statusUnreadable) {
+				line += " (" + s + ")"
+			}
+
+			if _, err := fmt.Fprintf(w, "        %s\n", line); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range repo.Problems {
+			if _, err := fmt.Fprintf(w, "        %s\n", p); err != nil {
+				return err
+			}
+		}
+	}
+
+	if unchecked > 0 {
+		_, err := fmt.Fprintf(w, "# %d of %d repositories failed, and %d couldn't be checked\n", failed, len(r.Repositories), unchecked)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "# %d of %d repositories failed\n", failed, len(r.Repositories))
+	return err
+}
+
+// csvReportHeader names the columns of a CSV report.
+var csvReportHeader = []string{"Import Path", "Repository", "Rev", "File", "Status", "Summary"}
+
+// writeCSVReport writes a row for every file that didn't match its source, and
+// for every problem, for loading into a spreadsheet.
+func writeCSVReport(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvReportHeader); err != nil {
+		return err
+	}
+
+	for _, p := range r.Problems {
+		if err := cw.Write([]string{"", "", "", "", "problem", p}); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range r.InfraFailures {
+		if err := cw.Write([]string{f.Root, f.Repo, f.Rev, "", "infra", f.Stage + ": " + f.Error}); err != nil {
+			return err
+		}
+	}
+
+	for _, repo := range r.Repositories {
+		// Infra failures have rows of their own.
+		if repo.Unchecked {
+			continue
+		}
+
+		for _, p := range repo.Problems {
+			if err := cw.Write([]string{repo.Root, repo.Repo, repo.Rev, "", "problem", p}); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range repo.Files {
+			if f.Status == statusOK {
+				continue
+			}
+
+			file := filepath.ToSlash(f.Path)
+
+			rev := f.Rev
+			if rev == "" {
+				rev = repo.Rev
+			}
+
+			if err := cw.Write([]string{path.Join(repo.Root, path.Dir(file)), repo.Repo, rev, file, f.Status, f.summary()}); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// summary describes how the file differs from its source in a few words.
+func (f *FileReport) summary() string {
+	switch f.Status {
+	case statusExtra:
+		return "not in the source"
+	case statusMissing:
+		return "not vendored"
+	case statusUnreadable:
+		return "couldn't be read: " + f.Error
+	}
+
+	var parts []string
+	if f.Streamed {
+		parts = append(parts, fmt.Sprintf("differs from byte %d, too big to diff", f.DiffersAt))
+	}
+	if len(f.Lines) > 0 {
+		lines := make([]string, len(f.Lines))
+		for i, l := range f.Lines {
+			lines[i] = fmt.Sprint(l)
+		}
+		parts = append(parts, "near lines "+strings.Join(lines, ", "))
+	}
+	if f.Cosmetic != "" {
+		parts = append(parts, f.Cosmetic)
+	}
+	if f.SameAs != "" {
+		parts = append(parts, "same changes as "+f.SameAs)
+	}
+	if f.Generated {
+		parts = append(parts, "generated code edited by hand")
+	}
+	if f.Native {
+		parts = append(parts, "native source")
+	}
+	if f.LineEndings != "" {
+		parts = append(parts, f.LineEndings)
+	}
+	if f.Truncated != "" {
+		parts = append(parts, "possibly truncated, "+f.Truncated)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// diffLineClass picks the CSS class used to colour a line of a unified diff.
+func diffLineClass(l string) string {
+	switch {
+	case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+		return "file"
+	case strings.HasPrefix(l, "@@"):
+		return "hunk"
+	case strings.HasPrefix(l, "+"):
+		return "add"
+	case strings.HasPrefix(l, "-"):
+		return "del"
+	}
+	return ""
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lines": func(s string) []string { return strings.Split(strings.TrimSpace(s), "\n") },
+	"class": diffLineClass,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Vendor verification: {{.Manifest}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.pass { color: #070; }
+.fail { color: #a00; font-weight: bold; }
+pre { background: #f6f6f6; padding: 0.5em; overflow-x: auto; }
+pre span { display: block; }
+.add { background: #dfd; }
+.del { background: #fdd; }
+.hunk { color: #05a; }
+.file { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Vendor verification: {{.Manifest}}</h1>
+<p class="{{if .Failed}}fail{{else}}pass{{end}}">{{if .Failed}}Failures were detected.{{else}}All files matched their sources.{{end}}</p>
+{{with .Problems}}<ul>{{range .}}<li class="fail">{{.}}</li>{{end}}</ul>{{end}}
+<table>
+<tr><th>Repository</th><th>Revision</th><th>Files checked</th><th>Files changed</th><th>Result</th></tr>
+{{range .Repositories}}<tr><td>{{.Root}}</td><td>{{.Rev}}</td><td>{{.Checked}}</td><td>{{.Changed}}</td><td class="{{if .Passed}}pass{{else}}fail{{end}}">{{if .Passed}}pass{{else}}fail{{end}}</td></tr>
+{{end}}</table>
+{{with .InfraFailures}}
+<h2>Couldn't be checked</h2>
+<table>
+<tr><th>Repository</th><th>Revision</th><th>Stage</th><th>Error</th></tr>
+{{range .}}<tr><td>{{.Root}}</td><td>{{.Rev}}</td><td>{{.Stage}}</td><td class="fail">{{.Error}}{{with .Stderr}}<pre>{{.}}</pre>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Repositories}}{{if not .Passed}}
+<h2>{{.Root}}</h2>
+{{with .Problems}}<ul>{{range .}}<li class="fail">{{.}}</li>{{end}}</ul>{{end}}
+{{range .Files}}{{if ne .Status "ok"}}<details>
+<summary>{{.Path}} ({{.Status}}{{with .Lines}}, near lines{{range $i, $l := .}}{{if $i}},{{end}} {{$l}}{{end}}{{end}}{{if .Streamed}}, differs from byte {{.DiffersAt}}{{end}}{{with .Cosmetic}}, {{.}}{{end}}{{if .Generated}}, generated code edited by hand{{end}}{{if .Native}}, native source{{end}}{{with .LineEndings}}, {{.}}{{end}}{{with .Truncated}}, possibly truncated, {{.}}{{end}}{{with .Error}}, {{.}}{{end}})</summary>
+{{with .UpstreamCommits}}<p>Later upstream commits to this file:</p><ul>{{range .}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{with .Diff}}<pre>{{range lines .}}<span class="{{class .}}">{{.}}</span>{{end}}</pre>{{end}}
+</details>
+{{end}}{{end}}{{end}}{{end}}
+</body>
+</html>
+`))
+
+func writeHTMLReport(w io.Writer, r *Report) error {
+	return htmlReportTemplate.Execute(w, r)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// ReportChanges are the mismatches that appeared and went away since an
+// earlier report, with -compare-report.
+type ReportChanges struct {
+	Baseline   string
+	Introduced []string `json:",omitempty"`
+	Resolved   []string `json:",omitempty"`
+}
+
+func readReport(path string) (*Report, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Report
+	if err := json.Unmarshal(d, &r); err != nil {
+		return nil, fmt.Errorf("couldn't read report %q: %s", path, err)
+	}
+
+	return &r, nil
+}
+
+// mismatch is something that failed a run: a file that didn't match, a
+// problem or an infra failure. Root is the repository it's in, if any.
+type mismatch struct {
+	Root string
+	Line string
+}
+
+// mismatches returns every mismatch in r, keyed by what stays the same about
+// it from one run to the next.
+func (r *Report) mismatches() map[string]mismatch {
+	m := make(map[string]mismatch)
+
+	for _, p := range r.Problems {
+		m[p] = mismatch{Line: p}
+	}
+
+	for _, f := range r.InfraFailures {
+		m["infra "+f.Root+" "+f.Rev] = mismatch{f.Root, fmt.Sprintf("%s at %s couldn't be checked (%s)", f.Root, f.Rev, f.Stage)}
+	}
+
+	for _, repo := range r.Repositories {
+		for _, p := range repo.Problems {
+			m[repo.Root+": "+p] = mismatch{repo.Root, repo.Root + ": " + p}
+		}
+
+		for _, f := range repo.Files {
+			if f.Status == statusOK {
+				continue
+			}
+
+			file := repo.Root + "/" + filepath.ToSlash(f.Path)
+
+			line := file + " " + f.Status
+			if s := f.summary(); s != "" {
+				line += " (" + s + ")"
+			}
+
+			m[file+" "+f.Status] = mismatch{repo.Root, line}
+		}
+	}
+
+	return m
+}
+
+// compareReports returns the mismatches in current that weren't in previous,
+// and those in previous that aren't in current any more, each sorted.
+// Repositories skipped in current weren't looked at, so theirs aren't counted
+// as resolved.
+func compareReports(previous, current *Report) (introduced, resolved []string) {
+	before, after := previous.mismatches(), current.mismatches()
+
+	skipped := make(map[string]bool)
+	for _, repo := range current.Repositories {
+		skipped[repo.Root] = repo.Skipped
+	}
+
+	for key, m := range after {
+		if _, ok := before[key]; !ok {
+			introduced = append(introduced, m.Line)
+		}
+	}
+
+	for key, m := range before {
+		if _, ok := after[key]; !ok && !skipped[m.Root] {
+			resolved = append(resolved, m.Line)
+		}
+	}
+
+	sort.Strings(introduced)
+	sort.Strings(resolved)
+
+	return introduced, resolved
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	texttemplate "text/template"
+)
+
+// reportTemplates are the built-in templates -template can name.
+var reportTemplates = map[string]string{
+	// summary is a line for each repository, then the files and problems
+	// that failed it.
+	"summary": `{{range .Repositories}}{{if .Unchecked}}ERROR{{else if .Skipped}}skip {{else if .Passed}}ok   {{else}}FAIL {{end}} {{.Root}} {{.Rev}}
+{{range failures .}}      {{.}}
+{{end}}{{end}}{{range .Problems}}{{.}}
+{{end}}{{if .Failed}}FAIL{{else}}ok{{end}}
+`,
+	// markdown is a table of the repositories that failed, for pasting
+	// into a pull request or an issue.
+	"markdown": "**Vendor verification of `{{.Manifest}}` {{if .Failed}}failed{{else}}passed{{end}}.**\n" +
+		"{{with .Problems}}\n{{range .}}- {{.}}\n{{end}}{{end}}" +
+		"{{with failedRepos .}}\n| Repository | Revision | What's wrong |\n| --- | --- | --- |\n" +
+		"{{range .}}| `{{.Root}}` | `{{.Rev}}` | {{join (failures .) \"<br>\"}} |\n{{end}}{{end}}",
+}
+
+// reportTemplateFuncs are the functions templates can use, beyond the
+// standard ones.
+var reportTemplateFuncs = texttemplate.FuncMap{
+	"join":    strings.Join,
+	"summary": func(f *FileReport) string { return f.summary() },
+	// failures describes each file in a repository that didn't match, and
+	// each of its other problems.
+	"failures": func(repo *RepositoryReport) []string {
+		var lines []string
+		for _, f := range repo.Files {
+			if f.Status == statusOK {
+				continue
+			}
+
+			line := f.Status + " " + f.Path
+			if s := f.summary(); s != "" {
+				line += " (" + s + ")"
+			}
+			lines = append(lines, line)
+		}
+		return append(lines, repo.Problems...)
+	},
+	"failedRepos": func(r *Report) []*RepositoryReport {
+		var failed []*RepositoryReport
+		for _, repo := range r.Repositories {
+			if !repo.Passed() {
+				failed = append(failed, repo)
+			}
+		}
+		return failed
+	},
+}
+
+// reportTemplate is the template given with -template, for -format=template.
+var reportTemplate *texttemplate.Template
+
+// parseReportTemplate parses the template for -template, which is the name of
+// a built-in one, the path of a file holding one, or the template itself.
+func parseReportTemplate(s string) (*texttemplate.Template, error) {
+	text, ok := reportTemplates[s]
+	if !ok {
+		text = s
+
+		if d, err := ioutil.ReadFile(s); err == nil {
+			text = string(d)
+		} else if !os.IsNotExist(err) && !strings.Contains(s, "{{") {
+			return nil, err
+		}
+	}
+
+	return texttemplate.New("report").Funcs(reportTemplateFuncs).Parse(text)
+}
+
+func writeTemplateReport(w io.Writer, r *Report) error {
+	return reportTemplate.Execute(w, r)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// repository is everything we know about one repository root: where it comes
+// from, which of its packages are vendored, and where it's checked out.
+type repository struct {
+	Name     string
+	Root     *vcs.RepoRoot
+	Packages []Dep
+	// Checkouts has one entry per distinct revision that the repository's
+	// packages are pinned at, in the order they were first seen. Almost every
+	// repository has exactly one, but the packages of a repository that was
+	// split up can legitimately be vendored at different revisions.
+	Checkouts []*checkout
+	// Accepted are checkouts at the other revisions given for the repository
+	// with -accept-rev, which files that don't match their own checkout may
+	// match instead.
+	Accepted []*checkout
+	Report   *RepositoryReport
+	// acceptedFiles are the files that only matched one of Accepted.
+	acceptedFiles []acceptedFile
+	// Skip is set when the repository doesn't need to be verified again,
+	// because nothing about it changed since it last passed.
+	Skip bool
+	// Broken is set when the repository couldn't be checked out and
+	// -keep-going was given, so it can't be compared.
+	Broken bool
+	// Replacement is the module that replaces this one in go.mod, when Root
+	// is that module's repository rather than this one's.
+	Replacement string
+	// LocalDir is the directory that replaces the module in go.mod, when it's
+	// replaced by a local directory rather than another module, or the one
+	// given for it with -local-src. It's compared against as it is.
+	LocalDir string
+}
+
+// cacheName is the name the repository's checkouts are kept under in the
+// cache, which is that of the repository they come from.
+func (r *repository) cacheName() string {
+	if r.Replacement != "" {
+		return r.Root.Root
+	}
+
+	return r.Name
+}
+
+// nestedRoots returns the roots of the other repositories in repos that are
+// vendored inside this one, relative to its root, with slashes. A vanity
+// domain can hand its subpaths to different repositories, and the files
+// under those are theirs, not this repository's.
+func (r *repository) nestedRoots(repos map[string]*repository) map[string]bool {
+	nested := make(map[string]bool)
+	for name := range repos {
+		if strings.HasPrefix(name, r.Name+"/") {
+			nested[strings.TrimPrefix(name, r.Name+"/")] = true
+		}
+	}
+
+	return nested
+}
+
+// insideAnother reports whether the repository's root is inside that of
+// another of repos, going by the names they're cached under.
+func (r *repository) insideAnother(repos map[string]*repository) bool {
+	for _, other := range repos {
+		if other != r && strings.HasPrefix(r.cacheName(), other.cacheName()+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkout is a copy of a repository at one revision.
+type checkout struct {
+	Rev string
+	// Version is the manifest's comment for the revision, if it has one, and
+	// otherwise the revision itself.
+	Version string
+	Dir     string
+	// Subdir is the directory of the repository that Dir holds, for a module
+	// from a subdirectory of its repository, which is extracted on its own.
+	// It's empty when Dir holds the whole repository.
+	Subdir string
+	// Substitute is the commit checked out in place of Rev, with
+	// -allow-missing-rev, when Rev no longer exists upstream.
+	Substitute string
+	// URL and Type are where Dir's files came from and how: for a clone, the
+	// URL git fetches from once any insteadOf settings are applied, and git.
+	URL  string
+	Type string
+	// Cached is set when Dir was already in the cache or the store, rather
+	// than being cloned or extracted for this run, for -metrics-output.
+	Cached bool
+}
+
+// commit returns the commit checked out in c.Dir.
+func (c *checkout) commit() string {
+	if c.Substitute != "" {
+		return c.Substitute
+	}
+
+	return c.Rev
+}
+
+// relative returns the path within c.Dir of the file or directory at
+// relativePath (relative to the repository root). It returns false if the
+// path is outside c.Subdir, so it isn't in the checkout.
+func (c *checkout) relative(relativePath string) (string, bool) {
+	switch {
+	case c.Subdir == "":
+		return relativePath, true
+	case relativePath == c.Subdir:
+		return "", true
+	case strings.HasPrefix(relativePath, c.Subdir+"/"):
+		return strings.TrimPrefix(relativePath, c.Subdir+"/"), true
+	}
+
+	return "", false
+}
+
+// add records that the package d is vendored from the repository.
+func (r *repository) add(d Dep) {
+	r.Packages = append(r.Packages, d)
+
+	for _, c := range r.Checkouts {
+		if c.Rev == d.Rev {
+			return
+		}
+	}
+
+	version := d.Comment
+	if version == "" {
+		version = d.Rev
+	}
+
+	r.Checkouts = append(r.Checkouts, &checkout{Rev: d.Rev, Version: version})
+}
+
+// checkout returns the checkout at rev.
+func (r *repository) checkout(rev string) *checkout {
+	for _, c := range r.Checkouts {
+		if c.Rev == rev {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// checkoutFor returns the checkout to compare the file at relativePath
+// (relative to the repository root) against. That's the checkout for the
+// package with the longest import path containing the file, or the first
+// checkout if no package contains it.
+func (r *repository) checkoutFor(relativePath string) *checkout {
+	best, bestLength := r.Checkouts[0], -1
+
+	for _, d := range r.Packages {
+		dir := strings.TrimPrefix(strings.TrimPrefix(d.ImportPath, r.Name), "/")
+		if dir != "" && !strings.HasPrefix(relativePath, dir+"/") {
+			continue
+		}
+
+		if len(dir) > bestLength {
+			best, bestLength = r.checkout(d.Rev), len(dir)
+		}
+	}
+
+	return best
+}
+
+// packageDir is a directory, relative to the repository root, that files are
+// vendored from, and the checkout to look for them in.
+type packageDir struct {
+	Dir      string
+	Checkout *checkout
+}
+
+// packageDirs returns the directories of the repository's vendored packages.
+// With withParents, the directories above each package are included as well,
+// since godep copies license files from them too.
+func (r *repository) packageDirs(withParents bool) []packageDir {
+	var dirs []packageDir
+	seen := make(map[packageDir]bool)
+
+	for _, d := range r.Packages {
+		co := r.checkout(d.Rev)
+
+		dir := strings.TrimPrefix(strings.TrimPrefix(d.ImportPath, r.Name), "/")
+		for {
+			if pd := (packageDir{dir, co}); !seen[pd] {
+				dirs = append(dirs, pd)
+				seen[pd] = true
+			}
+
+			if !withParents || dir == "" {
+				break
+			}
+
+			if dir = path.Dir(dir); dir == "." {
+				dir = ""
+			}
+		}
+	}
+
+	return dirs
+}
+
+// hasSourceDir reports whether dir (relative to the repository root, with
+// slashes) is a directory in the source, in any of the repository's
+// checkouts, ignoring case with -case-insensitive-match. It's true if none
+// of the checkouts hold it, as it can't be looked for.
+func (r *repository) hasSourceDir(dir string) bool {
+	looked := false
+
+	for _, co := range r.Checkouts {
+		inner, ok := co.relative(dir)
+		if !ok || co.Dir == "" {
+			continue
+		}
+		looked = true
+
+		if fi, err := os.Stat(filepath.Join(co.Dir, filepath.FromSlash(inner))); err == nil && fi.IsDir() {
+			return true
+		}
+
+		if *caseInsensitive {
+			if p, ok := findFoldedPath(co.Dir, filepath.FromSlash(inner)); ok {
+				if fi, err := os.Stat(filepath.Join(co.Dir, p)); err == nil && fi.IsDir() {
+					return true
+				}
+			}
+		}
+	}
+
+	return !looked
+}
+
+// modulePaths returns the paths the module holding co's packages might have,
+// longest first: the import paths of its packages, then each of their parent
+// directories up to the repository root. go.mod manifests list the modules
+// themselves, so the first is right for those.
+func (r *repository) modulePaths(co *checkout) []string {
+	var paths []string
+	seen := make(map[string]bool)
+
+	for _, d := range r.Packages {
+		if d.Rev != co.Rev {
+			continue
+		}
+
+		for p := d.ImportPath; strings.HasPrefix(p, r.Name+"/") || p == r.Name; p = path.Dir(p) {
+			if !seen[p] {
+				paths = append(paths, p)
+				seen[p] = true
+			}
+
+			if p == r.Name {
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+
+	return paths
+}
+
+// fileRev returns the revision to record against a file compared with co in
+// reports. It's only needed when the repository has several revisions, or
+// accepts others, so it's empty otherwise.
+func (r *repository) fileRev(co *checkout) string {
+	if len(r.Checkouts) > 1 || len(r.Accepted) > 0 {
+		return co.Rev
+	}
+
+	return ""
+}
+
+// revs returns the revisions of all the repository's checkouts.
+func (r *repository) revs() []string {
+	revs := make([]string, len(r.Checkouts))
+	for i, c := range r.Checkouts {
+		revs[i] = c.Rev
+	}
+	return revs
+}
+
+// isDowngrade reports whether c is at an older commit than previous, which is
+// to say an ancestor of it. It's false if c wasn't cloned with git, or
+// doesn't have previous, as there's no way to tell.
+func isDowngrade(ctx context.Context, c *checkout, previous string) (bool, error) {
+	if c.Rev == previous {
+		return false, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(c.Dir, ".git")); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if !gitHasCommit(ctx, c.Dir, previous) {
+		return false, nil
+	}
+
+	return gitIsAncestor(ctx, c.Dir, c.commit(), previous)
+}
+
+// recentlyChanged returns the files (relative to the repository root, with
+// slashes) that were changed upstream within window before c.Rev was
+// committed.
+func (c *checkout) recentlyChanged(ctx context.Context, window time.Duration) (map[string]bool, error) {
+	t, err := gitCommitTime(ctx, c.Dir, c.commit())
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := gitChangedFiles(ctx, c.Dir, c.commit(), t.Add(-window))
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, l := range strings.Split(string(out), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			changed[l] = true
+		}
+	}
+
+	return changed, nil
+}
+
+// upstreamCommits lists the commits between c.Rev and the upstream HEAD that
+// touch relativePath. It returns false if c wasn't cloned with git, so there's
+// no history to look at.
+func (c *checkout) upstreamCommits(ctx context.Context, relativePath string) ([]string, bool, error) {
+	if _, err := os.Stat(filepath.Join(c.Dir, ".git")); err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	out, err := gitLog(ctx, c.Dir, c.commit(), "origin/HEAD", filepath.ToSlash(relativePath))
+	if err != nil {
+		return nil, false, err
+	}
+
+	var commits []string
+	for _, l := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if l != "" {
+			commits = append(commits, l)
+		}
+	}
+
+	return commits, true, nil
+}
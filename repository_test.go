@@ -0,0 +1,119 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// vanityRepos are two repositories served from one vanity prefix, with one
+// vendored inside the other, and an unrelated one whose name shares a prefix
+// with them without being under them.
+func vanityRepos() map[string]*repository {
+	repos := make(map[string]*repository)
+
+	for _, name := range []string{"example.com/v", "example.com/v/sub", "example.com/vv"} {
+		repos[name] = &repository{Name: name, Root: &vcs.RepoRoot{Root: name, Repo: "https://" + name}}
+	}
+
+	return repos
+}
+
+func TestNestedRoots(t *testing.T) {
+	repos := vanityRepos()
+
+	tests := []struct {
+		name string
+		want map[string]bool
+	}{
+		{"example.com/v", map[string]bool{"sub": true}},
+		{"example.com/v/sub", map[string]bool{}},
+		{"example.com/vv", map[string]bool{}},
+	}
+
+	for _, tt := range tests {
+		if got := repos[tt.name].nestedRoots(repos); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("nestedRoots of %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInsideAnother(t *testing.T) {
+	repos := vanityRepos()
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"example.com/v", false},
+		{"example.com/v/sub", true},
+		{"example.com/vv", false},
+	}
+
+	for _, tt := range tests {
+		if got := repos[tt.name].insideAnother(repos); got != tt.want {
+			t.Errorf("insideAnother for %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckoutForDeeperPackage(t *testing.T) {
+	r := &repository{Name: "example.com/v"}
+	r.add(Dep{ImportPath: "example.com/v", Rev: "aaa"})
+	r.add(Dep{ImportPath: "example.com/v/deep", Rev: "bbb"})
+	r.add(Dep{ImportPath: "example.com/v/deeper", Rev: "ccc"})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"v.go", "aaa"},
+		{"deep/d.go", "bbb"},
+		{"deep/inner/d.go", "bbb"},
+		{"deeper/d.go", "ccc"},
+		{"deepest/d.go", "aaa"},
+	}
+
+	for _, tt := range tests {
+		if got := r.checkoutFor(tt.path).Rev; got != tt.want {
+			t.Errorf("checkoutFor(%q) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNestedCachePaths(t *testing.T) {
+	defer func(p string) { *cachePath = p }(*cachePath)
+	*cachePath = "cache"
+
+	repos := vanityRepos()
+	cfg := &config{}
+
+	paths := make(map[string]string)
+	for name, repo := range repos {
+		p := cfg.repositoryCachePath(name, repo.insideAnother(repos))
+
+		if other, ok := paths[p]; ok {
+			t.Errorf("%s and %s are both cached at %s", name, other, p)
+		}
+		paths[p] = name
+
+		// One checkout mustn't be inside another, or cloning the outer one
+		// would see the inner one's files.
+		for q, other := range paths {
+			if q != p && (hasPathPrefix(p, q) || hasPathPrefix(q, p)) {
+				t.Errorf("%s at %s and %s at %s overlap", name, p, other, q)
+			}
+		}
+	}
+
+	if want := filepath.Join("cache", "vendor-verify", "_nested", "example.com%2Fv%2Fsub"); cfg.repositoryCachePath("example.com/v/sub", true) != want {
+		t.Errorf("nested checkout is at %s, want %s", cfg.repositoryCachePath("example.com/v/sub", true), want)
+	}
+}
+
+func hasPathPrefix(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !filepath.IsAbs(rel) && len(rel) > 0 && rel[0] != '.'
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+const (
+	// resolutionTTL is how long a successful resolution is reused for.
+	resolutionTTL = 24 * time.Hour
+	// failedResolutionTTL is how long a failed resolution is reused for. It's
+	// short so that a fixed import path is noticed soon, but long enough to
+	// avoid repeating the same slow failing lookup on every run.
+	failedResolutionTTL = time.Hour
+)
+
+// resolution is the cached result of resolving an import path.
+type resolution struct {
+	Root  string `json:",omitempty"`
+	Repo  string `json:",omitempty"`
+	VCS   string `json:",omitempty"`
+	Error string `json:",omitempty"`
+	Time  time.Time
+}
+
+// rootOverrideMap maps import paths to the repositories they're resolved to
+// no matter what, as given with -repo-root-override.
+type rootOverrideMap map[string]resolution
+
+// rootOverrides are the overrides given with -repo-root-override.
+var rootOverrides = make(rootOverrideMap)
+
+func (m rootOverrideMap) String() string {
+	var s []string
+	for p, r := range m {
+		s = append(s, p+"="+r.Root+","+r.Repo+","+r.VCS)
+	}
+	sort.Strings(s)
+
+	return strings.Join(s, " ")
+}
+
+// Set adds an override of the form importpath=root,repo or
+// importpath=root,repo,vcs. The version control system defaults to git.
+func (m rootOverrideMap) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%q isn't of the form importpath=root,repo[,vcs]", s)
+	}
+
+	importPath, fields := s[:i], strings.Split(s[i+1:], ",")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] == "" || fields[1] == "" {
+		return fmt.Errorf("%q isn't of the form importpath=root,repo[,vcs]", s)
+	}
+
+	r := resolution{Root: fields[0], Repo: fields[1], VCS: "git"}
+	if len(fields) == 3 {
+		r.VCS = fields[2]
+	}
+
+	if importPath != r.Root && !strings.HasPrefix(importPath, r.Root+"/") {
+		return fmt.Errorf("repository root %s doesn't contain %s", r.Root, importPath)
+	}
+
+	if vcs.ByCmd(r.VCS) == nil {
+		return fmt.Errorf("unknown version control system %q", r.VCS)
+	}
+
+	m[importPath] = r
+
+	return nil
+}
+
+// resolutionCache remembers how import paths resolved to repositories, and
+// which import paths failed to resolve, across runs.
+type resolutionCache struct {
+	path    string
+	entries map[string]resolution
+	// fixed is set for a file written by -resolve-only. Its entries never
+	// expire, nothing is resolved over the network, and it's never written
+	// back.
+	fixed bool
+}
+
+func loadResolutionCache(path string) (*resolutionCache, error) {
+	c := resolutionCache{path: path, entries: make(map[string]resolution)}
+
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &c, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(d, &c.entries); err != nil {
+		return nil, fmt.Errorf("couldn't read resolution cache %q: %s", path, err)
+	}
+
+	return &c, nil
+}
+
+// loadFixedResolution reads a file written by -resolve-only.
+func loadFixedResolution(path string) (*resolutionCache, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := resolutionCache{path: path, entries: make(map[string]resolution), fixed: true}
+	if err := json.Unmarshal(d, &c.entries); err != nil {
+		return nil, fmt.Errorf("couldn't read resolution file %q: %s", path, err)
+	}
+
+	return &c, nil
+}
+
+// resolve returns the repository for importPath, from the cache if there's a
+// fresh enough entry for it and refresh isn't set.
+func (c *resolutionCache) resolve(importPath string, refresh bool) (*vcs.RepoRoot, error) {
+	if o, ok := rootOverrides[importPath]; ok {
+		if *verbose {
+			fmt.Fprintf(output, "resolving %s to %s, as given with -repo-root-override\n", importPath, o.Repo)
+		}
+
+		return &vcs.RepoRoot{VCS: vcs.ByCmd(o.VCS), Repo: o.Repo, Root: o.Root}, nil
+	}
+
+	if c.fixed {
+		e, ok := c.entries[importPath]
+		if !ok || e.Error != "" {
+			return nil, fmt.Errorf("%s isn't resolved in %q; run -resolve-only again", importPath, c.path)
+		}
+
+		cmd := vcs.ByCmd(e.VCS)
+		if cmd == nil {
+			return nil, fmt.Errorf("%s is resolved to unknown version control system %q in %q", importPath, e.VCS, c.path)
+		}
+
+		return &vcs.RepoRoot{VCS: cmd, Repo: e.Repo, Root: e.Root}, nil
+	}
+
+	if e, ok := c.entries[importPath]; ok && !refresh {
+		ttl := resolutionTTL
+		if e.Error != "" {
+			ttl = failedResolutionTTL
+		}
+
+		if time.Since(e.Time) < ttl {
+			if e.Error != "" {
+				return nil, fmt.Errorf("%s (cached, use -refresh-resolution to retry)", e.Error)
+			}
+
+			if cmd := vcs.ByCmd(e.VCS); cmd != nil {
+				if *verbose {
+					fmt.Fprintf(output, "using cached resolution of %s to %s\n", importPath, e.Repo)
+				}
+
+				return &vcs.RepoRoot{VCS: cmd, Repo: e.Repo, Root: e.Root}, nil
+			}
+		}
+	}
+
+	rr, err := vcs.RepoRootForImportPath(importPath, *verbose)
+	if err != nil {
+		c.entries[importPath] = resolution{Error: err.Error(), Time: time.Now()}
+		return nil, err
+	}
+
+	c.entries[importPath] = resolution{Root: rr.Root, Repo: rr.Repo, VCS: rr.VCS.Cmd, Time: time.Now()}
+
+	return rr, nil
+}
+
+func (c *resolutionCache) save() error {
+	if c.fixed {
+		return nil
+	}
+
+	d, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path, d, 0644)
+}
+
+// repoHost returns the host name of a repository URL, which may be either a
+// URL or an scp-style "user@host:path" address.
+func repoHost(repo string) string {
+	if u, err := url.Parse(repo); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+
+	if i := strings.Index(repo, ":"); i != -1 && !strings.Contains(repo[:i], "/") {
+		host := repo[:i]
+		if j := strings.LastIndex(host, "@"); j != -1 {
+			host = host[j+1:]
+		}
+		return host
+	}
+
+	return ""
+}
+
+// checkSameHost returns an error if rr's repository is served from a
+// different host than the one named by importPath. That's normal for vanity
+// import paths, but it's also what a hijacked go-import meta tag looks like.
+func checkSameHost(importPath string, rr *vcs.RepoRoot) error {
+	want := strings.SplitN(importPath, "/", 2)[0]
+	if got := repoHost(rr.Repo); got != want {
+		return fmt.Errorf("%s resolved to %s, which is on %s rather than %s; the import path may have been redirected or hijacked", importPath, rr.Repo, got, want)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// revResolver works out the revision to check out for the version a manifest
+// records for a dependency. Each manifest format records versions its own
+// way, so each has its own resolver.
+type revResolver interface {
+	// resolveRev returns the revision to check out for d, which is vendored
+	// from the repository with the given root. The root is empty when it
+	// isn't known yet.
+	resolveRev(d Dep, root string) string
+}
+
+// revResolverFor returns the resolver for the format m was read from.
+func revResolverFor(m Manifest) revResolver {
+	switch m.(type) {
+	case *goMod, *goWork:
+		return moduleRevs{}
+	}
+
+	return commitRevs{}
+}
+
+// commitRevs resolves the versions of manifests that record the commit each
+// dependency is at, like godep's, which are checked out as they are.
+type commitRevs struct{}
+
+func (commitRevs) resolveRev(d Dep, root string) string {
+	return d.Rev
+}
+
+// majorVersionSuffix matches the major version at the end of a module path
+// in a subdirectory of its repository, which isn't part of its tags.
+var majorVersionSuffix = regexp.MustCompile(`(^|/)v[0-9]+$`)
+
+// moduleRevs resolves module versions. A pseudo-version is the commit it
+// names, and anything else is a tag, without any +incompatible suffix and
+// prefixed with the directory the module is in, when that isn't the root of
+// its repository.
+type moduleRevs struct{}
+
+func (moduleRevs) resolveRev(d Dep, root string) string {
+	if commit, ok := pseudoVersionRev(d.Rev); ok {
+		return commit
+	}
+
+	tag := strings.TrimSuffix(d.Rev, "+incompatible")
+
+	if root == "" || !strings.HasPrefix(d.ImportPath, root+"/") {
+		return tag
+	}
+
+	if dir := majorVersionSuffix.ReplaceAllString(strings.TrimPrefix(d.ImportPath, root+"/"), ""); dir != "" {
+		tag = dir + "/" + tag
+	}
+
+	return tag
+}
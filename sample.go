@@ -0,0 +1,20 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// inSample reports whether the file at p is one of the percent of files
+// picked with seed. The choice only depends on the seed and the path, so a
+// sampled run can be repeated exactly by passing the same seed.
+func inSample(p string, percent float64, seed int64) bool {
+	if percent >= 100 {
+		return true
+	}
+
+	h := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s", seed, p)))
+
+	return float64(binary.BigEndian.Uint64(h[:8])%1000000) < percent*10000
+}
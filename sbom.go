@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// cycloneDX is the part of a CycloneDX JSON SBOM that lists components.
+type cycloneDX struct {
+	BOMFormat  string          `json:"bomFormat"`
+	Components []sbomComponent `json:"components"`
+}
+
+type sbomComponent struct {
+	Name       string          `json:"name"`
+	Version    string          `json:"version"`
+	PURL       string          `json:"purl"`
+	Components []sbomComponent `json:"components"`
+}
+
+// sbomModule is a Go module or package listed in an SBOM, going by its
+// package URL.
+type sbomModule struct {
+	Path    string
+	Version string
+}
+
+// readSBOM returns the Go components of the CycloneDX SBOM at path, including
+// nested ones. Components that aren't Go packages are left out.
+func readSBOM(path string) ([]sbomModule, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var bom cycloneDX
+	if err := json.Unmarshal(d, &bom); err != nil {
+		return nil, fmt.Errorf("couldn't read SBOM %q: %s", path, err)
+	}
+
+	if bom.BOMFormat != "CycloneDX" {
+		return nil, fmt.Errorf("SBOM %q isn't in CycloneDX format", path)
+	}
+
+	var modules []sbomModule
+	var add func(components []sbomComponent) error
+	add = func(components []sbomComponent) error {
+		for _, c := range components {
+			if strings.HasPrefix(c.PURL, "pkg:golang/") {
+				m, err := parseGolangPURL(c.PURL)
+				if err != nil {
+					return fmt.Errorf("SBOM %q has an invalid package URL for %s: %s", path, c.Name, err)
+				}
+				if m.Version == "" {
+					m.Version = c.Version
+				}
+
+				modules = append(modules, m)
+			}
+
+			if err := add(c.Components); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return modules, add(bom.Components)
+}
+
+// parseGolangPURL parses a package URL like
+// pkg:golang/github.com/pkg/errors@v0.9.1, ignoring any qualifiers or subpath.
+func parseGolangPURL(purl string) (sbomModule, error) {
+	s := strings.TrimPrefix(purl, "pkg:golang/")
+	if i := strings.IndexAny(s, "?#"); i != -1 {
+		s = s[:i]
+	}
+
+	var m sbomModule
+
+	p, v := s, ""
+	if i := strings.LastIndex(s, "@"); i != -1 {
+		p, v = s[:i], s[i+1:]
+	}
+
+	var err error
+	if m.Path, err = url.PathUnescape(p); err != nil {
+		return m, err
+	}
+	if m.Version, err = url.PathUnescape(v); err != nil {
+		return m, err
+	}
+
+	if m.Path == "" {
+		return m, fmt.Errorf("no path in %q", purl)
+	}
+
+	return m, nil
+}
+
+// versionMatches reports whether an SBOM's version for a dependency is the
+// one d is at: its version, its revision or an abbreviation of it, or a
+// pseudo-version for that revision.
+func versionMatches(version string, d Dep) bool {
+	if version == d.Comment || version == d.Rev {
+		return true
+	}
+
+	if len(version) >= 7 && strings.HasPrefix(d.Rev, version) {
+		return true
+	}
+
+	if commit, ok := pseudoVersionRev(version); ok {
+		return strings.HasPrefix(d.Rev, commit) || strings.HasPrefix(commit, d.Rev)
+	}
+
+	return false
+}
+
+// checkSBOM cross-checks deps against the modules listed in an SBOM. Each
+// dependency is matched to the module with the longest path containing it,
+// since SBOMs usually list modules and manifests can list packages.
+func checkSBOM(deps []Dep, modules []sbomModule) []string {
+	var problems []string
+	used := make([]bool, len(modules))
+
+	for _, d := range deps {
+		found := -1
+		for i, m := range modules {
+			if (d.ImportPath == m.Path || strings.HasPrefix(d.ImportPath, m.Path+"/")) && (found == -1 || len(m.Path) > len(modules[found].Path)) {
+				found = i
+			}
+		}
+
+		version := d.Comment
+		if version == "" {
+			version = d.Rev
+		}
+
+		if found == -1 {
+			problems = append(problems, fmt.Sprintf("%s at %s isn't in the SBOM", d.ImportPath, version))
+			continue
+		}
+
+		// The SBOM might list the module at several versions, e.g. when it
+		// covers more than one build, so any of them will do.
+		matched := false
+		for i, m := range modules {
+			if m.Path == modules[found].Path && versionMatches(m.Version, d) {
+				used[i], matched = true, true
+			}
+		}
+
+		if !matched {
+			used[found] = true
+			problems = append(problems, fmt.Sprintf("%s is at %s, but the SBOM lists %s at %s", d.ImportPath, version, modules[found].Path, modules[found].Version))
+		}
+	}
+
+	for i, m := range modules {
+		if !used[i] {
+			problems = append(problems, fmt.Sprintf("SBOM lists %s at %s, which isn't vendored", m.Path, m.Version))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The self-test fixture is a manifest with a single small public dependency,
+// plus a vendored copy of one of its files. Verifying it exercises
+// resolution, cloning, checkout and comparison without depending on anything
+// in the user's own project.
+const selfTestManifest = `{
+	"ImportPath": "fknsrs.biz/p/godep-verify/self-test",
+	"GodepVersion": "v79",
+	"Deps": [
+		{
+			"ImportPath": "github.com/pmezard/go-difflib/difflib",
+			"Comment": "v1.0.0",
+			"Rev": "792786c7400a136282c1664665ae0a8db921c6c2"
+		}
+	]
+}
+`
+
+const selfTestLicense = `Copyright (c) 2013, Patrick Mezard
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+    Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+    Redistributions in binary form must reproduce the above copyright
+notice, this list of conditions and the following disclaimer in the
+documentation and/or other materials provided with the distribution.
+    The names of its contributors may not be used to endorse or promote
+products derived from this software without specific prior written
+permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED
+TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A
+PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+`
+
+// writeSelfTestFixture writes the self-test manifest and vendor tree under
+// dir, returning the paths of each.
+func writeSelfTestFixture(dir string) (string, string, error) {
+	manifest := filepath.Join(dir, "Godeps", "Godeps.json")
+	vendor := filepath.Join(dir, "vendor")
+	license := filepath.Join(vendor, "github.com", "pmezard", "go-difflib", "LICENSE")
+
+	for _, f := range []struct{ path, content string }{
+		{manifest, selfTestManifest},
+		{license, selfTestLicense},
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+			return "", "", err
+		}
+
+		if err := ioutil.WriteFile(f.path, []byte(f.content), 0644); err != nil {
+			return "", "", err
+		}
+	}
+
+	return manifest, vendor, nil
+}
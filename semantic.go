@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// canonicalizers turn config files into a canonical form, keyed by file
+// extension, so that files which differ only in formatting compare equal.
+var canonicalizers = map[string]func(d []byte) ([]byte, error){
+	".json": canonicalJSON,
+	".yaml": canonicalYAML,
+	".yml":  canonicalYAML,
+}
+
+// semanticEqual reports whether a and b are equivalent config files. It
+// returns false with no error for files that aren't config files, and an
+// error for config files that couldn't be parsed.
+func semanticEqual(relativePath string, a, b []byte) (bool, error) {
+	fn, ok := canonicalizers[strings.ToLower(path.Ext(relativePath))]
+	if !ok {
+		return false, nil
+	}
+
+	ca, err := fn(a)
+	if err == errNoYAML {
+		return false, err
+	} else if err != nil {
+		return false, fmt.Errorf("vendored file: %s", err)
+	}
+
+	cb, err := fn(b)
+	if err != nil {
+		return false, fmt.Errorf("source file: %s", err)
+	}
+
+	return bytes.Equal(ca, cb), nil
+}
+
+// canonicalJSON re-encodes a JSON document, which sorts object keys and drops
+// insignificant whitespace. Numbers are kept as written.
+func canonicalJSON(d []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(d))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+
+	return json.Marshal(v)
+}
+
+var errNoYAML = errors.New("YAML isn't supported yet")
+
+// canonicalYAML always fails, as there's no YAML parser vendored. It's here so
+// that YAML files are reported as being compared byte for byte.
+func canonicalYAML(d []byte) ([]byte, error) {
+	return nil, errNoYAML
+}
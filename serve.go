@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// serveFlags are the flags that only mean something to the server, or that
+// it sets itself for each run, so they aren't passed on to the runs.
+var serveFlags = []string{"serve", "serve-jobs", "format", "report-output", "template", "manifest-glob", "quiet"}
+
+// verifyRequest is what's posted to /verify: either the paths of a manifest
+// and vendor directory on the server, or a repository to clone and the paths
+// within it, which default to the usual ones.
+type verifyRequest struct {
+	Manifest string
+	Vendor   string
+	Repo     string
+	Rev      string
+}
+
+// serveError is the response when a run couldn't produce a report at all.
+type serveError struct {
+	Error  string
+	Output string `json:",omitempty"`
+}
+
+// server verifies what's posted to it by running this program again for each
+// request, with the flags the server was started with, so every run shares
+// its cache. No more than cap(jobs) run at once; the rest wait their turn.
+type server struct {
+	self string
+	args []string
+	jobs chan struct{}
+}
+
+// serve runs the HTTP server for -serve on addr until ctx is done.
+func serve(ctx context.Context, addr string, jobs int) error {
+	if jobs < 1 {
+		return fmt.Errorf("-serve-jobs has to be at least 1")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	s := &server{self: self, args: withoutFlags(os.Args[1:], serveFlags...), jobs: make(chan struct{}, jobs)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.health)
+	mux.HandleFunc("/verify", s.verify)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	fmt.Fprintf(output, "# Serving on %s, running up to %d verifications at once\n", addr, jobs)
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func (s *server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"Status": "ok", "Running": len(s.jobs), "Limit": cap(s.jobs)})
+}
+
+func (s *server) verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, serveError{Error: "/verify needs a POST"})
+		return
+	}
+
+	var req verifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, serveError{Error: "couldn't read the request: " + err.Error()})
+		return
+	}
+
+	if req.Repo == "" && (req.Manifest == "" || req.Vendor == "") {
+		writeJSON(w, http.StatusBadRequest, serveError{Error: "the request needs a Repo, or a Manifest and Vendor"})
+		return
+	}
+
+	if err := req.check(); err != nil {
+		writeJSON(w, http.StatusBadRequest, serveError{Error: err.Error()})
+		return
+	}
+
+	select {
+	case s.jobs <- struct{}{}:
+		defer func() { <-s.jobs }()
+	case <-r.Context().Done():
+		return
+	}
+
+	report, out, err := s.run(r.Context(), req)
+	if err != nil {
+		fmt.Fprintf(output, "[!] Couldn't verify %s: %s\n", req.describe(), err)
+		writeJSON(w, http.StatusInternalServerError, serveError{Error: err.Error(), Output: out})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(report)
+}
+
+// check refuses a request for a repository that isn't cloned over HTTPS or
+// SSH, so that no one can have the server read its own repositories with a
+// local path or file:// URL, or for a revision or repository that git would
+// take as an option. The paths in a request for a repository have to be in
+// its clone.
+func (req verifyRequest) check() error {
+	if req.Repo == "" {
+		return nil
+	}
+
+	if err := checkServedRepo(req.Repo); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(req.Rev, "-") {
+		return fmt.Errorf("the Rev %q isn't a revision", req.Rev)
+	}
+
+	for _, p := range []string{req.Manifest, req.Vendor} {
+		if p == "" {
+			continue
+		}
+
+		if clean := filepath.Clean(p); filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%q isn't in the repository; with a Repo, Manifest and Vendor are relative to its clone", p)
+		}
+	}
+
+	return nil
+}
+
+// checkServedRepo checks that repo is an https:// or ssh:// URL, or an
+// scp-style user@host:path address.
+func checkServedRepo(repo string) error {
+	if strings.HasPrefix(repo, "-") || strings.Contains(repo, "::") {
+		return fmt.Errorf("the Repo %q isn't a repository URL", repo)
+	}
+
+	// An scp-style address has no slash before its colon, and no // after.
+	if i := strings.Index(repo, ":"); i > 1 && !strings.Contains(repo[:i], "/") && !strings.HasPrefix(repo[i+1:], "//") {
+		return nil
+	}
+
+	if u, err := url.Parse(repo); err == nil && (u.Scheme == "https" || u.Scheme == "ssh") && u.Host != "" {
+		return nil
+	}
+
+	return fmt.Errorf("the Repo %q has to be an https:// or ssh:// URL, or user@host:path", repo)
+}
+
+// describe names what's being verified, for the server's log.
+func (req verifyRequest) describe() string {
+	if req.Repo != "" {
+		return strings.TrimSpace(req.Repo + " " + req.Rev)
+	}
+
+	return req.Vendor + " against " + req.Manifest
+}
+
+// run verifies what req asks for and returns the JSON report. It only
+// returns an error if there's no report, which the run's output explains.
+func (s *server) run(ctx context.Context, req verifyRequest) ([]byte, string, error) {
+	tmp, err := ioutil.TempDir("", "godep-verify-serve-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := ""
+	if req.Repo != "" {
+		dir = filepath.Join(tmp, "src")
+
+		if err := gitClone(ctx, dir, req.Repo, "", 0); err != nil {
+			return nil, "", fmt.Errorf("couldn't clone %s: %s", req.Repo, err)
+		}
+
+		if req.Rev != "" {
+			if err := gitCheckout(ctx, dir, req.Rev); err != nil {
+				return nil, "", fmt.Errorf("couldn't check out %s: %s", req.Rev, err)
+			}
+		}
+	}
+
+	reportPath := filepath.Join(tmp, "report.json")
+
+	args := append(append([]string(nil), s.args...), "-quiet", "-format", "json", "-report-output", reportPath)
+	if req.Manifest != "" {
+		args = append(args, "-manifest", req.Manifest)
+
+		if filepath.Base(req.Manifest) == "go.mod" {
+			args = append(args, "-gomod", req.Manifest)
+		}
+	}
+	if req.Vendor != "" {
+		args = append(args, "-vendor", req.Vendor)
+	}
+
+	fmt.Fprintf(output, "verifying %s\n", req.describe())
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.self, args...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, &out, &out
+
+	// A run that fails still writes its report, so only a missing report
+	// means something went wrong.
+	runErr := cmd.Run()
+	if _, ok := runErr.(*exec.ExitError); runErr != nil && !ok {
+		return nil, "", runErr
+	}
+
+	report, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		if runErr != nil {
+			err = runErr
+		}
+
+		return nil, strings.TrimSpace(out.String()), fmt.Errorf("the run didn't write a report: %s", err)
+	}
+
+	return report, "", nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	d, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s\n", d)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// minisignPrefix starts every minisign signature, which is how they're told
+// apart from GPG ones.
+var minisignPrefix = []byte("untrusted comment:")
+
+// verifySignature checks the detached signature at sigPath over the file at
+// path, with gpgv or minisign depending on what kind of signature it is. For
+// GPG, key is a keyring of trusted keys, or empty for gpgv's default one; for
+// minisign, it's the public key file, which has to be given.
+func verifySignature(ctx context.Context, path, sigPath, key string) error {
+	sig, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	if bytes.HasPrefix(sig, minisignPrefix) {
+		if key == "" {
+			return fmt.Errorf("%s is a minisign signature, so -trusted-key has to name the public key to check it with", sigPath)
+		}
+
+		cmd = exec.CommandContext(ctx, "minisign", "-V", "-q", "-p", key, "-m", path, "-x", sigPath)
+	} else {
+		args := []string{"-q"}
+		if key != "" {
+			// gpgv looks for keyrings without a slash in ~/.gnupg.
+			abs, err := filepath.Abs(key)
+			if err != nil {
+				return err
+			}
+
+			args = append(args, "--keyring", abs)
+		}
+
+		cmd = exec.CommandContext(ctx, "gpgv", append(args, sigPath, path)...)
+	}
+
+	if *verbose {
+		fmt.Fprintf(output, "$ %s\n", strings.Join(cmd.Args, " "))
+	}
+
+	// Both print what went wrong last, after the details of the signature.
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			lines := strings.Split(string(out), "\n")
+			return fmt.Errorf("%s: %s", cmd.Args[0], strings.TrimPrefix(lines[len(lines)-1], cmd.Args[0]+": "))
+		}
+
+		return err
+	}
+
+	return nil
+}
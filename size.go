@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// byteSizeUnits are the suffixes parseByteSize accepts, largest first.
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// parseByteSize parses a size like "500M" or "2G", in powers of 1024. A
+// number without a suffix is in bytes.
+func parseByteSize(s string) (int64, error) {
+	t := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+
+	unit := int64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(t, u.suffix) {
+			t, unit = strings.TrimSuffix(t, u.suffix), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("couldn't parse size %q", s)
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// formatByteSize formats n bytes for people to read.
+func formatByteSize(n int64) string {
+	for _, u := range byteSizeUnits {
+		if n >= u.size {
+			return fmt.Sprintf("%.1f%sB", float64(n)/float64(u.size), u.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%dB", n)
+}
+
+// dirSize adds up the sizes of the files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
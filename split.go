@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// splitManifest is a manifest put together from a list of packages and a
+// separate lock file of revisions, for vendoring pipelines that keep them
+// apart.
+type splitManifest struct {
+	deps []Dep
+}
+
+func (m *splitManifest) Deps() []Dep {
+	return m.deps
+}
+
+// readSplitManifest reads the import paths in the file at packagesPath, one
+// per line, and finds each one's revision in the lock file at locksPath. Each
+// line of the lock file has the form "<import path or repo root> <rev>
+// [<version>]", and a package uses the entry for the longest prefix of its
+// import path. Blank lines and lines starting with "#" are ignored in both.
+func readSplitManifest(packagesPath, locksPath string) (Manifest, error) {
+	packages, err := readLines(packagesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lockLines, err := readLines(locksPath)
+	if err != nil {
+		return nil, err
+	}
+
+	locks := make(map[string][]string)
+	for _, l := range lockLines {
+		fields := strings.Fields(l)
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("%s: expected \"<import path> <rev> [<version>]\", got %q", locksPath, l)
+		}
+
+		locks[fields[0]] = fields[1:]
+	}
+
+	var m splitManifest
+	for _, p := range packages {
+		lock, ok := lockFor(locks, p)
+		if !ok {
+			return nil, fmt.Errorf("%s: no revision for %s in %s", packagesPath, p, locksPath)
+		}
+
+		d := Dep{ImportPath: p, Rev: lock[0]}
+		if len(lock) > 1 {
+			d.Comment = lock[1]
+		}
+
+		m.deps = append(m.deps, d)
+	}
+
+	return &m, nil
+}
+
+// lockFor finds the lock entry for the longest prefix of importPath.
+func lockFor(locks map[string][]string, importPath string) ([]string, bool) {
+	for p := importPath; p != "." && p != "/" && p != ""; {
+		if lock, ok := locks[p]; ok {
+			return lock, true
+		}
+
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+
+	return nil, false
+}
+
+// readLines returns the lines of the file at path that aren't blank or
+// comments, without surrounding whitespace.
+// readLines returns the lines of the file at path, or of stdin if path is
+// "-", leaving out blank lines and comments.
+func readLines(path string) ([]string, error) {
+	var d []byte
+	var err error
+	if path == "-" {
+		d, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		d, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, l := range strings.Split(string(d), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// state is kept between runs in the cache directory. It's keyed by the
+// absolute path of the vendor directory, since one cache can be shared by
+// many projects.
+type state struct {
+	path     string
+	Projects map[string]*projectState
+}
+
+type projectState struct {
+	Repositories map[string]*repositoryState
+	// Interrupted records the repositories that passed during a run with
+	// -resume that hasn't finished yet.
+	Interrupted map[string]*repositoryState `json:",omitempty"`
+	// Revisions records the revisions of every repository on the last run
+	// with -check-downgrades.
+	Revisions map[string][]string `json:",omitempty"`
+}
+
+// repositoryState records what a repository looked like the last time it was
+// verified successfully.
+type repositoryState struct {
+	Revs       []string
+	VendorHash string
+}
+
+func loadState(path string) (*state, error) {
+	s := state{path: path, Projects: make(map[string]*projectState)}
+
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &s, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(d, &s); err != nil {
+		return nil, fmt.Errorf("couldn't read state file %q: %s", path, err)
+	}
+
+	return &s, nil
+}
+
+// project returns the state for the vendor directory at vendorPath, creating
+// it if needed.
+func (s *state) project(vendorPath string) (*projectState, error) {
+	abs, err := filepath.Abs(vendorPath)
+	if err != nil {
+		return nil, err
+	}
+
+	p := s.Projects[abs]
+	if p == nil {
+		p = &projectState{Repositories: make(map[string]*repositoryState)}
+		s.Projects[abs] = p
+	}
+
+	if p.Interrupted == nil {
+		p.Interrupted = make(map[string]*repositoryState)
+	}
+
+	if p.Revisions == nil {
+		p.Revisions = make(map[string][]string)
+	}
+
+	return p, nil
+}
+
+func (s *state) save() error {
+	d, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path, d, 0644)
+}
+
+// unchanged reports whether r was last verified at the same revisions and
+// with the same vendored content.
+func (r *repositoryState) unchanged(revs []string, vendorHash string) bool {
+	if r == nil || r.VendorHash != vendorHash || len(r.Revs) != len(revs) {
+		return false
+	}
+
+	for i := range revs {
+		if r.Revs[i] != revs[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// treeHashVersion starts every hash from hashTree, so that one made the way an
+// older build did, which a tree could be changed to match, isn't trusted.
+const treeHashVersion = "v2:"
+
+// hashTree computes a single hash over every file under dir in tree, so that
+// any change to the tree changes the hash. Each file is hashed as a record of
+// its path, mode, size and the SHA-256 of its contents (or a symlink's
+// target), with the path's length before it, so that no two trees have the
+// same records.
+func hashTree(tree vendorTree, dir string) (string, error) {
+	h := sha256.New()
+
+	err := tree.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+
+			return err
+		}
+
+		// Git's own files change without the tree changing, e.g. when it packs
+		// objects, so they're left out.
+		if fi.Name() == ".git" {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		var d []byte
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			d = []byte(target)
+		} else if d, err = tree.ReadFile(path); err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(strings.TrimPrefix(path, dir))
+		sum := sha256.Sum256(d)
+		fmt.Fprintf(h, "%d:%s %o %d %x\n", len(name), name, uint32(fi.Mode()), len(d), sum)
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return treeHashVersion + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashTreeDistinguishesTrees(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b map[string][]byte
+	}{
+		{
+			"a file folded into another",
+			map[string][]byte{"a": []byte("X"), "b": []byte("Y")},
+			map[string][]byte{"a": []byte("X/b\x00Y")},
+		},
+		{
+			"a file dropped",
+			map[string][]byte{"a": []byte("X"), "b": nil},
+			map[string][]byte{"a": []byte("X")},
+		},
+		{
+			"contents moved between files",
+			map[string][]byte{"a": []byte("XY"), "b": []byte("")},
+			map[string][]byte{"a": []byte("X"), "b": []byte("Y")},
+		},
+	}
+
+	for _, tt := range tests {
+		a, err := hashTree(newArchiveTree("v", tt.a), "v")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := hashTree(newArchiveTree("v", tt.b), "v")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a == b {
+			t.Errorf("%s: both trees hash to %s", tt.name, a)
+		}
+	}
+}
+
+func TestHashTreeIncludesMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godep-verify-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "a.sh")
+	if err := ioutil.WriteFile(p, []byte("echo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := hashTree(dirTree{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(p, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := hashTree(dirTree{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if before == after {
+		t.Errorf("making a file executable didn't change the hash %s", before)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkoutStore is a content-addressed store of checked out trees, shared
+// between machines or runs so that a repository only has to be cloned once
+// at each revision. Trees are stored as gzipped tarballs.
+type checkoutStore interface {
+	// Get writes the tarball stored under key to w, returning false if there
+	// isn't one.
+	Get(key string, w io.Writer) (bool, error)
+	// Put stores the tarball read from r under key.
+	Put(key string, r io.Reader) error
+}
+
+// openStore returns the store described by location. Only local directories
+// are supported so far.
+func openStore(location string) (checkoutStore, error) {
+	if strings.Contains(location, "://") {
+		return nil, fmt.Errorf("unsupported store %q; only local directories can be used", location)
+	}
+
+	return dirStore(location), nil
+}
+
+// dirStore keeps tarballs in a local (or network mounted) directory.
+type dirStore string
+
+func (s dirStore) path(key string) string {
+	return filepath.Join(string(s), key[:2], key+".tar.gz")
+}
+
+func (s dirStore) Get(key string, w io.Writer) (bool, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s dirStore) Put(key string, r io.Reader) error {
+	p := s.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(p), ".put-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), p)
+}
+
+// storeKey is the key a repository's tree at rev is stored under.
+func storeKey(root, rev string) string {
+	h := sha256.Sum256([]byte(root + "@" + rev))
+	return hex.EncodeToString(h[:])
+}
+
+// fetchFromStore extracts the tree stored under key into dir. It returns
+// false if the store doesn't have it.
+func fetchFromStore(s checkoutStore, key, dir string) (bool, error) {
+	f, err := ioutil.TempFile("", "godep-verify-store-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	ok, err := s.Get(key, f)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return false, err
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".extract-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extractTarball(f, tmp, 0); err != nil {
+		return false, err
+	}
+
+	return true, os.Rename(tmp, dir)
+}
+
+// saveToStore puts the tree at dir, without its .git directory, in the store
+// under key.
+func saveToStore(s checkoutStore, key, dir string) error {
+	r, w := io.Pipe()
+
+	go func() {
+		w.CloseWithError(writeTarball(w, dir))
+	}()
+
+	err := s.Put(key, r)
+	r.Close()
+	return err
+}
+
+func writeTarball(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// A worktree has a .git file pointing at its repository, rather than
+		// a directory.
+		if fi.Name() == ".git" {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// extractTarball extracts the regular files in the gzipped tarball read from r
+// into dir, removing the first strip directories from each name.
+func extractTarball(r io.Reader, dir string, strip int) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	return extractTar(gz, dir, strip)
+}
+
+// extractTar is extractTarball for a tarball that isn't compressed.
+func extractTar(r io.Reader, dir string, strip int) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := hdr.Name
+		for i := 0; i < strip; i++ {
+			if j := strings.Index(name, "/"); j >= 0 {
+				name = name[j+1:]
+			} else {
+				name = ""
+			}
+		}
+		if name == "" {
+			continue
+		}
+
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			return fmt.Errorf("tarball entry %q is outside the tree", hdr.Name)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+}
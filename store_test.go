@@ -0,0 +1,91 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// tarOf returns an uncompressed tarball of regular files with the given
+// names, each holding its own name.
+func tarOf(t *testing.T, names ...string) *bytes.Buffer {
+	var b bytes.Buffer
+
+	tw := tar.NewWriter(&b)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &b
+}
+
+func TestExtractTar(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		strip   int
+		want    []string
+		wantErr bool
+	}{
+		{"files", []string{"a.go", "x/b.go"}, 0, []string{"a.go", "x/b.go"}, false},
+		{"stripped", []string{"top/a.go", "top/x/b.go", "top"}, 1, []string{"a.go", "x/b.go"}, false},
+		{"absolute", []string{"/a.go"}, 0, []string{"a.go"}, false},
+		{"parent", []string{"../out.go"}, 0, nil, true},
+		{"parent inside", []string{"x/../../out.go"}, 0, nil, true},
+		{"parent after strip", []string{"top/../out.go"}, 1, nil, true},
+		{"sibling with the same prefix", []string{"../dir2/out.go"}, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		parent, err := ioutil.TempDir("", "godep-verify-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(parent)
+
+		dir := filepath.Join(parent, "dir")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		err = extractTar(tarOf(t, tt.entries...), dir, tt.strip)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: extracting %q succeeded", tt.name, tt.entries)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+
+		var got []string
+		filepath.Walk(parent, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+
+			got = append(got, filepath.ToSlash(rel))
+			return nil
+		})
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: extracted %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// successProof is written by -success-output after a run in which every
+// repository passed, as evidence that verification really happened.
+type successProof struct {
+	Status       string
+	Manifest     string
+	Time         time.Time
+	Tool         toolInfo
+	Repositories []provedRepository
+}
+
+type provedRepository struct {
+	Root       string
+	Repository string
+	Revs       []string
+	// FilesChecked is how many files were compared. It's zero for a
+	// repository that was skipped because it passed before, with -incremental
+	// or -resume.
+	FilesChecked int
+	Skipped      bool `json:",omitempty"`
+	// AcceptedFiles are the files that matched a revision given with
+	// -accept-rev rather than one of Revs.
+	AcceptedFiles []acceptedFile `json:",omitempty"`
+}
+
+// writeSuccessProof writes the proof for a passing run to path. If the run
+// failed, any file already at path is removed instead, so that an old proof
+// can't be mistaken for a new one.
+func writeSuccessProof(path string, failed bool, manifestPath string, names []string, repos map[string]*repository) error {
+	if failed {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	p := successProof{Status: "passed", Manifest: manifestPath, Time: time.Now().UTC(), Tool: currentTool()}
+
+	for _, name := range names {
+		repo := repos[name]
+
+		p.Repositories = append(p.Repositories, provedRepository{
+			Root:          name,
+			Repository:    repo.Root.Repo,
+			Revs:          repo.revs(),
+			FilesChecked:  repo.Report.Checked,
+			Skipped:       repo.Report.Skipped,
+			AcceptedFiles: repo.acceptedFiles,
+		})
+	}
+
+	d, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(d, '\n'), 0644)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// taintedPackages returns the import paths of the packages in the vendor
+// directory that import target, directly or through other vendored packages,
+// along with target itself if it's vendored.
+func taintedPackages(vendorPath, target string, includeTests bool) (map[string]bool, error) {
+	importedBy := make(map[string][]string)
+
+	err := filepath.Walk(vendorPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() {
+			return nil
+		}
+
+		if path != vendorPath && (strings.HasPrefix(fi.Name(), ".") || strings.HasPrefix(fi.Name(), "_") || fi.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(vendorPath, path)
+		if err != nil {
+			return err
+		}
+
+		imports, err := fileImports(path, includeTests)
+		if err != nil {
+			return err
+		}
+
+		for _, i := range imports {
+			importedBy[i] = append(importedBy[i], filepath.ToSlash(rel))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tainted := make(map[string]bool)
+	if _, err := os.Stat(filepath.Join(vendorPath, filepath.FromSlash(target))); err == nil {
+		tainted[target] = true
+	}
+
+	queue := []string{target}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		for _, q := range importedBy[p] {
+			if !tainted[q] {
+				tainted[q] = true
+				queue = append(queue, q)
+			}
+		}
+	}
+
+	return tainted, nil
+}
+
+// taintedDeps returns the dependencies in deps that contain any of the
+// tainted packages.
+func taintedDeps(deps []Dep, tainted map[string]bool) []Dep {
+	var matching []Dep
+	for _, d := range deps {
+		for p := range tainted {
+			if p == d.ImportPath || strings.HasPrefix(p, d.ImportPath+"/") {
+				matching = append(matching, d)
+				break
+			}
+		}
+	}
+
+	return matching
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// removedTests returns the test files in the source of repo's vendored
+// packages that aren't in the vendor directory, given the files that are
+// (relative to the repository root, as seen). Tools that leave tests out
+// leave them all out, so it's only when some of the repository's tests were
+// vendored that any missing ones look like they were removed on purpose.
+// Packages in directories that were excluded aren't looked at.
+func removedTests(repo *repository, filter *fileFilter, seen map[string]bool) ([]string, error) {
+	kept := false
+	for p := range seen {
+		if strings.HasSuffix(p, "_test.go") {
+			kept = true
+			break
+		}
+	}
+
+	if !kept {
+		return nil, nil
+	}
+
+	var removed []string
+	for _, pd := range repo.packageDirs(false) {
+		if filter.excludedDir(repo.Name, pd.Dir) {
+			continue
+		}
+
+		inner, ok := pd.Checkout.relative(pd.Dir)
+		if !ok {
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(filepath.Join(pd.Checkout.Dir, filepath.FromSlash(inner)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if p := path.Join(pd.Dir, e.Name()); !e.IsDir() && strings.HasSuffix(e.Name(), "_test.go") && !seen[p] {
+				removed = append(removed, p)
+			}
+		}
+	}
+
+	return removed, nil
+}
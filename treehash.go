@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// treeHashes maps a repository root and version (the manifest's Comment, or
+// its Rev if there is no Comment) or revision to the git tree hash we expect
+// to see when it's checked out. Hashes keyed by revision can come from
+// somewhere independent, like a transparency log, to catch a remote serving
+// different content for a commit than it did when the hash was recorded.
+type treeHashes map[string]map[string]string
+
+// readTreeHashes parses a sidecar file of expected tree hashes. Each line has
+// the form "<repo root> <version> <tree hash>"; blank lines and lines starting
+// with "#" are ignored.
+func readTreeHashes(path string) (treeHashes, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(treeHashes)
+	for i, l := range strings.Split(string(d), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		fields := strings.Fields(l)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"<repo root> <version> <tree hash>\"", path, i+1)
+		}
+
+		if hashes[fields[0]] == nil {
+			hashes[fields[0]] = make(map[string]string)
+		}
+		hashes[fields[0]][fields[1]] = fields[2]
+	}
+
+	return hashes, nil
+}
+
+// lookup returns the expected tree hash for root at the given version or,
+// failing that, revision, if one has been recorded.
+func (h treeHashes) lookup(root, version, rev string) (string, bool) {
+	if hash, ok := h[root][version]; ok {
+		return hash, true
+	}
+
+	hash, ok := h[root][rev]
+	return hash, ok
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importPather is implemented by manifests that know the import path of the
+// project they belong to.
+type importPather interface {
+	ProjectImportPath() string
+}
+
+// fileImports returns the import paths used by the Go files directly in dir.
+// Test files are skipped unless includeTests is set.
+func fileImports(dir string, includeTests bool) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var imports []string
+	fset := token.NewFileSet()
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+
+		if !includeTests && strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, e.Name()), nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range f.Imports {
+			p, err := strconv.Unquote(i.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			imports = append(imports, p)
+		}
+	}
+
+	return imports, nil
+}
+
+// projectImports returns the imports of every Go file in the project under
+// dir, leaving out the vendor directory and anything the go command would
+// ignore.
+func projectImports(dir, vendorPath string, includeTests bool) ([]string, error) {
+	vendorAbs, err := filepath.Abs(vendorPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var imports []string
+
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() {
+			return nil
+		}
+
+		if abs, err := filepath.Abs(path); err == nil && abs == vendorAbs {
+			return filepath.SkipDir
+		}
+
+		if path != dir && (strings.HasPrefix(fi.Name(), ".") || strings.HasPrefix(fi.Name(), "_") || fi.Name() == "testdata" || fi.Name() == "vendor") {
+			return filepath.SkipDir
+		}
+
+		i, err := fileImports(path, includeTests)
+		if err != nil {
+			return err
+		}
+
+		imports = append(imports, i...)
+
+		return nil
+	})
+
+	return imports, err
+}
+
+// isStandardImport reports whether path looks like a standard library
+// package, which is to say its first element has no dot in it.
+func isStandardImport(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+// checkUsage cross-references the packages the project imports (directly, or
+// through other vendored packages) with the vendor directory and the
+// manifest. It returns a description of each imported package that isn't
+// vendored or isn't listed in the manifest, and of each package in the
+// manifest that's never imported.
+func checkUsage(project string, deps []Dep, vendorPath string, includeTests bool) ([]string, error) {
+	inManifest := make(map[string]bool)
+	for _, d := range deps {
+		inManifest[d.ImportPath] = true
+	}
+
+	queue, err := projectImports(".", vendorPath, includeTests)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	missing := make(map[string]bool)
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		if used[p] || missing[p] || isStandardImport(p) || p == "C" {
+			continue
+		}
+
+		if project != "" && (p == project || strings.HasPrefix(p, project+"/")) {
+			continue
+		}
+
+		imports, err := fileImports(filepath.Join(vendorPath, filepath.FromSlash(p)), includeTests)
+		if err != nil {
+			return nil, err
+		}
+
+		if imports == nil {
+			if _, err := os.Stat(filepath.Join(vendorPath, filepath.FromSlash(p))); err != nil {
+				missing[p] = true
+				continue
+			}
+		}
+
+		used[p] = true
+		queue = append(queue, imports...)
+	}
+
+	var problems []string
+
+	for _, p := range sortedKeys(missing) {
+		problems = append(problems, p+" is imported but isn't vendored")
+	}
+
+	for _, p := range sortedKeys(used) {
+		if !inManifest[p] {
+			problems = append(problems, p+" is imported from the vendor directory but isn't in the manifest, so it hasn't been verified")
+		}
+	}
+
+	for _, d := range deps {
+		if !used[d.ImportPath] {
+			problems = append(problems, d.ImportPath+" is vendored but never imported")
+		}
+	}
+
+	return problems, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
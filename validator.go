@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// validator is an external program, given by -validator, that decides
+// whether a changed file is acceptable after all. It's run with the vendored
+// file, its source and the import path of its package as extra arguments,
+// and accepts the change by exiting with status zero.
+type validator struct {
+	args []string
+}
+
+// newValidator parses the -validator command line. Unlike -diff-tool, a
+// validator that can't be found is an error, as every change would fail.
+func newValidator(command string) (*validator, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("-validator is empty")
+	}
+
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, fmt.Errorf("couldn't find -validator %q: %s", args[0], err)
+	}
+
+	return &validator{args: args}, nil
+}
+
+// accepts runs the validator for the vendored file at vendoredPath, whose
+// source is at sourcePath, in the package importPath.
+func (v *validator) accepts(ctx context.Context, vendoredPath, sourcePath, importPath string) (bool, error) {
+	args := append(append([]string(nil), v.args[1:]...), vendoredPath, sourcePath, importPath)
+
+	cmd := exec.CommandContext(ctx, v.args[0], args...)
+	cmd.Stdout, cmd.Stderr = output, errOutput
+	if *verbose {
+		fmt.Fprintf(output, "$ %s %s\n", v.args[0], strings.Join(args, " "))
+	}
+
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// vcsMetadataNames are the names of the directories (or, for a git worktree
+// or submodule, files) that version control systems keep their metadata in.
+var vcsMetadataNames = map[string]bool{".git": true, ".hg": true, ".svn": true, ".bzr": true}
+
+// findVCSMetadata returns the paths of any version control metadata under
+// vendorPath in tree. godep never copies it, so it's there by mistake, usually
+// from cloning a dependency straight into the vendor directory.
+func findVCSMetadata(tree vendorTree, vendorPath string) ([]string, error) {
+	var found []string
+
+	err := tree.Walk(vendorPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == vendorPath {
+				return nil
+			}
+
+			// Directories that can't be read are reported when they're
+			// compared.
+			if os.IsPermission(err) && path != vendorPath {
+				return nil
+			}
+
+			return err
+		}
+
+		if path == vendorPath || !vcsMetadataNames[fi.Name()] {
+			return nil
+		}
+
+		found = append(found, path)
+
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return found, err
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// vendorTree holds the vendored files being verified, which are normally in a
+// directory, but can be read straight from an archive of one.
+type vendorTree interface {
+	// Walk visits the files and directories under root in lexical order, the
+	// same way as filepath.Walk.
+	Walk(root string, fn filepath.WalkFunc) error
+	ReadFile(name string) ([]byte, error)
+	Open(name string) (io.ReadCloser, error)
+}
+
+// errFoundFile stops hasFiles's walk at the first file.
+var errFoundFile = fmt.Errorf("found a file")
+
+// hasFiles reports whether there are any files under dir in tree, counting
+// anything that can't be read as one.
+func hasFiles(tree vendorTree, dir string) (bool, error) {
+	err := tree.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+
+			// Something's there, even if it can't be read, which is
+			// reported when it's compared.
+			if os.IsPermission(err) {
+				return errFoundFile
+			}
+
+			return err
+		}
+
+		if !fi.IsDir() {
+			return errFoundFile
+		}
+
+		return nil
+	})
+
+	if err == errFoundFile {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// inDirs reports whether the slash-separated path p is one of dirs, or is
+// under one of them.
+func inDirs(p string, dirs []string) bool {
+	for _, d := range dirs {
+		if p == d || strings.HasPrefix(p, d+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openVendorTree opens the vendor directory at p, or the archive, if it's a
+// zip or gzipped tarball.
+func openVendorTree(p string) (vendorTree, error) {
+	switch {
+	case strings.HasSuffix(p, ".zip"):
+		return readZipTree(p)
+	case strings.HasSuffix(p, ".tar.gz"), strings.HasSuffix(p, ".tgz"):
+		return readTarTree(p)
+	}
+
+	return dirTree{}, nil
+}
+
+// isVendorArchive reports whether the vendor directory at p is an archive.
+func isVendorArchive(p string) bool {
+	return strings.HasSuffix(p, ".zip") || strings.HasSuffix(p, ".tar.gz") || strings.HasSuffix(p, ".tgz")
+}
+
+// archiveEntryName checks that an archive entry is inside the tree, and
+// returns its cleaned name.
+func archiveEntryName(name string) (string, error) {
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return "", fmt.Errorf("archive entry %q is outside the tree", name)
+	}
+
+	return clean, nil
+}
+
+// dirTree is a vendor directory on disk.
+type dirTree struct{}
+
+func (dirTree) Walk(root string, fn filepath.WalkFunc) error { return filepath.Walk(root, fn) }
+func (dirTree) ReadFile(name string) ([]byte, error)         { return ioutil.ReadFile(name) }
+func (dirTree) Open(name string) (io.ReadCloser, error)      { return os.Open(name) }
+
+// archiveTree holds the regular files of an archive in memory. Their paths
+// are under root, the path of the archive, which stands in for the vendor
+// directory.
+type archiveTree struct {
+	root     string
+	files    map[string][]byte
+	children map[string][]string
+}
+
+func newArchiveTree(root string, files map[string][]byte) *archiveTree {
+	// Archives are often made of the vendor directory itself, rather than
+	// its contents.
+	prefix := "vendor/"
+	for name := range files {
+		if !strings.HasPrefix(name, prefix) {
+			prefix = ""
+			break
+		}
+	}
+
+	t := &archiveTree{root: filepath.Clean(root), files: make(map[string][]byte), children: make(map[string][]string)}
+	seen := make(map[string]bool)
+
+	for name, d := range files {
+		name = strings.TrimPrefix(name, prefix)
+		t.files[name] = d
+
+		for p := name; p != "."; p = path.Dir(p) {
+			if seen[p] {
+				break
+			}
+			seen[p] = true
+
+			t.children[path.Dir(p)] = append(t.children[path.Dir(p)], path.Base(p))
+		}
+	}
+
+	for _, c := range t.children {
+		sort.Strings(c)
+	}
+
+	return t
+}
+
+// name returns the path within the archive of p, which is under t.root.
+func (t *archiveTree) name(p string) (string, bool) {
+	p = filepath.Clean(p)
+	if p == t.root {
+		return ".", true
+	}
+
+	if !strings.HasPrefix(p, t.root+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.ToSlash(strings.TrimPrefix(p, t.root+string(filepath.Separator))), true
+}
+
+func (t *archiveTree) ReadFile(p string) ([]byte, error) {
+	if name, ok := t.name(p); ok {
+		if d, ok := t.files[name]; ok {
+			return d, nil
+		}
+	}
+
+	return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+}
+
+// Open returns a reader for the file at p, which is already in memory.
+func (t *archiveTree) Open(p string) (io.ReadCloser, error) {
+	d, err := t.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(d)), nil
+}
+
+func (t *archiveTree) Walk(root string, fn filepath.WalkFunc) error {
+	name, ok := t.name(root)
+	if !ok || (t.files[name] == nil && t.children[name] == nil && name != ".") {
+		return fn(root, nil, &os.PathError{Op: "lstat", Path: root, Err: os.ErrNotExist})
+	}
+
+	err := t.walk(root, name, fn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (t *archiveTree) walk(p, name string, fn filepath.WalkFunc) error {
+	d, isFile := t.files[name]
+	if isFile {
+		return fn(p, archiveFileInfo{name: path.Base(name), size: int64(len(d))}, nil)
+	}
+
+	if err := fn(p, archiveFileInfo{name: path.Base(name), dir: true}, nil); err != nil {
+		return err
+	}
+
+	for _, c := range t.children[name] {
+		err := t.walk(filepath.Join(p, c), path.Join(name, c), fn)
+		if err != nil && (err != filepath.SkipDir || t.files[path.Join(name, c)] != nil) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// archiveFileInfo describes a file or directory in an archiveTree.
+type archiveFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi archiveFileInfo) Name() string       { return fi.name }
+func (fi archiveFileInfo) Size() int64        { return fi.size }
+func (fi archiveFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi archiveFileInfo) IsDir() bool        { return fi.dir }
+func (fi archiveFileInfo) Sys() interface{}   { return nil }
+
+func (fi archiveFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func readZipTree(p string) (*archiveTree, error) {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	files := make(map[string][]byte)
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		d, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := archiveEntryName(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		files[name] = d
+	}
+
+	return newArchiveTree(p, files), nil
+}
+
+func readTarTree(p string) (*archiveTree, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files, err := readTarFiles(gz)
+	if err != nil {
+		return nil, err
+	}
+
+	return newArchiveTree(p, files), nil
+}
+
+// readTarFiles reads the regular files in the tarball r, keyed by name.
+func readTarFiles(r io.Reader) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		d, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := archiveEntryName(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		files[name] = d
+	}
+
+	return files, nil
+}
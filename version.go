@@ -0,0 +1,15 @@
+package main
+
+import "runtime"
+
+// toolInfo identifies the build of this program that produced a result, so
+// that attestations and reports can be traced back to it.
+type toolInfo struct {
+	Version   string
+	GoVersion string
+}
+
+// currentTool describes this build of the program.
+func currentTool() toolInfo {
+	return toolInfo{Version: buildVersion(), GoVersion: runtime.Version()}
+}
@@ -0,0 +1,18 @@
+//go:build go1.12
+// +build go1.12
+
+package main
+
+import "runtime/debug"
+
+// buildVersion returns the module version this program was built at, which
+// is "(devel)" for a build from a local checkout, or "unknown" if it wasn't
+// built in module mode.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "unknown"
+	}
+
+	return info.Main.Version
+}
@@ -0,0 +1,10 @@
+//go:build !go1.12
+// +build !go1.12
+
+package main
+
+// buildVersion can't find out the version before Go 1.12, which added build
+// info to binaries.
+func buildVersion() string {
+	return "unknown"
+}
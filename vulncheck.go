@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// vulnDatabase is a copy of the Go vulnerability database, either served over
+// HTTP like vuln.go.dev or in a local directory with the same layout.
+type vulnDatabase string
+
+// read returns the file at name (like "index/modules.json") in the database.
+func (db vulnDatabase) read(ctx context.Context, name string) ([]byte, error) {
+	if !strings.Contains(string(db), "://") {
+		return ioutil.ReadFile(filepath.Join(string(db), filepath.FromSlash(name)))
+	}
+
+	u := strings.TrimSuffix(string(db), "/") + "/" + name
+
+	if *verbose {
+		fmt.Fprintf(output, "downloading %s\n", u)
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// vulnIndexEntry is a module in the database's index/modules.json, with the
+// IDs of the vulnerabilities that affect it.
+type vulnIndexEntry struct {
+	Path  string `json:"path"`
+	Vulns []struct {
+		ID string `json:"id"`
+	} `json:"vulns"`
+}
+
+// osvEntry is the part of an OSV vulnerability report we care about.
+type osvEntry struct {
+	ID       string   `json:"id"`
+	Summary  string   `json:"summary"`
+	Aliases  []string `json:"aliases"`
+	Affected []struct {
+		Package struct {
+			Name string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced string `json:"introduced"`
+				Fixed      string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+}
+
+// affects reports whether the vulnerability affects module at version, and if
+// so, the first version with a fix, if there is one.
+func (e *osvEntry) affects(module, version string) (bool, string) {
+	for _, a := range e.Affected {
+		if a.Package.Name != module {
+			continue
+		}
+
+		for _, r := range a.Ranges {
+			if r.Type != "SEMVER" {
+				continue
+			}
+
+			// The events are in order, each one starting or ending a range of
+			// affected versions.
+			affected, fixed := false, ""
+			for _, ev := range r.Events {
+				if ev.Introduced != "" && compareVersions(version, "v"+ev.Introduced) >= 0 {
+					affected, fixed = true, ""
+				}
+				if ev.Fixed != "" {
+					if compareVersions(version, "v"+ev.Fixed) >= 0 {
+						affected = false
+					} else if affected && fixed == "" {
+						fixed = "v" + ev.Fixed
+					}
+				}
+			}
+
+			if affected {
+				return true, fixed
+			}
+		}
+	}
+
+	return false, ""
+}
+
+// vulnerability is a known vulnerability in a vendored module.
+type vulnerability struct {
+	Module  string
+	Version string
+	Entry   *osvEntry
+	Fixed   string
+}
+
+func (v vulnerability) String() string {
+	s := fmt.Sprintf("%s %s is affected by %s", v.Module, v.Version, v.Entry.ID)
+	if len(v.Entry.Aliases) > 0 {
+		s += " (" + strings.Join(v.Entry.Aliases, ", ") + ")"
+	}
+	if v.Entry.Summary != "" {
+		s += ": " + v.Entry.Summary
+	}
+	if v.Fixed != "" {
+		s += "; fixed in " + v.Fixed
+	}
+
+	return s
+}
+
+// releaseVersionRegexp matches the versions the database can be checked with:
+// releases and pre-releases like go.mod has, including pseudo-versions, but
+// not git describe output like v1.2.3-4-gabcdef0 from godep.
+var releaseVersionRegexp = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+(?:-[0-9A-Za-z.-]+)?(?:\+incompatible)?$`)
+
+var describeVersionRegexp = regexp.MustCompile(`-[0-9]+-g[0-9a-f]+$`)
+
+// checkVulnerabilities looks up each dependency in deps in db, using the
+// version in its comment, and returns the known vulnerabilities that affect
+// it, along with the dependencies that couldn't be looked up because they
+// aren't pinned at a version.
+func checkVulnerabilities(ctx context.Context, db vulnDatabase, deps []Dep) ([]vulnerability, []string, error) {
+	d, err := db.read(ctx, "index/modules.json")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var index []vulnIndexEntry
+	if err := json.Unmarshal(d, &index); err != nil {
+		return nil, nil, fmt.Errorf("couldn't read the vulnerability database index: %s", err)
+	}
+
+	var vulns []vulnerability
+	var unversioned []string
+	entries := make(map[string]*osvEntry)
+	seen := make(map[string]bool)
+
+	for _, dep := range deps {
+		version := dep.Comment
+		if !releaseVersionRegexp.MatchString(version) || describeVersionRegexp.MatchString(version) {
+			unversioned = append(unversioned, dep.ImportPath)
+			continue
+		}
+
+		// Manifests like godep's list packages, so the module is the longest
+		// path in the index that the import path is in.
+		var module *vulnIndexEntry
+		for i, m := range index {
+			if (dep.ImportPath == m.Path || strings.HasPrefix(dep.ImportPath, m.Path+"/")) && (module == nil || len(m.Path) > len(module.Path)) {
+				module = &index[i]
+			}
+		}
+
+		if module == nil || seen[module.Path+"@"+version] {
+			continue
+		}
+		seen[module.Path+"@"+version] = true
+
+		for _, v := range module.Vulns {
+			e, ok := entries[v.ID]
+			if !ok {
+				d, err := db.read(ctx, "ID/"+v.ID+".json")
+				if err != nil {
+					return nil, nil, err
+				}
+
+				e = new(osvEntry)
+				if err := json.Unmarshal(d, e); err != nil {
+					return nil, nil, fmt.Errorf("couldn't read vulnerability %s: %s", v.ID, err)
+				}
+
+				entries[v.ID] = e
+			}
+
+			if ok, fixed := e.affects(module.Path, version); ok {
+				vulns = append(vulns, vulnerability{Module: module.Path, Version: version, Entry: e, Fixed: fixed})
+			}
+		}
+	}
+
+	return vulns, unversioned, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often -watch looks for changes in the vendor
+// directory.
+const watchInterval = time.Second
+
+// fileStamp is what -watch looks at to tell whether a file changed.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshotVendor records the size and modification time of every file under
+// dir, keyed by its path relative to dir, with slashes.
+func snapshotVendor(dir string) (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if vcsMetadataNames[fi.Name()] && fi.IsDir() {
+			return filepath.SkipDir
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		stamps[filepath.ToSlash(rel)] = fileStamp{fi.Size(), fi.ModTime()}
+
+		return nil
+	})
+
+	return stamps, err
+}
+
+// watchVendor verifies files in the vendor directory at vendorPath again as
+// they change, against the checkouts already made for repos, until ctx is
+// done. Nothing is fetched, so it only knows about the repositories that were
+// verified to begin with.
+func watchVendor(ctx context.Context, vendorPath string, repos map[string]*repository, filter *fileFilter, hash func([]byte) []byte) error {
+	before, err := snapshotVendor(vendorPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "# Watching %s for changes\n", vendorPath)
+
+	t := time.NewTicker(watchInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+
+		after, err := snapshotVendor(vendorPath)
+		if err != nil {
+			return err
+		}
+
+		var changed []string
+		for p, s := range after {
+			if b, ok := before[p]; !ok || b != s {
+				changed = append(changed, p)
+			}
+		}
+		for p := range before {
+			if _, ok := after[p]; !ok {
+				changed = append(changed, p)
+			}
+		}
+		before = after
+
+		sort.Strings(changed)
+		for _, p := range changed {
+			_, exists := after[p]
+			if err := verifyChangedFile(vendorPath, p, exists, repos, filter, hash); err != nil {
+				fmt.Fprintf(output, "[!] Couldn't verify %s: %s\n", p, err)
+			}
+		}
+	}
+}
+
+// verifyChangedFile compares the vendored file at p (relative to vendorPath)
+// with its source again, or checks whether it should have been there if it
+// was removed.
+func verifyChangedFile(vendorPath, p string, exists bool, repos map[string]*repository, filter *fileFilter, hash func([]byte) []byte) error {
+	var name string
+	for n, r := range repos {
+		if strings.HasPrefix(p, n+"/") && len(n) > len(name) && !r.Skip && !r.Broken {
+			name = n
+		}
+	}
+
+	if name == "" {
+		fmt.Fprintf(output, "%s changed, but isn't in a repository that was verified\n", p)
+		return nil
+	}
+
+	repo, relativePath := repos[name], strings.TrimPrefix(p, name+"/")
+
+	co := repo.checkoutFor(relativePath)
+
+	reason, err := filter.excluded(name, co.Dir, relativePath, false)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		if *verbose {
+			fmt.Fprintf(output, "%s changed, but is excluded by %s\n", p, reason)
+		}
+
+		return nil
+	}
+
+	var source []byte
+	inner, ok := co.relative(relativePath)
+	if ok {
+		source, err = ioutil.ReadFile(filepath.Join(co.Dir, inner))
+		if os.IsNotExist(err) {
+			ok, err = false, nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !exists {
+		if ok {
+			fmt.Fprintf(output, "[!] File %s is missing\n", p)
+		} else {
+			fmt.Fprintf(output, "removed %s\n", p)
+		}
+
+		return nil
+	}
+
+	vendored, err := ioutil.ReadFile(filepath.Join(vendorPath, filepath.FromSlash(p)))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !ok:
+		fmt.Fprintf(output, "[!] File %s isn't in the source\n", p)
+	case bytes.Equal(hash(vendored), hash(source)):
+		fmt.Fprintf(output, "ok %s\n", p)
+	default:
+		lines := changedLines(splitLines(string(vendored)), splitLines(string(source)))
+		fmt.Fprintf(output, "[!] File %s has changes %s\n", p, describeLines(lines))
+	}
+
+	return nil
+}
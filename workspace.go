@@ -0,0 +1,172 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// goWork is a go.work file, along with the go.mod files of the modules it
+// uses. `go work vendor` vendors the dependencies of all of them into a single
+// vendor directory next to go.work, so they're verified together.
+type goWork struct {
+	file    *goMod
+	modules []*goMod
+}
+
+func detectGoWorkManifest(d []byte) bool {
+	for _, l := range strings.Split(string(d), "\n") {
+		if l = strings.TrimSpace(l); l == "use" || strings.HasPrefix(l, "use ") || strings.HasPrefix(l, "use(") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseGoWorkManifest(d []byte) (Manifest, error) {
+	f, err := parseGoMod(d, "go.work")
+	if err != nil {
+		return nil, err
+	}
+
+	return &goWork{file: f}, nil
+}
+
+// readModules reads the go.mod file of each module the workspace uses, from
+// the directories listed relative to dir.
+func (w *goWork) readModules(dir string) error {
+	for _, u := range w.file.Use {
+		p := filepath.FromSlash(u)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+
+		m, err := readGoMod(filepath.Join(p, "go.mod"))
+		if err != nil {
+			return err
+		}
+
+		w.modules = append(w.modules, m)
+	}
+
+	return nil
+}
+
+// Deps returns the modules required by any of the workspace's modules, other
+// than the workspace's modules themselves. When several require the same
+// module, the highest version is used, as it would be in the build.
+func (w *goWork) Deps() []Dep {
+	members := make(map[string]bool)
+	for _, m := range w.modules {
+		members[m.Module] = true
+	}
+
+	var deps []Dep
+	index := make(map[string]int)
+
+	for _, m := range w.modules {
+		for _, d := range m.Deps() {
+			if members[d.ImportPath] {
+				continue
+			}
+
+			i, ok := index[d.ImportPath]
+			if !ok {
+				index[d.ImportPath] = len(deps)
+				deps = append(deps, d)
+				continue
+			}
+
+			if compareVersions(d.Comment, deps[i].Comment) > 0 {
+				deps[i] = d
+			}
+		}
+	}
+
+	return deps
+}
+
+// compareVersions compares two semantic versions like v1.2.3-pre, returning
+// -1, 0 or 1. Build metadata, like +incompatible, is ignored.
+func compareVersions(a, b string) int {
+	a, b = strings.SplitN(a, "+", 2)[0], strings.SplitN(b, "+", 2)[0]
+
+	ap, apre := splitPrerelease(a)
+	bp, bpre := splitPrerelease(b)
+
+	an, bn := strings.Split(strings.TrimPrefix(ap, "v"), "."), strings.Split(strings.TrimPrefix(bp, "v"), ".")
+	for i := 0; i < 3; i++ {
+		if c := compareNumbers(part(an, i), part(bn, i)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+
+	af, bf := strings.Split(apre, "."), strings.Split(bpre, ".")
+	for i := 0; i < len(af) && i < len(bf); i++ {
+		_, aerr := strconv.Atoi(af[i])
+		_, berr := strconv.Atoi(bf[i])
+
+		var c int
+		switch {
+		case aerr == nil && berr == nil:
+			c = compareNumbers(af[i], bf[i])
+		case aerr == nil:
+			c = -1
+		case berr == nil:
+			c = 1
+		default:
+			c = strings.Compare(af[i], bf[i])
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	return compareNumbers(strconv.Itoa(len(af)), strconv.Itoa(len(bf)))
+}
+
+func splitPrerelease(v string) (string, string) {
+	if i := strings.Index(v, "-"); i != -1 {
+		return v[:i], v[i+1:]
+	}
+
+	return v, ""
+}
+
+func part(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+
+	return "0"
+}
+
+// compareNumbers compares two decimal numbers of any length.
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+
+	switch {
+	case len(a) != len(b):
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}